@@ -0,0 +1,77 @@
+package opcae
+
+import (
+	"time"
+)
+
+// AckRequest identifies a condition to be acknowledged.
+// ActiveTime and Cookie must be taken from the event notification being acknowledged.
+type AckRequest struct {
+	Source     string
+	Condition  string
+	ActiveTime time.Time
+	Cookie     uint32
+}
+
+type AckStatus int
+
+const (
+	// AckSucceeded the condition was acknowledged
+	AckSucceeded AckStatus = iota
+	// AckAlreadyAcked the condition was already acknowledged, OPC_S_ALREADYACKED
+	AckAlreadyAcked
+	// AckInvalidTime the active time does not match the latest active time, OPC_E_INVALIDTIME
+	AckInvalidTime
+	// AckNoInfo the server has no information about the condition, OPC_E_NOINFO
+	AckNoInfo
+	// AckFailed any other failure, see AckResult.Err
+	AckFailed
+)
+
+func (s AckStatus) String() string {
+	switch s {
+	case AckSucceeded:
+		return "succeeded"
+	case AckAlreadyAcked:
+		return "already acked"
+	case AckInvalidTime:
+		return "invalid time"
+	case AckNoInfo:
+		return "no info"
+	case AckFailed:
+		return "failed"
+	}
+	return "unknown"
+}
+
+// AckResult is the result of acknowledging a single condition
+type AckResult struct {
+	Request *AckRequest
+	Status  AckStatus
+	Code    uint32
+	// Err is nil when the condition was acknowledged or was already acknowledged
+	Err error
+}
+
+func newAckResult(request *AckRequest, code int32, err error) *AckResult {
+	result := &AckResult{
+		Request: request,
+		Code:    uint32(code),
+		Err:     err,
+	}
+	switch {
+	case code == 0:
+		result.Status = AckSucceeded
+	case uint32(code) == OPC_S_ALREADYACKED:
+		result.Status = AckAlreadyAcked
+	case uint32(code) == OPC_E_INVALIDTIME:
+		result.Status = AckInvalidTime
+	case uint32(code) == OPC_E_NOINFO:
+		result.Status = AckNoInfo
+	case code > 0:
+		result.Status = AckSucceeded
+	default:
+		result.Status = AckFailed
+	}
+	return result
+}
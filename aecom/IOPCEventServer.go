@@ -1,3 +1,5 @@
+//go:build windows
+
 package aecom
 
 import (
@@ -100,9 +102,9 @@ func (v *IOPCEventServer) GetStatus() (*EventServerStatus, error) {
 		}
 	}()
 	status := &EventServerStatus{
-		StartTime:      time.Unix(0, pStatus.FtStartTime.Nanoseconds()),
-		CurrentTime:    time.Unix(0, pStatus.FtCurrentTime.Nanoseconds()),
-		LastUpdateTime: time.Unix(0, pStatus.FtLastUpdateTime.Nanoseconds()),
+		StartTime:      FiletimeToTime(pStatus.FtStartTime),
+		CurrentTime:    FiletimeToTime(pStatus.FtCurrentTime),
+		LastUpdateTime: FiletimeToTime(pStatus.FtLastUpdateTime),
 		ServerState:    pStatus.DwServerState,
 		MajorVersion:   pStatus.WMajorVersion,
 		MinorVersion:   pStatus.WMinorVersion,
@@ -124,6 +126,13 @@ func (v *IOPCEventServer) GetStatus() (*EventServerStatus, error) {
 // /* [out] */ DWORD *pdwRevisedBufferTime,
 // /* [out] */ DWORD *pdwRevisedMaxSize);
 func (v *IOPCEventServer) CreateEventSubscription(active bool, bufferTime, maxSize uint32, clientSubscriptionHandle uint32, riid *windows.GUID) (unknown *com.IUnknown, revisedBufferTime, revisedMaxSize uint32, err error) {
+	unknown, revisedBufferTime, revisedMaxSize, _, err = v.CreateEventSubscriptionHRESULT(active, bufferTime, maxSize, clientSubscriptionHandle, riid)
+	return
+}
+
+// CreateEventSubscriptionHRESULT is CreateEventSubscription also returning the HRESULT,
+// so success codes such as OPC_S_INVALIDBUFFERTIME reach the caller
+func (v *IOPCEventServer) CreateEventSubscriptionHRESULT(active bool, bufferTime, maxSize uint32, clientSubscriptionHandle uint32, riid *windows.GUID) (unknown *com.IUnknown, revisedBufferTime, revisedMaxSize uint32, hr uint32, err error) {
 	r0, _, _ := syscall.SyscallN(
 		v.Vtbl().CreateEventSubscription,
 		uintptr(unsafe.Pointer(v.IUnknown)),
@@ -136,6 +145,7 @@ func (v *IOPCEventServer) CreateEventSubscription(active bool, bufferTime, maxSi
 		uintptr(unsafe.Pointer(&revisedBufferTime)),
 		uintptr(unsafe.Pointer(&revisedMaxSize)),
 	)
+	hr = uint32(r0)
 	if int32(r0) < 0 {
 		err = syscall.Errno(r0)
 	}
@@ -477,8 +487,11 @@ type ConditionState struct {
 	SCSeverities       []uint32
 	SCDescriptions     []string
 	NumEventAttrs      uint32
-	EventAttributes    []com.VARIANT
-	Errors             []int32
+	// EventAttributes are copies of the returned VARIANTs, the caller owns them and clears them with VARIANT.Clear
+	EventAttributes []com.VARIANT
+	// EventAttributeValues are the values of EventAttributes
+	EventAttributeValues []interface{}
+	Errors               []int32
 }
 
 // virtual HRESULT STDMETHODCALLTYPE GetConditionState(
@@ -515,7 +528,20 @@ func (v *IOPCEventServer) GetConditionState(source, conditionName string, attrib
 		err = syscall.Errno(r0)
 		return
 	}
-	defer com.CoTaskMemFree(unsafe.Pointer(pConditionState))
+	defer func() {
+		com.CoTaskMemFree(unsafe.Pointer(pConditionState.SzActiveSubCondition))
+		com.CoTaskMemFree(unsafe.Pointer(pConditionState.SzASCDefinition))
+		com.CoTaskMemFree(unsafe.Pointer(pConditionState.SzASCDescription))
+		com.CoTaskMemFree(unsafe.Pointer(pConditionState.SzAcknowledgerID))
+		com.CoTaskMemFree(unsafe.Pointer(pConditionState.SzComment))
+		com.CoTaskMemFree(pConditionState.PszSCNames)
+		com.CoTaskMemFree(pConditionState.PszSCDefinitions)
+		com.CoTaskMemFree(pConditionState.PdwSCSeverities)
+		com.CoTaskMemFree(pConditionState.PszSCDescriptions)
+		com.CoTaskMemFree(pConditionState.PEventAttributes)
+		com.CoTaskMemFree(pConditionState.PErrors)
+		com.CoTaskMemFree(unsafe.Pointer(pConditionState))
+	}()
 	conditionState = &ConditionState{
 		State:              pConditionState.WState,
 		Reserved1:          pConditionState.WReserved1,
@@ -525,10 +551,10 @@ func (v *IOPCEventServer) GetConditionState(source, conditionName string, attrib
 		ASCDescription:     windows.UTF16PtrToString(pConditionState.SzASCDescription),
 		Quality:            pConditionState.WQuality,
 		Reserved2:          pConditionState.WReserved2,
-		LastAckTime:        time.Unix(0, pConditionState.FtLastAckTime.Nanoseconds()),
-		SubCondLastActive:  time.Unix(0, pConditionState.FtSubCondLastActive.Nanoseconds()),
-		CondLastActive:     time.Unix(0, pConditionState.FtCondLastActive.Nanoseconds()),
-		CondLastInactive:   time.Unix(0, pConditionState.FtCondLastInactive.Nanoseconds()),
+		LastAckTime:        FiletimeToTime(pConditionState.FtLastAckTime),
+		SubCondLastActive:  FiletimeToTime(pConditionState.FtSubCondLastActive),
+		CondLastActive:     FiletimeToTime(pConditionState.FtCondLastActive),
+		CondLastInactive:   FiletimeToTime(pConditionState.FtCondLastInactive),
 		AcknowledgerID:     windows.UTF16PtrToString(pConditionState.SzAcknowledgerID),
 		Comment:            windows.UTF16PtrToString(pConditionState.SzComment),
 		NumSCs:             pConditionState.DwNumSCs,
@@ -551,12 +577,13 @@ func (v *IOPCEventServer) GetConditionState(source, conditionName string, attrib
 		com.CoTaskMemFree(unsafe.Pointer(pwstr))
 	}
 	conditionState.EventAttributes = make([]com.VARIANT, conditionState.NumEventAttrs)
+	conditionState.EventAttributeValues = make([]interface{}, conditionState.NumEventAttrs)
 	conditionState.Errors = make([]int32, conditionState.NumEventAttrs)
 	for i := 0; i < int(conditionState.NumEventAttrs); i++ {
 		variant := *(*com.VARIANT)(unsafe.Pointer(uintptr(pConditionState.PEventAttributes) + uintptr(i)*unsafe.Sizeof(com.VARIANT{})))
-		errNo := *(*int32)(unsafe.Pointer(uintptr(pConditionState.PErrors) + uintptr(i)*4))
 		conditionState.EventAttributes[i] = variant
-		conditionState.Errors[i] = int32(errNo)
+		conditionState.EventAttributeValues[i] = variant.Value()
+		conditionState.Errors[i] = *(*int32)(unsafe.Pointer(uintptr(pConditionState.PErrors) + uintptr(i)*4))
 	}
 	return
 }
@@ -568,8 +595,13 @@ func (v *IOPCEventServer) EnableConditionByArea(areas []string) (err error) {
 	var pdwNumAreas uint32
 	var ppszAreas unsafe.Pointer
 	if len(areas) > 0 {
+		var pAreas []*uint16
+		pAreas, err = UTF16PtrArray(areas)
+		if err != nil {
+			return
+		}
 		pdwNumAreas = uint32(len(areas))
-		ppszAreas = unsafe.Pointer(&areas[0])
+		ppszAreas = unsafe.Pointer(&pAreas[0])
 	}
 	r0, _, _ := syscall.SyscallN(
 		v.Vtbl().EnableConditionByArea,
@@ -590,8 +622,13 @@ func (v *IOPCEventServer) EnableConditionBySource(sources []string) (err error)
 	var pdwNumSources uint32
 	var ppszSources unsafe.Pointer
 	if len(sources) > 0 {
+		var pSources []*uint16
+		pSources, err = UTF16PtrArray(sources)
+		if err != nil {
+			return
+		}
 		pdwNumSources = uint32(len(sources))
-		ppszSources = unsafe.Pointer(&sources[0])
+		ppszSources = unsafe.Pointer(&pSources[0])
 	}
 	r0, _, _ := syscall.SyscallN(
 		v.Vtbl().EnableConditionBySource,
@@ -612,8 +649,13 @@ func (v *IOPCEventServer) DisableConditionByArea(areas []string) (err error) {
 	var pdwNumAreas uint32
 	var ppszAreas unsafe.Pointer
 	if len(areas) > 0 {
+		var pAreas []*uint16
+		pAreas, err = UTF16PtrArray(areas)
+		if err != nil {
+			return
+		}
 		pdwNumAreas = uint32(len(areas))
-		ppszAreas = unsafe.Pointer(&areas[0])
+		ppszAreas = unsafe.Pointer(&pAreas[0])
 	}
 	r0, _, _ := syscall.SyscallN(
 		v.Vtbl().DisableConditionByArea,
@@ -634,8 +676,13 @@ func (v *IOPCEventServer) DisableConditionBySource(sources []string) (err error)
 	var pdwNumSources uint32
 	var ppszSources unsafe.Pointer
 	if len(sources) > 0 {
+		var pSources []*uint16
+		pSources, err = UTF16PtrArray(sources)
+		if err != nil {
+			return
+		}
 		pdwNumSources = uint32(len(sources))
-		ppszSources = unsafe.Pointer(&sources[0])
+		ppszSources = unsafe.Pointer(&pSources[0])
 	}
 	r0, _, _ := syscall.SyscallN(
 		v.Vtbl().DisableConditionBySource,
@@ -659,26 +706,48 @@ func (v *IOPCEventServer) DisableConditionBySource(sources []string) (err error)
 // /* [size_is][in] */ DWORD *pdwCookie,
 // /* [size_is][size_is][out] */ HRESULT **ppErrors) = 0;
 func (v *IOPCEventServer) AckCondition(acknowledgerID, comment string, sources, conditionNames []string, activeTimes []time.Time, cookies []uint32) (errors []int32, err error) {
-	var pdwCount uint32
-	var pszSource, pszConditionName, pftActiveTime, pdwCookie unsafe.Pointer
-	if len(sources) > 0 {
-		pdwCount = uint32(len(sources))
-		pszSource = unsafe.Pointer(&sources[0])
-		pszConditionName = unsafe.Pointer(&conditionNames[0])
-		pftActiveTime = unsafe.Pointer(&activeTimes[0])
-		pdwCookie = unsafe.Pointer(&cookies[0])
+	count := len(sources)
+	if len(conditionNames) != count || len(activeTimes) != count || len(cookies) != count {
+		err = syscall.Errno(E_INVALIDARG)
+		return
+	}
+	if count == 0 {
+		return
+	}
+	var pAcknowledgerID, pComment *uint16
+	pAcknowledgerID, err = syscall.UTF16PtrFromString(acknowledgerID)
+	if err != nil {
+		return
+	}
+	pComment, err = syscall.UTF16PtrFromString(comment)
+	if err != nil {
+		return
+	}
+	pSources := make([]*uint16, count)
+	pConditionNames := make([]*uint16, count)
+	ftActiveTimes := make([]windows.Filetime, count)
+	for i := 0; i < count; i++ {
+		pSources[i], err = syscall.UTF16PtrFromString(sources[i])
+		if err != nil {
+			return
+		}
+		pConditionNames[i], err = syscall.UTF16PtrFromString(conditionNames[i])
+		if err != nil {
+			return
+		}
+		ftActiveTimes[i] = TimeToFiletime(activeTimes[i])
 	}
 	var ppErrors unsafe.Pointer
 	r0, _, _ := syscall.SyscallN(
 		v.Vtbl().AckCondition,
 		uintptr(unsafe.Pointer(v.IUnknown)),
-		uintptr(pdwCount),
-		uintptr(unsafe.Pointer(syscall.StringToUTF16Ptr(acknowledgerID))),
-		uintptr(unsafe.Pointer(syscall.StringToUTF16Ptr(comment))),
-		uintptr(pszSource),
-		uintptr(pszConditionName),
-		uintptr(pftActiveTime),
-		uintptr(pdwCookie),
+		uintptr(count),
+		uintptr(unsafe.Pointer(pAcknowledgerID)),
+		uintptr(unsafe.Pointer(pComment)),
+		uintptr(unsafe.Pointer(&pSources[0])),
+		uintptr(unsafe.Pointer(&pConditionNames[0])),
+		uintptr(unsafe.Pointer(&ftActiveTimes[0])),
+		uintptr(unsafe.Pointer(&cookies[0])),
 		uintptr(unsafe.Pointer(&ppErrors)),
 	)
 	if int32(r0) < 0 {
@@ -686,12 +755,9 @@ func (v *IOPCEventServer) AckCondition(acknowledgerID, comment string, sources,
 		return
 	}
 	defer com.CoTaskMemFree(ppErrors)
-	errors = make([]int32, pdwCount)
-	for i := 0; i < int(pdwCount); i++ {
-		errNo := *(*int32)(unsafe.Pointer(uintptr(ppErrors) + uintptr(i)*4))
-		if errNo < 0 {
-			errors[i] = int32(errNo)
-		}
+	errors = make([]int32, count)
+	for i := 0; i < count; i++ {
+		errors[i] = *(*int32)(unsafe.Pointer(uintptr(ppErrors) + uintptr(i)*4))
 	}
 	return
 }
@@ -0,0 +1,155 @@
+//go:build windows
+
+package aecom
+
+import (
+	"syscall"
+	"unsafe"
+
+	"github.com/huskar-t/opcda/com"
+	"golang.org/x/sys/windows"
+)
+
+// 71BBE88E-9564-4bcd-BCFC-71C558D94F2D
+var IID_IOPCEventServer2 = windows.GUID{
+	Data1: 0x71BBE88E,
+	Data2: 0x9564,
+	Data3: 0x4BCD,
+	Data4: [8]byte{0xBC, 0xFC, 0x71, 0xC5, 0x58, 0xD9, 0x4F, 0x2D},
+}
+
+type IOPCEventServer2 struct {
+	*com.IUnknown
+}
+
+type IOPCEventServer2Vtbl struct {
+	IOPCEventServerVtbl
+	EnableConditionByArea2    uintptr
+	EnableConditionBySource2  uintptr
+	DisableConditionByArea2   uintptr
+	DisableConditionBySource2 uintptr
+	GetEnableStateByArea      uintptr
+	GetEnableStateBySource    uintptr
+}
+
+func (v *IOPCEventServer2) Vtbl() *IOPCEventServer2Vtbl {
+	return (*IOPCEventServer2Vtbl)(unsafe.Pointer(v.IUnknown.LpVtbl))
+}
+
+// virtual HRESULT STDMETHODCALLTYPE EnableConditionByArea2(
+// /* [in] */ DWORD dwNumAreas,
+// /* [size_is][string][in] */ LPWSTR *pszAreas,
+// /* [size_is][size_is][out] */ HRESULT **ppErrors) = 0;
+func (v *IOPCEventServer2) EnableConditionByArea2(areas []string) (errors []int32, err error) {
+	return v.changeConditionState(v.Vtbl().EnableConditionByArea2, areas)
+}
+
+// virtual HRESULT STDMETHODCALLTYPE EnableConditionBySource2(
+// /* [in] */ DWORD dwNumSources,
+// /* [size_is][string][in] */ LPWSTR *pszSources,
+// /* [size_is][size_is][out] */ HRESULT **ppErrors) = 0;
+func (v *IOPCEventServer2) EnableConditionBySource2(sources []string) (errors []int32, err error) {
+	return v.changeConditionState(v.Vtbl().EnableConditionBySource2, sources)
+}
+
+// virtual HRESULT STDMETHODCALLTYPE DisableConditionByArea2(
+// /* [in] */ DWORD dwNumAreas,
+// /* [size_is][string][in] */ LPWSTR *pszAreas,
+// /* [size_is][size_is][out] */ HRESULT **ppErrors) = 0;
+func (v *IOPCEventServer2) DisableConditionByArea2(areas []string) (errors []int32, err error) {
+	return v.changeConditionState(v.Vtbl().DisableConditionByArea2, areas)
+}
+
+// virtual HRESULT STDMETHODCALLTYPE DisableConditionBySource2(
+// /* [in] */ DWORD dwNumSources,
+// /* [size_is][string][in] */ LPWSTR *pszSources,
+// /* [size_is][size_is][out] */ HRESULT **ppErrors) = 0;
+func (v *IOPCEventServer2) DisableConditionBySource2(sources []string) (errors []int32, err error) {
+	return v.changeConditionState(v.Vtbl().DisableConditionBySource2, sources)
+}
+
+func (v *IOPCEventServer2) changeConditionState(method uintptr, names []string) (errors []int32, err error) {
+	if len(names) == 0 {
+		return
+	}
+	pNames, err := UTF16PtrArray(names)
+	if err != nil {
+		return
+	}
+	var ppErrors unsafe.Pointer
+	r0, _, _ := syscall.SyscallN(
+		method,
+		uintptr(unsafe.Pointer(v.IUnknown)),
+		uintptr(len(names)),
+		uintptr(unsafe.Pointer(&pNames[0])),
+		uintptr(unsafe.Pointer(&ppErrors)),
+	)
+	if int32(r0) < 0 {
+		err = syscall.Errno(r0)
+		return
+	}
+	defer com.CoTaskMemFree(ppErrors)
+	errors = make([]int32, len(names))
+	for i := range names {
+		errors[i] = *(*int32)(unsafe.Pointer(uintptr(ppErrors) + uintptr(i)*4))
+	}
+	return
+}
+
+// virtual HRESULT STDMETHODCALLTYPE GetEnableStateByArea(
+// /* [in] */ DWORD dwNumAreas,
+// /* [size_is][string][in] */ LPWSTR *pszAreas,
+// /* [size_is][size_is][out] */ BOOL **pbEnabled,
+// /* [size_is][size_is][out] */ BOOL **pbEffectivelyEnabled,
+// /* [size_is][size_is][out] */ HRESULT **ppErrors) = 0;
+func (v *IOPCEventServer2) GetEnableStateByArea(areas []string) (enabled, effectivelyEnabled []bool, errors []int32, err error) {
+	return v.getEnableState(v.Vtbl().GetEnableStateByArea, areas)
+}
+
+// virtual HRESULT STDMETHODCALLTYPE GetEnableStateBySource(
+// /* [in] */ DWORD dwNumSources,
+// /* [size_is][string][in] */ LPWSTR *pszSources,
+// /* [size_is][size_is][out] */ BOOL **pbEnabled,
+// /* [size_is][size_is][out] */ BOOL **pbEffectivelyEnabled,
+// /* [size_is][size_is][out] */ HRESULT **ppErrors) = 0;
+func (v *IOPCEventServer2) GetEnableStateBySource(sources []string) (enabled, effectivelyEnabled []bool, errors []int32, err error) {
+	return v.getEnableState(v.Vtbl().GetEnableStateBySource, sources)
+}
+
+func (v *IOPCEventServer2) getEnableState(method uintptr, names []string) (enabled, effectivelyEnabled []bool, errors []int32, err error) {
+	if len(names) == 0 {
+		return
+	}
+	pNames, err := UTF16PtrArray(names)
+	if err != nil {
+		return
+	}
+	var pbEnabled, pbEffectivelyEnabled, ppErrors unsafe.Pointer
+	r0, _, _ := syscall.SyscallN(
+		method,
+		uintptr(unsafe.Pointer(v.IUnknown)),
+		uintptr(len(names)),
+		uintptr(unsafe.Pointer(&pNames[0])),
+		uintptr(unsafe.Pointer(&pbEnabled)),
+		uintptr(unsafe.Pointer(&pbEffectivelyEnabled)),
+		uintptr(unsafe.Pointer(&ppErrors)),
+	)
+	if int32(r0) < 0 {
+		err = syscall.Errno(r0)
+		return
+	}
+	defer func() {
+		com.CoTaskMemFree(pbEnabled)
+		com.CoTaskMemFree(pbEffectivelyEnabled)
+		com.CoTaskMemFree(ppErrors)
+	}()
+	enabled = make([]bool, len(names))
+	effectivelyEnabled = make([]bool, len(names))
+	errors = make([]int32, len(names))
+	for i := range names {
+		enabled[i] = *(*int32)(unsafe.Pointer(uintptr(pbEnabled) + uintptr(i)*4)) != 0
+		effectivelyEnabled[i] = *(*int32)(unsafe.Pointer(uintptr(pbEffectivelyEnabled) + uintptr(i)*4)) != 0
+		errors[i] = *(*int32)(unsafe.Pointer(uintptr(ppErrors) + uintptr(i)*4))
+	}
+	return
+}
@@ -1,3 +1,5 @@
+//go:build windows
+
 package aecom
 
 import (
@@ -79,7 +81,7 @@ func (v *IOPCEventSubscriptionMgt) SetFilter(eventType uint32, eventCategories [
 		uintptr(ppAreaList),
 		uintptr(len(sourceList)),
 		uintptr(ppSourceList))
-	if r0 != 0 {
+	if int32(r0) < 0 {
 		err = syscall.Errno(r0)
 	}
 	return
@@ -112,7 +114,7 @@ func (v *IOPCEventSubscriptionMgt) GetFilter() (eventType uint32, eventCategorie
 		uintptr(unsafe.Pointer(&pNumSources)),
 		uintptr(unsafe.Pointer(&ppSourceList)),
 	)
-	if r0 != 0 {
+	if int32(r0) < 0 {
 		err = syscall.Errno(r0)
 		return
 	}
@@ -151,7 +153,7 @@ func (v *IOPCEventSubscriptionMgt) SelectReturnedAttributes(eventCategory uint32
 		uintptr(len(attributeIDs)),
 		uintptr(pAttributeIDs),
 	)
-	if r0 != 0 {
+	if int32(r0) < 0 {
 		err = syscall.Errno(r0)
 	}
 	return
@@ -171,7 +173,7 @@ func (v *IOPCEventSubscriptionMgt) GetReturnedAttributes(eventCategory uint32) (
 		uintptr(unsafe.Pointer(&pCount)),
 		uintptr(unsafe.Pointer(&ppAttributeIDs)),
 	)
-	if r0 != 0 {
+	if int32(r0) < 0 {
 		err = syscall.Errno(r0)
 		return
 	}
@@ -191,7 +193,7 @@ func (v *IOPCEventSubscriptionMgt) Refresh(connection uint32) (err error) {
 		uintptr(unsafe.Pointer(v.IUnknown)),
 		uintptr(connection),
 	)
-	if r0 != 0 {
+	if int32(r0) < 0 {
 		err = syscall.Errno(r0)
 	}
 	return
@@ -206,7 +208,7 @@ func (v *IOPCEventSubscriptionMgt) CancelRefresh(connection uint32) (err error)
 		uintptr(unsafe.Pointer(v.IUnknown)),
 		uintptr(connection),
 	)
-	if r0 != 0 {
+	if int32(r0) < 0 {
 		err = syscall.Errno(r0)
 	}
 	return
@@ -227,7 +229,7 @@ func (v *IOPCEventSubscriptionMgt) GetState() (active bool, bufferTime uint32, m
 		uintptr(unsafe.Pointer(&maxSize)),
 		uintptr(unsafe.Pointer(&clientSubscription)),
 	)
-	if r0 != 0 {
+	if int32(r0) < 0 {
 		err = syscall.Errno(r0)
 		return
 	}
@@ -243,6 +245,13 @@ func (v *IOPCEventSubscriptionMgt) GetState() (active bool, bufferTime uint32, m
 // /* [out] */ DWORD *pdwRevisedBufferTime,
 // /* [out] */ DWORD *pdwRevisedMaxSize) = 0;
 func (v *IOPCEventSubscriptionMgt) SetState(active *int32, bufferTime *uint32, maxSize *uint32, clientSubscription uint32) (revisedBufferTime uint32, revisedMaxSize uint32, err error) {
+	revisedBufferTime, revisedMaxSize, _, err = v.SetStateHRESULT(active, bufferTime, maxSize, clientSubscription)
+	return
+}
+
+// SetStateHRESULT is SetState also returning the HRESULT, so success codes
+// such as OPC_S_INVALIDBUFFERTIME and OPC_S_INVALIDMAXSIZE reach the caller
+func (v *IOPCEventSubscriptionMgt) SetStateHRESULT(active *int32, bufferTime *uint32, maxSize *uint32, clientSubscription uint32) (revisedBufferTime uint32, revisedMaxSize uint32, hr uint32, err error) {
 	r0, _, _ := syscall.SyscallN(
 		v.VTable().SetState,
 		uintptr(unsafe.Pointer(v.IUnknown)),
@@ -253,7 +262,8 @@ func (v *IOPCEventSubscriptionMgt) SetState(active *int32, bufferTime *uint32, m
 		uintptr(unsafe.Pointer(&revisedBufferTime)),
 		uintptr(unsafe.Pointer(&revisedMaxSize)),
 	)
-	if r0 != 0 {
+	hr = uint32(r0)
+	if int32(r0) < 0 {
 		err = syscall.Errno(r0)
 	}
 	return
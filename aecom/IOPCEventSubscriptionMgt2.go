@@ -0,0 +1,71 @@
+//go:build windows
+
+package aecom
+
+import (
+	"syscall"
+	"unsafe"
+
+	"github.com/huskar-t/opcda/com"
+	"golang.org/x/sys/windows"
+)
+
+// IID_IOPCEventSubscriptionMgt2 94C955DC-3684-4ccb-AFAB-F898CE19AAC3
+var IID_IOPCEventSubscriptionMgt2 = windows.GUID{
+	Data1: 0x94C955DC,
+	Data2: 0x3684,
+	Data3: 0x4CCB,
+	Data4: [8]byte{0xAF, 0xAB, 0xF8, 0x98, 0xCE, 0x19, 0xAA, 0xC3},
+}
+
+type IOPCEventSubscriptionMgt2 struct {
+	*com.IUnknown
+}
+
+type IOPCEventSubscriptionMgt2Vtbl struct {
+	IOPCEventSubscriptionMgtVtbl
+	SetKeepAlive uintptr
+	GetKeepAlive uintptr
+}
+
+func (v *IOPCEventSubscriptionMgt2) VTable() *IOPCEventSubscriptionMgt2Vtbl {
+	return (*IOPCEventSubscriptionMgt2Vtbl)(unsafe.Pointer(v.IUnknown.LpVtbl))
+}
+
+// virtual HRESULT STDMETHODCALLTYPE SetKeepAlive(
+// /* [in] */ DWORD dwKeepAliveTime,
+// /* [out] */ DWORD *pdwRevisedKeepAliveTime) = 0;
+func (v *IOPCEventSubscriptionMgt2) SetKeepAlive(keepAliveTime uint32) (revisedKeepAliveTime uint32, err error) {
+	revisedKeepAliveTime, _, err = v.SetKeepAliveHRESULT(keepAliveTime)
+	return
+}
+
+// SetKeepAliveHRESULT is SetKeepAlive also returning the HRESULT, so
+// OPC_S_INVALIDKEEPALIVETIME reaches the caller
+func (v *IOPCEventSubscriptionMgt2) SetKeepAliveHRESULT(keepAliveTime uint32) (revisedKeepAliveTime uint32, hr uint32, err error) {
+	r0, _, _ := syscall.SyscallN(
+		v.VTable().SetKeepAlive,
+		uintptr(unsafe.Pointer(v.IUnknown)),
+		uintptr(keepAliveTime),
+		uintptr(unsafe.Pointer(&revisedKeepAliveTime)),
+	)
+	hr = uint32(r0)
+	if int32(r0) < 0 {
+		err = syscall.Errno(r0)
+	}
+	return
+}
+
+// virtual HRESULT STDMETHODCALLTYPE GetKeepAlive(
+// /* [out] */ DWORD *pdwKeepAliveTime) = 0;
+func (v *IOPCEventSubscriptionMgt2) GetKeepAlive() (keepAliveTime uint32, err error) {
+	r0, _, _ := syscall.SyscallN(
+		v.VTable().GetKeepAlive,
+		uintptr(unsafe.Pointer(v.IUnknown)),
+		uintptr(unsafe.Pointer(&keepAliveTime)),
+	)
+	if int32(r0) < 0 {
+		err = syscall.Errno(r0)
+	}
+	return
+}
@@ -0,0 +1,25 @@
+//go:build windows
+
+package aecom
+
+import (
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// TimeToFiletime converts t to a FILETIME, the zero time maps to a zero FILETIME
+func TimeToFiletime(t time.Time) windows.Filetime {
+	if t.IsZero() {
+		return windows.Filetime{}
+	}
+	return windows.NsecToFiletime(t.UnixNano())
+}
+
+// FiletimeToTime converts ft to a time.Time, a zero FILETIME maps to the zero time
+func FiletimeToTime(ft windows.Filetime) time.Time {
+	if ft.HighDateTime == 0 && ft.LowDateTime == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ft.Nanoseconds())
+}
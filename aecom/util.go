@@ -0,0 +1,20 @@
+//go:build windows
+
+package aecom
+
+import "syscall"
+
+// E_INVALIDARG One or more arguments are invalid
+const E_INVALIDARG = 0x80070057
+
+// UTF16PtrArray converts strs to an array of LPWSTR
+func UTF16PtrArray(strs []string) (ptrs []*uint16, err error) {
+	ptrs = make([]*uint16, len(strs))
+	for i, str := range strs {
+		ptrs[i], err = syscall.UTF16PtrFromString(str)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ptrs, nil
+}
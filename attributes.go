@@ -0,0 +1,284 @@
+package opcae
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// VARTYPEs of event attributes, see EventAttribute.Type
+const (
+	vtI2    = 2
+	vtI4    = 3
+	vtR4    = 4
+	vtR8    = 5
+	vtDate  = 7
+	vtBSTR  = 8
+	vtBool  = 11
+	vtI1    = 16
+	vtUI1   = 17
+	vtUI2   = 18
+	vtUI4   = 19
+	vtI8    = 20
+	vtUI8   = 21
+	vtInt   = 22
+	vtUInt  = 23
+	vtArray = 0x2000
+)
+
+// Attribute returns the value of the returned attribute with the description name, it needs the attribute
+// schema of the subscription, see SelectReturnedAttributesByName
+func (e *OnEventStruct) Attribute(name string) (interface{}, bool) {
+	v, ok := e.NamedAttributes[name]
+	return v, ok
+}
+
+// AttributeByID returns the value of the returned attribute with the ID id
+func (e *OnEventStruct) AttributeByID(id uint32) (interface{}, bool) {
+	for i, attributeID := range e.AttributeIDs {
+		if attributeID == id && i < len(e.Attributes) {
+			return e.Attributes[i], true
+		}
+	}
+	return nil, false
+}
+
+// AttributeSchema caches the attributes a subscription returns per event category, it resolves attribute
+// descriptions to IDs and annotates events with NamedAttributes and AttributeIDs.
+// It is used by implementations of EventSubscription, see WithAttributeSchema.
+type AttributeSchema struct {
+	query func(eventCategoryID uint32) ([]*EventAttribute, error)
+
+	lock     sync.RWMutex
+	returned map[uint32][]*EventAttribute
+}
+
+// NewAttributeSchema returns an empty schema, query is QueryEventAttributes of the server
+func NewAttributeSchema(query func(eventCategoryID uint32) ([]*EventAttribute, error)) *AttributeSchema {
+	return &AttributeSchema{query: query, returned: make(map[uint32][]*EventAttribute)}
+}
+
+// Resolve returns the IDs of the attributes of the category with the descriptions names
+func (s *AttributeSchema) Resolve(eventCategory uint32, names []string) ([]uint32, error) {
+	attributes, err := s.query(eventCategory)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint32, len(names))
+	for i, name := range names {
+		attribute := findAttribute(attributes, func(a *EventAttribute) bool { return a.Description == name })
+		if attribute == nil {
+			return nil, NewOPCError("SelectReturnedAttributes", name, E_INVALIDARG)
+		}
+		ids[i] = attribute.ID
+	}
+	return ids, nil
+}
+
+// Select records that the category returns the attributes ids in this order, the descriptions and types are
+// queried again on every call
+func (s *AttributeSchema) Select(eventCategory uint32, ids []uint32) error {
+	returned, err := s.Lookup(eventCategory, ids)
+	if err != nil {
+		return err
+	}
+	s.Set(eventCategory, returned)
+	return nil
+}
+
+// Lookup queries the descriptions and types of the attributes ids of the category without recording them.
+// IDs the server does not describe keep their position without a description. Subscriptions look the
+// attributes up before they send a selection, so a failed query leaves the server and the schema unchanged.
+func (s *AttributeSchema) Lookup(eventCategory uint32, ids []uint32) ([]*EventAttribute, error) {
+	attributes, err := s.query(eventCategory)
+	if err != nil {
+		return nil, err
+	}
+	returned := make([]*EventAttribute, len(ids))
+	for i, id := range ids {
+		returned[i] = findAttribute(attributes, func(a *EventAttribute) bool { return a.ID == id })
+		if returned[i] == nil {
+			returned[i] = &EventAttribute{ID: id}
+		}
+	}
+	return returned, nil
+}
+
+// Set records that the category returns the attributes in this order, see Lookup
+func (s *AttributeSchema) Set(eventCategory uint32, attributes []*EventAttribute) {
+	s.lock.Lock()
+	s.returned[eventCategory] = attributes
+	s.lock.Unlock()
+}
+
+// Returned returns the attributes the category returns, nil when they were not selected through the schema
+func (s *AttributeSchema) Returned(eventCategory uint32) []*EventAttribute {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.returned[eventCategory]
+}
+
+// Annotate converts the attribute values of the events to the types of their VARTYPE and sets
+// NamedAttributes and AttributeIDs, events of categories without schema are left unchanged
+func (s *AttributeSchema) Annotate(events []*OnEventStruct) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	for _, event := range events {
+		returned, ok := s.returned[event.Category]
+		if !ok {
+			continue
+		}
+		event.AttributeIDs = make([]uint32, 0, len(returned))
+		event.NamedAttributes = make(map[string]interface{}, len(returned))
+		for i, attribute := range returned {
+			if i >= len(event.Attributes) {
+				break
+			}
+			event.Attributes[i] = ConvertAttribute(event.Attributes[i], attribute.Type)
+			event.AttributeIDs = append(event.AttributeIDs, attribute.ID)
+			if attribute.Description != "" {
+				event.NamedAttributes[attribute.Description] = event.Attributes[i]
+			}
+		}
+	}
+}
+
+func findAttribute(attributes []*EventAttribute, match func(*EventAttribute) bool) *EventAttribute {
+	for _, attribute := range attributes {
+		if match(attribute) {
+			return attribute
+		}
+	}
+	return nil
+}
+
+// ConvertAttribute converts value to the Go type of the VARTYPE vt as returned by VARIANT.Value, e.g. int32
+// for VT_I4. Values that cannot be converted without loss and arrays are returned unchanged.
+func ConvertAttribute(value interface{}, vt uint16) interface{} {
+	if value == nil || vt&vtArray != 0 {
+		return value
+	}
+	switch vt {
+	case vtBSTR:
+		if s, ok := value.(fmt.Stringer); ok {
+			return s.String()
+		}
+		return value
+	case vtDate:
+		return value
+	case vtBool:
+		if b, ok := value.(bool); ok {
+			return b
+		}
+		if i, ok := toInt64(value); ok {
+			return i != 0
+		}
+		return value
+	case vtR4:
+		if f, ok := toFloat64(value); ok {
+			return float32(f)
+		}
+	case vtR8:
+		if f, ok := toFloat64(value); ok {
+			return f
+		}
+	}
+	i, ok := toInt64(value)
+	if !ok {
+		return value
+	}
+	switch vt {
+	case vtI1:
+		if i >= math.MinInt8 && i <= math.MaxInt8 {
+			return int8(i)
+		}
+	case vtI2:
+		if i >= math.MinInt16 && i <= math.MaxInt16 {
+			return int16(i)
+		}
+	case vtI4:
+		if i >= math.MinInt32 && i <= math.MaxInt32 {
+			return int32(i)
+		}
+	case vtI8:
+		return i
+	case vtInt:
+		if i >= math.MinInt && i <= math.MaxInt {
+			return int(i)
+		}
+	case vtUI1:
+		if i >= 0 && i <= math.MaxUint8 {
+			return uint8(i)
+		}
+	case vtUI2:
+		if i >= 0 && i <= math.MaxUint16 {
+			return uint16(i)
+		}
+	case vtUI4:
+		if i >= 0 && i <= math.MaxUint32 {
+			return uint32(i)
+		}
+	case vtUI8:
+		if i >= 0 {
+			return uint64(i)
+		}
+	case vtUInt:
+		if i >= 0 {
+			return uint(i)
+		}
+	}
+	return value
+}
+
+// toInt64 converts integers and floats without fraction
+func toInt64(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint:
+		return int64(v), v <= math.MaxInt64
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return int64(v), v <= math.MaxInt64
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case float32:
+		return toInt64(float64(v))
+	case float64:
+		if v != math.Trunc(v) || v < math.MinInt64 || v >= math.MaxInt64 {
+			return 0, false
+		}
+		return int64(v), true
+	}
+	return 0, false
+}
+
+func toFloat64(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case time.Time, string, bool:
+		return 0, false
+	}
+	i, ok := toInt64(value)
+	return float64(i), ok
+}
@@ -0,0 +1,101 @@
+package opcae
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertAttribute(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		value interface{}
+		vt    uint16
+		want  interface{}
+	}{
+		{int32(5), vtI1, int8(5)},
+		{int32(300), vtI1, int32(300)},
+		{int64(-3), vtI2, int16(-3)},
+		{uint8(7), vtI4, int32(7)},
+		{int32(7), vtI8, int64(7)},
+		{int32(7), vtInt, 7},
+		{int32(200), vtUI1, uint8(200)},
+		{int32(-1), vtUI2, int32(-1)},
+		{int32(65536), vtUI4, uint32(65536)},
+		{int64(1), vtUI8, uint64(1)},
+		{int64(1), vtUInt, uint(1)},
+		{uint64(math.MaxUint64), vtI8, uint64(math.MaxUint64)},
+		{2.0, vtI4, int32(2)},
+		{2.5, vtI4, 2.5},
+		{int32(2), vtR8, 2.0},
+		{1.5, vtR4, float32(1.5)},
+		{int32(0), vtBool, false},
+		{true, vtBool, true},
+		{true, vtI4, int32(1)},
+		{"text", vtBSTR, "text"},
+		{"text", vtI4, "text"},
+		{now, vtDate, now},
+		{[]int32{1}, vtArray | vtI4, []int32{1}},
+		{nil, vtI4, nil},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, ConvertAttribute(tt.value, tt.vt), "%T %v as %d", tt.value, tt.value, tt.vt)
+	}
+}
+
+func TestAttributeSchema(t *testing.T) {
+	queries := 0
+	attributes := []*EventAttribute{
+		{ID: 1, Description: "CV", Type: vtR8},
+		{ID: 2, Description: "Limit", Type: vtI4},
+	}
+	schema := NewAttributeSchema(func(category uint32) ([]*EventAttribute, error) {
+		queries++
+		if category != 100 {
+			return nil, NewOPCError("QueryEventAttributes", "", E_INVALIDARG)
+		}
+		return attributes, nil
+	})
+
+	ids, err := schema.Resolve(100, []string{"Limit", "CV"})
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{2, 1}, ids)
+	_, err = schema.Resolve(100, []string{"SP"})
+	var opcErr *OPCError
+	require.True(t, errors.As(err, &opcErr))
+	assert.Equal(t, "SP", opcErr.Item)
+	_, err = schema.Resolve(1, []string{"CV"})
+	assert.Error(t, err)
+
+	require.NoError(t, schema.Select(100, []uint32{2, 1, 9}))
+	assert.Len(t, schema.Returned(100), 3)
+	events := []*OnEventStruct{
+		{Category: 100, Attributes: []interface{}{int16(80), int32(85), "x"}},
+		{Category: 1, Attributes: []interface{}{int16(1)}},
+	}
+	schema.Annotate(events)
+	assert.Equal(t, []interface{}{int32(80), 85.0, "x"}, events[0].Attributes)
+	assert.Equal(t, []uint32{2, 1, 9}, events[0].AttributeIDs)
+	assert.Equal(t, map[string]interface{}{"Limit": int32(80), "CV": 85.0}, events[0].NamedAttributes)
+	value, ok := events[0].Attribute("CV")
+	assert.True(t, ok)
+	assert.Equal(t, 85.0, value)
+	value, ok = events[0].AttributeByID(9)
+	assert.True(t, ok)
+	assert.Equal(t, "x", value)
+	assert.Nil(t, events[1].NamedAttributes, "categories without schema are left unchanged")
+	assert.Equal(t, []interface{}{int16(1)}, events[1].Attributes)
+
+	// the descriptions are queried again when the category is selected again
+	attributes[0] = &EventAttribute{ID: 1, Description: "PV", Type: vtR4}
+	before := queries
+	require.NoError(t, schema.Select(100, []uint32{1}))
+	assert.Equal(t, before+1, queries)
+	events = []*OnEventStruct{{Category: 100, Attributes: []interface{}{2.0}}}
+	schema.Annotate(events)
+	assert.Equal(t, map[string]interface{}{"PV": float32(2)}, events[0].NamedAttributes)
+}
@@ -0,0 +1,148 @@
+package opcae
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrBlockingConsumer is returned by Broker.Subscribe for DeliverBlock and DeliverBlockTimeout, a consumer
+// that blocks the broker would stall every other consumer
+var ErrBlockingConsumer = errors.New("opcae: broker consumers need a non-blocking delivery policy")
+
+// ErrBrokerClosed is returned by Broker.Subscribe after the broker was closed or its subscription was released
+var ErrBrokerClosed = errors.New("opcae: broker is closed")
+
+// Broker fans the notifications of one subscription out to any number of consumers.
+// Every consumer has its own receiver, delivery policy, event filter and deduplicator, a full receiver only
+// affects its own consumer. The broker is the only reader of the receiver of the subscription.
+// Consumers share the events of a callback, they must not modify them.
+type Broker struct {
+	sub EventSubscription
+
+	lock      sync.RWMutex
+	consumers map[*Consumer]struct{}
+	closed    bool
+	done      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+}
+
+// NewBroker starts to read the receiver of sub
+func NewBroker(sub EventSubscription) *Broker {
+	b := &Broker{
+		sub:       sub,
+		consumers: make(map[*Consumer]struct{}),
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+func (b *Broker) run() {
+	defer close(b.stopped)
+	defer b.closeConsumers()
+	receiver := b.sub.GetReceiver()
+	for {
+		select {
+		case <-b.done:
+			return
+		case data, ok := <-receiver:
+			if !ok {
+				return
+			}
+			b.lock.RLock()
+			for c := range b.consumers {
+				c.dispatcher.Deliver(data)
+			}
+			b.lock.RUnlock()
+		}
+	}
+}
+
+func (b *Broker) closeConsumers() {
+	b.lock.Lock()
+	consumers := b.consumers
+	b.consumers = make(map[*Consumer]struct{})
+	b.closed = true
+	b.lock.Unlock()
+	for c := range consumers {
+		c.dispatcher.Close()
+	}
+}
+
+// Subscribe registers a consumer with a receiver of bufSize notifications.
+// opts configure the delivery into its receiver like for CreateEventSubscription, the default policy is
+// DeliverDropOldest, blocking policies are rejected with ErrBlockingConsumer.
+func (b *Broker) Subscribe(bufSize uint32, opts ...SubscriptionOption) (*Consumer, error) {
+	o := &subscriptionOptions{policy: DeliverDropOldest}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if o.policy == DeliverBlock || o.policy == DeliverBlockTimeout {
+		return nil, ErrBlockingConsumer
+	}
+	receiver := make(chan *EventSinkOnEventData, bufSize)
+	c := &Consumer{
+		broker:     b,
+		receiver:   receiver,
+		dispatcher: newDispatcher(receiver, o),
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.closed {
+		c.dispatcher.Close()
+		return nil, ErrBrokerClosed
+	}
+	b.consumers[c] = struct{}{}
+	return c, nil
+}
+
+// Len returns the number of consumers
+func (b *Broker) Len() int {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return len(b.consumers)
+}
+
+// Close stops the broker and closes the receivers of all consumers, the subscription is not released.
+// The broker also closes when the receiver of the subscription is closed by Release.
+func (b *Broker) Close() {
+	b.closeOnce.Do(func() {
+		close(b.done)
+	})
+	<-b.stopped
+}
+
+// Consumer is a registration at a Broker
+type Consumer struct {
+	broker     *Broker
+	receiver   chan *EventSinkOnEventData
+	dispatcher *Dispatcher
+}
+
+// GetReceiver returns the channel of the notifications of the consumer, it is closed by Unsubscribe and when
+// the broker closes
+func (c *Consumer) GetReceiver() <-chan *EventSinkOnEventData {
+	return c.receiver
+}
+
+// DeliveryStats returns the counters of the delivery into the receiver of the consumer
+func (c *Consumer) DeliveryStats() DeliveryStats {
+	return c.dispatcher.Stats()
+}
+
+// RefreshAndWait refreshes the subscription of the broker and returns the events of the refresh callbacks.
+// The other consumers receive the refresh callbacks as usual.
+func (c *Consumer) RefreshAndWait(ctx context.Context) ([]*OnEventStruct, error) {
+	return c.dispatcher.RefreshAndWait(ctx, c.broker.sub.Refresh, c.broker.sub.CancelRefresh)
+}
+
+// Unsubscribe removes the consumer and closes its receiver, the subscription of the broker is not affected
+func (c *Consumer) Unsubscribe() {
+	c.broker.lock.Lock()
+	delete(c.broker.consumers, c)
+	c.broker.lock.Unlock()
+	c.dispatcher.Close()
+}
@@ -0,0 +1,6 @@
+//go:build !windows
+
+package opcae
+
+// clsid is the type of ItemID.CLSID, GUID where windows.GUID is not available
+type clsid = GUID
@@ -0,0 +1,196 @@
+package opcae
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrConditionDisabled is returned by Condition.Activate and Condition.Deactivate when the condition is disabled
+var ErrConditionDisabled = errors.New("opcae: condition is disabled")
+
+// Condition models a condition instance of a source with the state machine of the OPC AE 1.10 specification.
+// Every transition returns the change mask of the event notification it causes, an empty mask means the
+// state did not change and no notification is due.
+//
+// A new condition is enabled, inactive and acknowledged. Entering the active state or changing the active
+// sub-condition requires a new acknowledgement, which must quote the active time and cookie of that transition.
+// Disabling a condition returns it to inactive and acknowledged.
+type Condition struct {
+	Source        string
+	Name          string
+	SubConditions []*SubCondition
+
+	Enabled bool
+	Active  bool
+	Acked   bool
+	// SubCondition is the active sub-condition, or the last active one when the condition is inactive
+	SubCondition *SubCondition
+	Quality      uint16
+	Message      string
+	Cookie       uint32
+	// ActiveTime is the time of the transition into the active state or the current sub-condition
+	ActiveTime        time.Time
+	SubCondLastActive time.Time
+	CondLastActive    time.Time
+	CondLastInactive  time.Time
+	LastAckTime       time.Time
+	AcknowledgerID    string
+	Comment           string
+}
+
+// NewCondition returns an enabled, inactive and acknowledged condition.
+// subConditions must not be empty, single state conditions have one sub-condition named after the condition.
+func NewCondition(source, name string, subConditions []*SubCondition) *Condition {
+	return &Condition{
+		Source:        source,
+		Name:          name,
+		SubConditions: subConditions,
+		Enabled:       true,
+		Acked:         true,
+		SubCondition:  subConditions[0],
+		Quality:       OPC_QUALITY_GOOD,
+	}
+}
+
+// State returns wNewState of the condition
+func (c *Condition) State() State {
+	var state State
+	if c.Enabled {
+		state |= OPC_CONDITION_ENABLED
+	}
+	if c.Active {
+		state |= OPC_CONDITION_ACTIVE
+	}
+	if c.Acked {
+		state |= OPC_CONDITION_ACKED
+	}
+	return state
+}
+
+// Severity returns the severity of the active or last active sub-condition
+func (c *Condition) Severity() uint32 {
+	return c.SubCondition.Severity
+}
+
+func (c *Condition) subCondition(name string) *SubCondition {
+	if name == "" {
+		return c.SubConditions[0]
+	}
+	for _, sc := range c.SubConditions {
+		if sc.Name == name {
+			return sc
+		}
+	}
+	return nil
+}
+
+func (c *Condition) item() string {
+	return c.Source + "/" + c.Name
+}
+
+// Activate moves the condition into the sub-condition, an empty name selects the first sub-condition.
+// cookie identifies the transition for the acknowledgement and is only used when the transition requires one.
+// Activating the active sub-condition again only updates the message.
+func (c *Condition) Activate(subCondition, message string, now time.Time, cookie uint32) (ChangeMask, error) {
+	if !c.Enabled {
+		return 0, ErrConditionDisabled
+	}
+	sc := c.subCondition(subCondition)
+	if sc == nil {
+		return 0, NewOPCError("Activate", c.item()+"/"+subCondition, E_INVALIDARG)
+	}
+	var mask ChangeMask
+	if c.Active && c.SubCondition == sc {
+		return c.setMessage(message), nil
+	}
+	if !c.Active {
+		c.Active = true
+		c.CondLastActive = now
+		mask |= OPC_CHANGE_ACTIVE_STATE
+	}
+	if c.SubCondition != sc {
+		if c.SubCondition.Severity != sc.Severity {
+			mask |= OPC_CHANGE_SEVERITY
+		}
+		c.SubCondition = sc
+		mask |= OPC_CHANGE_SUBCONDITION
+	}
+	if c.Acked {
+		c.Acked = false
+		mask |= OPC_CHANGE_ACK_STATE
+	}
+	mask |= c.setMessage(message)
+	c.ActiveTime = now
+	c.SubCondLastActive = now
+	c.Cookie = cookie
+	return mask, nil
+}
+
+// Deactivate returns the condition to normal, the acknowledgement state is not changed.
+// Deactivating an inactive condition changes nothing.
+func (c *Condition) Deactivate(message string, now time.Time) (ChangeMask, error) {
+	if !c.Enabled {
+		return 0, ErrConditionDisabled
+	}
+	if !c.Active {
+		return 0, nil
+	}
+	c.Active = false
+	c.CondLastInactive = now
+	return OPC_CHANGE_ACTIVE_STATE | c.setMessage(message), nil
+}
+
+// Acknowledge acknowledges the transition identified by activeTime and cookie.
+// It returns ErrAlreadyAcked when the condition needs no acknowledgement and ErrInvalidTime when activeTime or
+// cookie do not identify the latest transition, both as *OPCError with the condition as item.
+func (c *Condition) Acknowledge(acknowledgerID, comment string, activeTime time.Time, cookie uint32, now time.Time) (ChangeMask, error) {
+	if c.Acked {
+		return 0, NewOPCError("Acknowledge", c.item(), OPC_S_ALREADYACKED)
+	}
+	if !activeTime.Equal(c.ActiveTime) || cookie != c.Cookie {
+		return 0, NewOPCError("Acknowledge", c.item(), OPC_E_INVALIDTIME)
+	}
+	c.Acked = true
+	c.LastAckTime = now
+	c.AcknowledgerID = acknowledgerID
+	c.Comment = comment
+	return OPC_CHANGE_ACK_STATE, nil
+}
+
+// SetEnabled enables or disables the condition, a disabled condition is inactive and acknowledged
+func (c *Condition) SetEnabled(enabled bool, now time.Time) ChangeMask {
+	if c.Enabled == enabled {
+		return 0
+	}
+	mask := OPC_CHANGE_ENABLE_STATE
+	c.Enabled = enabled
+	if enabled {
+		return mask
+	}
+	if c.Active {
+		c.Active = false
+		c.CondLastInactive = now
+		mask |= OPC_CHANGE_ACTIVE_STATE
+	}
+	if !c.Acked {
+		c.Acked = true
+		mask |= OPC_CHANGE_ACK_STATE
+	}
+	return mask
+}
+
+func (c *Condition) SetQuality(quality uint16) ChangeMask {
+	if c.Quality == quality {
+		return 0
+	}
+	c.Quality = quality
+	return OPC_CHANGE_QUALITY
+}
+
+func (c *Condition) setMessage(message string) ChangeMask {
+	if c.Message == message {
+		return 0
+	}
+	c.Message = message
+	return OPC_CHANGE_MESSAGE
+}
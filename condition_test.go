@@ -0,0 +1,144 @@
+package opcae
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestCondition() *Condition {
+	return NewCondition("Tank1", "LEVEL", []*SubCondition{
+		{Name: "HI", Definition: "CV > 80", Severity: 600},
+		{Name: "HIHI", Definition: "CV > 95", Severity: 800},
+		{Name: "HI2", Definition: "CV > 85", Severity: 600},
+	})
+}
+
+func TestNewCondition(t *testing.T) {
+	c := newTestCondition()
+	assert.Equal(t, OPC_CONDITION_ENABLED|OPC_CONDITION_ACKED, c.State())
+	assert.Equal(t, uint32(600), c.Severity())
+	assert.Equal(t, OPC_QUALITY_GOOD, c.Quality)
+}
+
+func TestCondition_Activate(t *testing.T) {
+	c := newTestCondition()
+	now := time.Unix(1000, 0)
+	mask, err := c.Activate("", "high", now, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, OPC_CHANGE_ACTIVE_STATE|OPC_CHANGE_ACK_STATE|OPC_CHANGE_MESSAGE, mask)
+	assert.Equal(t, OPC_CONDITION_ENABLED|OPC_CONDITION_ACTIVE, c.State())
+	assert.Equal(t, now, c.ActiveTime)
+	assert.Equal(t, now, c.CondLastActive)
+	assert.Equal(t, uint32(1), c.Cookie)
+
+	mask, err = c.Activate("HI", "high", now.Add(time.Second), 2)
+	assert.NoError(t, err)
+	assert.Zero(t, mask)
+	assert.Equal(t, uint32(1), c.Cookie)
+
+	mask, err = c.Activate("HI", "still high", now.Add(time.Second), 2)
+	assert.NoError(t, err)
+	assert.Equal(t, OPC_CHANGE_MESSAGE, mask)
+
+	_, err = c.Activate("LO", "", now, 3)
+	assert.True(t, errors.Is(err, NewOPCError("", "", E_INVALIDARG)))
+}
+
+func TestCondition_SubConditionChange(t *testing.T) {
+	c := newTestCondition()
+	now := time.Unix(1000, 0)
+	_, _ = c.Activate("HI", "", now, 1)
+	_, err := c.Acknowledge("operator", "", now, 1, now)
+	assert.NoError(t, err)
+
+	later := now.Add(time.Minute)
+	mask, err := c.Activate("HIHI", "", later, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, OPC_CHANGE_SUBCONDITION|OPC_CHANGE_SEVERITY|OPC_CHANGE_ACK_STATE, mask)
+	assert.False(t, c.Acked)
+	assert.Equal(t, later, c.ActiveTime)
+	assert.Equal(t, now, c.CondLastActive)
+	assert.Equal(t, later, c.SubCondLastActive)
+
+	mask, err = c.Activate("HI2", "", later.Add(time.Minute), 3)
+	assert.NoError(t, err)
+	assert.Equal(t, OPC_CHANGE_SUBCONDITION|OPC_CHANGE_SEVERITY, mask)
+
+	mask, err = c.Activate("HI", "", later.Add(2*time.Minute), 4)
+	assert.NoError(t, err)
+	assert.Equal(t, OPC_CHANGE_SUBCONDITION, mask, "same severity and still unacknowledged")
+}
+
+func TestCondition_Deactivate(t *testing.T) {
+	c := newTestCondition()
+	now := time.Unix(1000, 0)
+	mask, err := c.Deactivate("", now)
+	assert.NoError(t, err)
+	assert.Zero(t, mask)
+
+	_, _ = c.Activate("", "high", now, 1)
+	mask, err = c.Deactivate("normal", now.Add(time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, OPC_CHANGE_ACTIVE_STATE|OPC_CHANGE_MESSAGE, mask)
+	assert.Equal(t, OPC_CONDITION_ENABLED, c.State(), "returning to normal keeps the condition unacknowledged")
+	assert.Equal(t, now.Add(time.Second), c.CondLastInactive)
+
+	mask, err = c.Acknowledge("operator", "done", now, 1, now.Add(2*time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, OPC_CHANGE_ACK_STATE, mask)
+	assert.Equal(t, OPC_CONDITION_ENABLED|OPC_CONDITION_ACKED, c.State())
+}
+
+func TestCondition_Acknowledge(t *testing.T) {
+	c := newTestCondition()
+	now := time.Unix(1000, 0)
+	_, err := c.Acknowledge("operator", "", time.Time{}, 0, now)
+	assert.True(t, errors.Is(err, ErrAlreadyAcked))
+
+	_, _ = c.Activate("", "", now, 7)
+	_, err = c.Acknowledge("operator", "", now.Add(-time.Second), 7, now)
+	assert.True(t, errors.Is(err, ErrInvalidTime))
+	_, err = c.Acknowledge("operator", "", now, 8, now)
+	assert.True(t, errors.Is(err, ErrInvalidTime))
+	var opcErr *OPCError
+	assert.True(t, errors.As(err, &opcErr))
+	assert.Equal(t, "Tank1/LEVEL", opcErr.Item)
+	assert.False(t, c.Acked)
+
+	ackTime := now.Add(time.Second)
+	mask, err := c.Acknowledge("operator", "seen", now, 7, ackTime)
+	assert.NoError(t, err)
+	assert.Equal(t, OPC_CHANGE_ACK_STATE, mask)
+	assert.Equal(t, OPC_CONDITION_ENABLED|OPC_CONDITION_ACTIVE|OPC_CONDITION_ACKED, c.State())
+	assert.Equal(t, ackTime, c.LastAckTime)
+	assert.Equal(t, "operator", c.AcknowledgerID)
+	assert.Equal(t, "seen", c.Comment)
+}
+
+func TestCondition_SetEnabled(t *testing.T) {
+	c := newTestCondition()
+	now := time.Unix(1000, 0)
+	assert.Zero(t, c.SetEnabled(true, now))
+	_, _ = c.Activate("", "", now, 1)
+
+	mask := c.SetEnabled(false, now.Add(time.Second))
+	assert.Equal(t, OPC_CHANGE_ENABLE_STATE|OPC_CHANGE_ACTIVE_STATE|OPC_CHANGE_ACK_STATE, mask)
+	assert.Equal(t, OPC_CONDITION_ACKED, c.State())
+	_, err := c.Activate("", "", now, 2)
+	assert.Equal(t, ErrConditionDisabled, err)
+	_, err = c.Deactivate("", now)
+	assert.Equal(t, ErrConditionDisabled, err)
+
+	assert.Equal(t, OPC_CHANGE_ENABLE_STATE, c.SetEnabled(true, now))
+	assert.Equal(t, OPC_CONDITION_ENABLED|OPC_CONDITION_ACKED, c.State())
+}
+
+func TestCondition_SetQuality(t *testing.T) {
+	c := newTestCondition()
+	assert.Zero(t, c.SetQuality(OPC_QUALITY_GOOD))
+	assert.Equal(t, OPC_CHANGE_QUALITY, c.SetQuality(OPC_QUALITY_UNCERTAIN))
+	assert.Equal(t, OPC_QUALITY_UNCERTAIN, c.Quality)
+}
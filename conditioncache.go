@@ -0,0 +1,330 @@
+package opcae
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CachedCondition is the state of a condition as reported by the last condition event for it
+type CachedCondition struct {
+	Source       string
+	Condition    string
+	SubCondition string
+	Category     uint32
+	Severity     uint32
+	State        State
+	Message      string
+	Quality      uint16
+	// ActiveTime and Cookie are quoted when the condition is acknowledged, see AckRequest
+	ActiveTime time.Time
+	Cookie     uint32
+	// Time is the time of the last event for the condition
+	Time       time.Time
+	Attributes []interface{}
+
+	// seq orders the updates of the cache, it decides which entries a refresh has seen
+	seq uint64
+}
+
+// AckRequest returns the request needed to acknowledge the condition
+func (c *CachedCondition) AckRequest() *AckRequest {
+	return &AckRequest{
+		Source:     c.Source,
+		Condition:  c.Condition,
+		ActiveTime: c.ActiveTime,
+		Cookie:     c.Cookie,
+	}
+}
+
+// ConditionChangeType tells how a ConditionChange affected the cache
+type ConditionChangeType int
+
+const (
+	// ConditionAdded the condition became active or unacknowledged
+	ConditionAdded ConditionChangeType = iota
+	// ConditionUpdated the condition is still active or unacknowledged and changed
+	ConditionUpdated
+	// ConditionRemoved the condition returned to normal and is acknowledged, or a refresh did not report it
+	ConditionRemoved
+)
+
+func (t ConditionChangeType) String() string {
+	switch t {
+	case ConditionAdded:
+		return "added"
+	case ConditionUpdated:
+		return "updated"
+	case ConditionRemoved:
+		return "removed"
+	}
+	return "unknown"
+}
+
+// ConditionChange is sent to the channels registered with ConditionCache.Notify.
+// Condition is a copy of the cached state, for ConditionRemoved it is the state that removed the condition.
+type ConditionChange struct {
+	Type      ConditionChangeType
+	Condition CachedCondition
+}
+
+// ConditionQuery selects conditions from a ConditionCache, the zero value selects all conditions
+type ConditionQuery struct {
+	// AreaPrefix matches the start of the fully qualified source name, include the area separator of the
+	// server to select a single area, e.g. "Plant.Area1."
+	AreaPrefix string
+	// LowSeverity and HighSeverity limit the severity, a HighSeverity of 0 means no upper limit
+	LowSeverity  uint32
+	HighSeverity uint32
+	UnackedOnly  bool
+}
+
+func (q *ConditionQuery) match(c *CachedCondition) bool {
+	if !strings.HasPrefix(c.Source, q.AreaPrefix) {
+		return false
+	}
+	if c.Severity < q.LowSeverity || (q.HighSeverity != 0 && c.Severity > q.HighSeverity) {
+		return false
+	}
+	return !q.UnackedOnly || !c.State.IsAcked()
+}
+
+type conditionKey struct {
+	source    string
+	condition string
+}
+
+// ConditionCache is a live alarm table, it holds every condition that is active or unacknowledged.
+// It is fed with the condition events of a subscription, either by passing it as Handler to Subscribe or
+// by calling Apply for every callback, simple and tracking events are ignored.
+// Sync seeds the cache from a refresh and removes the conditions the refresh no longer reports.
+type ConditionCache struct {
+	lock       sync.RWMutex
+	conditions map[conditionKey]*CachedCondition
+	seq        uint64
+	// refreshSeq is the sequence number at the start of the refresh seen by OnRefreshStart
+	refreshSeq uint64
+	refreshing bool
+	// refreshes counts the refreshes in progress, while there are any removed holds the time of the
+	// event that removed a condition so older refresh events do not add it again
+	refreshes int
+	removed   map[conditionKey]time.Time
+	receivers []chan<- ConditionChange
+}
+
+var _ Handler = (*ConditionCache)(nil)
+
+func NewConditionCache() *ConditionCache {
+	return &ConditionCache{conditions: make(map[conditionKey]*CachedCondition)}
+}
+
+// Notify registers ch for the changes of the cache. Changes are sent without blocking, they are
+// dropped when ch is full.
+func (cc *ConditionCache) Notify(ch chan<- ConditionChange) {
+	cc.lock.Lock()
+	cc.receivers = append(cc.receivers, ch)
+	cc.lock.Unlock()
+}
+
+// Apply updates the cache with the condition events of a callback
+func (cc *ConditionCache) Apply(data *EventSinkOnEventData) {
+	cc.applyEvents(data.Events)
+}
+
+func (cc *ConditionCache) applyEvents(events []*OnEventStruct) {
+	var changes []ConditionChange
+	cc.lock.Lock()
+	for _, event := range events {
+		if change, ok := cc.apply(event); ok {
+			changes = append(changes, change)
+		}
+	}
+	receivers := cc.receivers
+	cc.lock.Unlock()
+	notifyChanges(receivers, changes)
+}
+
+// apply updates the cache with a single event. cc.lock must be held.
+func (cc *ConditionCache) apply(event *OnEventStruct) (ConditionChange, bool) {
+	if event.EventType != uint32(OPC_CONDITION_EVENT) {
+		return ConditionChange{}, false
+	}
+	key := conditionKey{source: event.Source, condition: event.Condition}
+	cc.seq++
+	c := &CachedCondition{
+		Source:       event.Source,
+		Condition:    event.Condition,
+		SubCondition: event.Subcond,
+		Category:     event.Category,
+		Severity:     event.Severity,
+		State:        event.NewState,
+		Message:      event.Message,
+		Quality:      event.Quality,
+		ActiveTime:   event.ActiveTime,
+		Cookie:       event.Cookie,
+		Time:         event.Time,
+		Attributes:   event.Attributes,
+		seq:          cc.seq,
+	}
+	old, exists := cc.conditions[key]
+	if exists && old.Time.After(c.Time) {
+		// a refresh reports a state that is older than the live event already applied
+		old.seq = cc.seq
+		return ConditionChange{}, false
+	}
+	if removedAt, ok := cc.removed[key]; ok && !c.Time.After(removedAt) {
+		// a refresh reports a state that is older than the live event that removed the condition
+		return ConditionChange{}, false
+	}
+	if !c.State.IsActive() && c.State.IsAcked() {
+		if !exists {
+			return ConditionChange{}, false
+		}
+		delete(cc.conditions, key)
+		if cc.removed != nil {
+			cc.removed[key] = c.Time
+		}
+		return ConditionChange{Type: ConditionRemoved, Condition: *c}, true
+	}
+	delete(cc.removed, key)
+	cc.conditions[key] = c
+	if exists {
+		return ConditionChange{Type: ConditionUpdated, Condition: *c}, true
+	}
+	return ConditionChange{Type: ConditionAdded, Condition: *c}, true
+}
+
+// beginRefresh starts recording removed conditions. cc.lock must be held.
+func (cc *ConditionCache) beginRefresh() {
+	cc.refreshes++
+	if cc.removed == nil {
+		cc.removed = make(map[conditionKey]time.Time)
+	}
+}
+
+// endRefresh drops the removed conditions once no refresh is in progress. cc.lock must be held.
+func (cc *ConditionCache) endRefresh() {
+	cc.refreshes--
+	if cc.refreshes == 0 {
+		cc.removed = nil
+	}
+}
+
+// removeBefore removes the conditions that were not updated after seq. cc.lock must be held.
+func (cc *ConditionCache) removeBefore(seq uint64) []ConditionChange {
+	var changes []ConditionChange
+	for key, c := range cc.conditions {
+		if c.seq <= seq {
+			delete(cc.conditions, key)
+			changes = append(changes, ConditionChange{Type: ConditionRemoved, Condition: *c})
+		}
+	}
+	return changes
+}
+
+func notifyChanges(receivers []chan<- ConditionChange, changes []ConditionChange) {
+	for _, change := range changes {
+		for _, ch := range receivers {
+			select {
+			case ch <- change:
+			default:
+			}
+		}
+	}
+}
+
+// Sync seeds the cache from sub.RefreshAndWait. Conditions that were not updated since the refresh started
+// and are missing from it are removed, live events applied concurrently are kept.
+func (cc *ConditionCache) Sync(ctx context.Context, sub EventSubscription) error {
+	cc.lock.Lock()
+	seq := cc.seq
+	cc.beginRefresh()
+	cc.lock.Unlock()
+	events, err := sub.RefreshAndWait(ctx)
+	if err != nil {
+		cc.lock.Lock()
+		cc.endRefresh()
+		cc.lock.Unlock()
+		return err
+	}
+	cc.applyEvents(events)
+	cc.lock.Lock()
+	cc.endRefresh()
+	changes := cc.removeBefore(seq)
+	receivers := cc.receivers
+	cc.lock.Unlock()
+	notifyChanges(receivers, changes)
+	return nil
+}
+
+// OnEvent implements Handler, it calls Apply
+func (cc *ConditionCache) OnEvent(data *EventSinkOnEventData) {
+	cc.Apply(data)
+}
+
+// OnRefreshStart implements Handler, the conditions missing from the refresh are removed by OnRefreshDone
+func (cc *ConditionCache) OnRefreshStart() {
+	cc.lock.Lock()
+	if !cc.refreshing {
+		cc.refreshing = true
+		cc.beginRefresh()
+	}
+	cc.refreshSeq = cc.seq
+	cc.lock.Unlock()
+}
+
+// OnRefreshDone implements Handler
+func (cc *ConditionCache) OnRefreshDone() {
+	cc.lock.Lock()
+	if !cc.refreshing {
+		cc.lock.Unlock()
+		return
+	}
+	cc.refreshing = false
+	cc.endRefresh()
+	changes := cc.removeBefore(cc.refreshSeq)
+	receivers := cc.receivers
+	cc.lock.Unlock()
+	notifyChanges(receivers, changes)
+}
+
+// OnError implements Handler, the cache keeps its content when the server shuts down
+func (cc *ConditionCache) OnError(error) {}
+
+// Get returns a copy of the cached state of the condition
+func (cc *ConditionCache) Get(source, condition string) (CachedCondition, bool) {
+	cc.lock.RLock()
+	defer cc.lock.RUnlock()
+	c, ok := cc.conditions[conditionKey{source: source, condition: condition}]
+	if !ok {
+		return CachedCondition{}, false
+	}
+	return *c, true
+}
+
+func (cc *ConditionCache) Len() int {
+	cc.lock.RLock()
+	defer cc.lock.RUnlock()
+	return len(cc.conditions)
+}
+
+// Query returns copies of the conditions selected by q ordered by source and condition name
+func (cc *ConditionCache) Query(q ConditionQuery) []CachedCondition {
+	cc.lock.RLock()
+	var result []CachedCondition
+	for _, c := range cc.conditions {
+		if q.match(c) {
+			result = append(result, *c)
+		}
+	}
+	cc.lock.RUnlock()
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Source != result[j].Source {
+			return result[i].Source < result[j].Source
+		}
+		return result[i].Condition < result[j].Condition
+	})
+	return result
+}
@@ -0,0 +1,139 @@
+package opcae
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func conditionEvent(source, condition string, severity uint32, state State, at time.Time) *OnEventStruct {
+	return &OnEventStruct{
+		EventType: uint32(OPC_CONDITION_EVENT),
+		Source:    source,
+		Condition: condition,
+		Severity:  severity,
+		NewState:  state,
+		Time:      at,
+	}
+}
+
+const (
+	activeUnacked   = OPC_CONDITION_ENABLED | OPC_CONDITION_ACTIVE
+	activeAcked     = OPC_CONDITION_ENABLED | OPC_CONDITION_ACTIVE | OPC_CONDITION_ACKED
+	inactiveUnacked = OPC_CONDITION_ENABLED
+	inactiveAcked   = OPC_CONDITION_ENABLED | OPC_CONDITION_ACKED
+)
+
+func TestConditionCache_Apply(t *testing.T) {
+	cc := NewConditionCache()
+	changes := make(chan ConditionChange, 10)
+	cc.Notify(changes)
+	now := time.Unix(1000, 0)
+	cc.Apply(&EventSinkOnEventData{Events: []*OnEventStruct{
+		conditionEvent("Plant.Area1.Tank1", "LEVEL", 500, activeUnacked, now),
+		{EventType: uint32(OPC_SIMPLE_EVENT), Source: "Plant.Area1.Tank1"},
+		conditionEvent("Plant.Area1.Tank1", "COMM", 100, inactiveAcked, now),
+	}})
+	assert.Equal(t, 1, cc.Len())
+	change := <-changes
+	assert.Equal(t, ConditionAdded, change.Type)
+	assert.Equal(t, "LEVEL", change.Condition.Condition)
+	assert.Empty(t, changes)
+
+	event := conditionEvent("Plant.Area1.Tank1", "LEVEL", 500, activeAcked, now.Add(time.Second))
+	event.Cookie = 7
+	event.ActiveTime = now
+	cc.Apply(&EventSinkOnEventData{Events: []*OnEventStruct{event}})
+	assert.Equal(t, ConditionUpdated, (<-changes).Type)
+	c, ok := cc.Get("Plant.Area1.Tank1", "LEVEL")
+	assert.True(t, ok)
+	assert.Equal(t, activeAcked, c.State)
+	assert.Equal(t, &AckRequest{Source: "Plant.Area1.Tank1", Condition: "LEVEL", ActiveTime: now, Cookie: 7}, c.AckRequest())
+
+	cc.Apply(&EventSinkOnEventData{Events: []*OnEventStruct{conditionEvent("Plant.Area1.Tank1", "LEVEL", 500, inactiveUnacked, now.Add(2*time.Second))}})
+	assert.Equal(t, ConditionUpdated, (<-changes).Type, "returning to normal keeps an unacknowledged condition")
+	cc.Apply(&EventSinkOnEventData{Events: []*OnEventStruct{conditionEvent("Plant.Area1.Tank1", "LEVEL", 500, inactiveAcked, now.Add(3*time.Second))}})
+	assert.Equal(t, ConditionRemoved, (<-changes).Type)
+	_, ok = cc.Get("Plant.Area1.Tank1", "LEVEL")
+	assert.False(t, ok)
+	assert.Zero(t, cc.Len())
+}
+
+func TestConditionCache_Query(t *testing.T) {
+	cc := NewConditionCache()
+	now := time.Unix(1000, 0)
+	cc.Apply(&EventSinkOnEventData{Events: []*OnEventStruct{
+		conditionEvent("Plant.Area10.Pump1", "COMM", 900, activeUnacked, now),
+		conditionEvent("Plant.Area1.Tank1", "LEVEL", 500, activeAcked, now),
+		conditionEvent("Plant.Area1.Tank1", "COMM", 100, inactiveUnacked, now),
+		conditionEvent("Plant.Area2.Tank2", "LEVEL", 700, activeUnacked, now),
+	}})
+	names := func(conditions []CachedCondition) []string {
+		var result []string
+		for _, c := range conditions {
+			result = append(result, c.Source+"/"+c.Condition)
+		}
+		return result
+	}
+	assert.Equal(t, []string{"Plant.Area1.Tank1/COMM", "Plant.Area1.Tank1/LEVEL", "Plant.Area10.Pump1/COMM", "Plant.Area2.Tank2/LEVEL"}, names(cc.Query(ConditionQuery{})))
+	assert.Equal(t, []string{"Plant.Area1.Tank1/COMM", "Plant.Area1.Tank1/LEVEL"}, names(cc.Query(ConditionQuery{AreaPrefix: "Plant.Area1."})))
+	assert.Equal(t, []string{"Plant.Area1.Tank1/LEVEL", "Plant.Area2.Tank2/LEVEL"}, names(cc.Query(ConditionQuery{LowSeverity: 200, HighSeverity: 800})))
+	assert.Equal(t, []string{"Plant.Area1.Tank1/COMM", "Plant.Area10.Pump1/COMM", "Plant.Area2.Tank2/LEVEL"}, names(cc.Query(ConditionQuery{UnackedOnly: true})))
+}
+
+func TestConditionCache_Refresh(t *testing.T) {
+	cc := NewConditionCache()
+	changes := make(chan ConditionChange, 10)
+	now := time.Unix(1000, 0)
+	cc.Apply(&EventSinkOnEventData{Events: []*OnEventStruct{
+		conditionEvent("Tank1", "LEVEL", 500, activeUnacked, now),
+		conditionEvent("Tank2", "LEVEL", 500, activeUnacked, now),
+	}})
+	cc.Notify(changes)
+
+	cc.OnRefreshStart()
+	cc.OnEvent(&EventSinkOnEventData{Events: []*OnEventStruct{conditionEvent("Tank3", "LEVEL", 500, activeUnacked, now.Add(time.Second))}})
+	assert.Equal(t, ConditionAdded, (<-changes).Type)
+	cc.OnEvent(&EventSinkOnEventData{Refresh: true, LastRefresh: true, Events: []*OnEventStruct{
+		conditionEvent("Tank1", "LEVEL", 500, activeUnacked, now),
+	}})
+	assert.Equal(t, ConditionUpdated, (<-changes).Type)
+	cc.OnRefreshDone()
+	change := <-changes
+	assert.Equal(t, ConditionRemoved, change.Type)
+	assert.Equal(t, "Tank2", change.Condition.Source)
+	assert.Equal(t, 2, cc.Len())
+
+	cc.OnRefreshStart()
+	cc.OnEvent(&EventSinkOnEventData{Refresh: true, LastRefresh: true, Events: []*OnEventStruct{
+		conditionEvent("Tank1", "LEVEL", 500, activeUnacked, now),
+		conditionEvent("Tank3", "LEVEL", 500, activeUnacked, now),
+	}})
+	cc.OnRefreshDone()
+	c, ok := cc.Get("Tank3", "LEVEL")
+	assert.True(t, ok)
+	assert.Equal(t, now.Add(time.Second), c.Time, "an older refresh event does not replace a newer state")
+}
+
+func TestConditionCache_RemovedDuringRefresh(t *testing.T) {
+	cc := NewConditionCache()
+	changes := make(chan ConditionChange, 10)
+	now := time.Unix(1000, 0)
+	cc.Apply(&EventSinkOnEventData{Events: []*OnEventStruct{conditionEvent("Tank1", "LEVEL", 500, activeUnacked, now)}})
+	cc.Notify(changes)
+
+	cc.OnRefreshStart()
+	cc.OnEvent(&EventSinkOnEventData{Events: []*OnEventStruct{conditionEvent("Tank1", "LEVEL", 500, inactiveAcked, now.Add(time.Second))}})
+	assert.Equal(t, ConditionRemoved, (<-changes).Type)
+	cc.OnEvent(&EventSinkOnEventData{Refresh: true, LastRefresh: true, Events: []*OnEventStruct{
+		conditionEvent("Tank1", "LEVEL", 500, activeUnacked, now),
+	}})
+	cc.OnRefreshDone()
+	assert.Equal(t, 0, cc.Len(), "the refresh reported the state before the removal")
+	assert.Empty(t, changes)
+	assert.Nil(t, cc.removed)
+
+	cc.OnEvent(&EventSinkOnEventData{Events: []*OnEventStruct{conditionEvent("Tank1", "LEVEL", 500, activeUnacked, now.Add(2*time.Second))}})
+	assert.Equal(t, ConditionAdded, (<-changes).Type)
+}
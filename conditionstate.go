@@ -0,0 +1,51 @@
+package opcae
+
+import "time"
+
+// ConditionState is a decoded snapshot of a single condition as returned by GetConditionState.
+// Timestamps the server did not set are the zero time.
+type ConditionState struct {
+	State              State
+	ActiveSubCondition string
+	ASCDefinition      string
+	ASCSeverity        uint32
+	ASCDescription     string
+	Quality            uint16
+	LastAckTime        time.Time
+	SubCondLastActive  time.Time
+	CondLastActive     time.Time
+	CondLastInactive   time.Time
+	AcknowledgerID     string
+	Comment            string
+	SubConditions      []*SubCondition
+	// Attributes are in the order they were requested
+	Attributes       []*ConditionAttribute
+	AttributesByID   map[uint32]*ConditionAttribute
+	AttributesByName map[string]*ConditionAttribute
+}
+
+type SubCondition struct {
+	Name        string
+	Definition  string
+	Severity    uint32
+	Description string
+}
+
+// ConditionAttribute is the current value of a condition attribute.
+// Err is not nil if the server could not return the value.
+type ConditionAttribute struct {
+	ID          uint32
+	Description string
+	Type        uint16
+	Value       interface{}
+	Err         error
+}
+
+// EnableState is the enable state of an area or a source as reported by IOPCEventServer2.
+// Enabled is the state of the area or source itself, EffectivelyEnabled also takes the enable state of the areas above it into account.
+type EnableState struct {
+	Name               string
+	Enabled            bool
+	EffectivelyEnabled bool
+	Err                error
+}
@@ -0,0 +1,91 @@
+package opcae
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+type ConnectionState int32
+
+const (
+	// ConnectionConnected the server is connected and has not announced a shutdown
+	ConnectionConnected ConnectionState = iota
+	// ConnectionShuttingDown the server sent a shutdown request, all further calls are likely to fail
+	ConnectionShuttingDown
+	// ConnectionDisconnected the client disconnected from the server
+	ConnectionDisconnected
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case ConnectionConnected:
+		return "connected"
+	case ConnectionShuttingDown:
+		return "shutting down"
+	case ConnectionDisconnected:
+		return "disconnected"
+	}
+	return "unknown"
+}
+
+// connectionStatus is shared by a server and the subscriptions created from it
+type connectionStatus struct {
+	state     atomic.Int32
+	lock      sync.Mutex
+	reason    string
+	shutdown  chan struct{}
+	receivers []chan string
+}
+
+func newConnectionStatus() *connectionStatus {
+	return &connectionStatus{shutdown: make(chan struct{})}
+}
+
+func (c *connectionStatus) State() ConnectionState {
+	return ConnectionState(c.state.Load())
+}
+
+// Reason returns the reason of the shutdown request, empty when the server did not request a shutdown
+func (c *connectionStatus) Reason() string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.reason
+}
+
+// Done is closed when the server requested a shutdown or the client disconnected
+func (c *connectionStatus) Done() <-chan struct{} {
+	return c.shutdown
+}
+
+func (c *connectionStatus) AddReceiver(ch chan string) {
+	c.lock.Lock()
+	c.receivers = append(c.receivers, ch)
+	c.lock.Unlock()
+}
+
+// Shutdown handles a shutdown request of the server, receivers are notified without blocking
+func (c *connectionStatus) Shutdown(reason string) {
+	if !c.state.CompareAndSwap(int32(ConnectionConnected), int32(ConnectionShuttingDown)) {
+		return
+	}
+	c.lock.Lock()
+	c.reason = reason
+	receivers := c.receivers
+	close(c.shutdown)
+	c.lock.Unlock()
+	for _, ch := range receivers {
+		select {
+		case ch <- reason:
+		default:
+		}
+	}
+}
+
+func (c *connectionStatus) Disconnect() {
+	old := ConnectionState(c.state.Swap(int32(ConnectionDisconnected)))
+	if old == ConnectionConnected {
+		c.lock.Lock()
+		close(c.shutdown)
+		c.lock.Unlock()
+	}
+}
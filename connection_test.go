@@ -0,0 +1,40 @@
+package opcae
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnectionStatus_Shutdown(t *testing.T) {
+	status := newConnectionStatus()
+	assert.Equal(t, ConnectionConnected, status.State())
+	ch := make(chan string, 1)
+	status.AddReceiver(ch)
+	status.Shutdown("maintenance")
+	assert.Equal(t, ConnectionShuttingDown, status.State())
+	assert.Equal(t, "maintenance", status.Reason())
+	assert.Equal(t, "maintenance", <-ch)
+	select {
+	case <-status.Done():
+	default:
+		t.Fatal("done not closed")
+	}
+	// a second request is ignored
+	status.Shutdown("again")
+	assert.Equal(t, "maintenance", status.Reason())
+	assert.Empty(t, ch)
+	status.Disconnect()
+	assert.Equal(t, ConnectionDisconnected, status.State())
+	assert.Equal(t, "disconnected", status.State().String())
+}
+
+func TestConnectionStatus_Disconnect(t *testing.T) {
+	status := newConnectionStatus()
+	status.Disconnect()
+	assert.Equal(t, ConnectionDisconnected, status.State())
+	<-status.Done()
+	status.Shutdown("late")
+	assert.Equal(t, ConnectionDisconnected, status.State())
+	assert.Empty(t, status.Reason())
+}
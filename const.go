@@ -5,3 +5,41 @@ const (
 	OPCAE_BROWSE_DOWN        = OPCAE_BROWSE_UP + 1
 	OPCAE_BROWSE_TO          = OPCAE_BROWSE_DOWN + 1
 )
+
+// Quality of a condition, the low bits carry the sub-status and limit of the OPC DA quality
+const (
+	OPC_QUALITY_BAD       uint16 = 0x00
+	OPC_QUALITY_UNCERTAIN uint16 = 0x40
+	OPC_QUALITY_GOOD      uint16 = 0xC0
+)
+
+// OPC AE specific result codes
+const (
+	OPC_S_ALREADYACKED         uint32 = 0x00040200
+	OPC_S_INVALIDBUFFERTIME    uint32 = 0x00040201
+	OPC_S_INVALIDMAXSIZE       uint32 = 0x00040202
+	OPC_S_INVALIDKEEPALIVETIME uint32 = 0x00040203
+	OPC_E_INVALIDBRANCHNAME    uint32 = 0xC0040203
+	OPC_E_INVALIDTIME          uint32 = 0xC0040204
+	OPC_E_BUSY                 uint32 = 0xC0040205
+	OPC_E_NOINFO               uint32 = 0xC0040206
+)
+
+// COM and RPC result codes returned by OPC AE calls
+const (
+	S_FALSE                     uint32 = 0x00000001
+	E_NOTIMPL                   uint32 = 0x80004001
+	E_NOINTERFACE               uint32 = 0x80004002
+	E_FAIL                      uint32 = 0x80004005
+	E_ACCESSDENIED              uint32 = 0x80070005
+	E_OUTOFMEMORY               uint32 = 0x8007000E
+	E_INVALIDARG                uint32 = 0x80070057
+	CONNECT_E_NOCONNECTION      uint32 = 0x80040200
+	CO_E_OBJNOTCONNECTED        uint32 = 0x800401FD
+	RPC_E_CALL_REJECTED         uint32 = 0x80010001
+	RPC_E_DISCONNECTED          uint32 = 0x80010108
+	RPC_E_SERVERCALL_RETRYLATER uint32 = 0x8001010A
+	RPC_S_SERVER_UNAVAILABLE    uint32 = 0x800706BA
+	RPC_S_CALL_FAILED           uint32 = 0x800706BE
+	RPC_S_CALL_FAILED_DNE       uint32 = 0x800706BF
+)
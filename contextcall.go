@@ -0,0 +1,169 @@
+package opcae
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type ServerOption func(*serverOptions)
+
+type serverOptions struct {
+	timeout time.Duration
+}
+
+func newServerOptions(opts []ServerOption) *serverOptions {
+	o := &serverOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithDefaultTimeout limits the Context methods of the server and of its subscriptions and area browsers
+// to timeout when their ctx has no deadline, 0 disables the limit
+func WithDefaultTimeout(timeout time.Duration) ServerOption {
+	return func(o *serverOptions) {
+		o.timeout = timeout
+	}
+}
+
+// CallContext runs call on a new goroutine and returns ctx.Err() when ctx is done first. timeout limits
+// the call when ctx has no deadline, 0 disables the limit.
+// The call is abandoned, not cancelled: it keeps running and its result is dropped, release is called with
+// the result of a call that succeeds after it was abandoned, informational success codes included, so
+// created objects are not leaked, it may be nil. The side effects of an abandoned call still happen, a
+// method that changes the server may take effect after it returned ctx.Err().
+// A call that finishes while ctx is done returns its result.
+// When ctx can never be done the call runs on the calling goroutine.
+// It is used by implementations of EventServer.
+func CallContext[T any](ctx context.Context, timeout time.Duration, call func() (T, error), release func(T)) (T, error) {
+	if _, ok := ctx.Deadline(); !ok && timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if ctx.Done() == nil {
+		return call()
+	}
+	var zero T
+	if err := ctx.Err(); err != nil {
+		return zero, err
+	}
+	type result struct {
+		value T
+		err   error
+	}
+	// lock orders the end of the call and its abandonment, done is buffered so the call never blocks
+	var lock sync.Mutex
+	abandoned := false
+	done := make(chan result, 1)
+	go func() {
+		value, err := call()
+		lock.Lock()
+		if abandoned {
+			lock.Unlock()
+			if Succeeded(err) && release != nil {
+				release(value)
+			}
+			return
+		}
+		done <- result{value: value, err: err}
+		lock.Unlock()
+	}()
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-ctx.Done():
+		lock.Lock()
+		defer lock.Unlock()
+		select {
+		case r := <-done:
+			// the call finished meanwhile
+			return r.value, r.err
+		default:
+		}
+		abandoned = true
+		return zero, ctx.Err()
+	}
+}
+
+// callContextErr is CallContext for calls that only return an error
+func callContextErr(ctx context.Context, timeout time.Duration, call func() error) error {
+	_, err := CallContext(ctx, timeout, func() (struct{}, error) {
+		return struct{}{}, call()
+	}, nil)
+	return err
+}
+
+// inFlight counts the calls made through the interfaces of a COM object by the Context methods, so that
+// releasing the object waits for abandoned calls instead of releasing the interfaces they use.
+// A call also counts in parent, the object whose interfaces report its errors.
+type inFlight struct {
+	parent *inFlight
+
+	lock     sync.Mutex
+	calls    sync.WaitGroup
+	released bool
+}
+
+// enter registers a call, it returns false once the object or its parent is released
+func (f *inFlight) enter() bool {
+	if f.parent != nil && !f.parent.enter() {
+		return false
+	}
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.released {
+		if f.parent != nil {
+			f.parent.leave()
+		}
+		return false
+	}
+	f.calls.Add(1)
+	return true
+}
+
+func (f *inFlight) leave() {
+	f.calls.Done()
+	if f.parent != nil {
+		f.parent.leave()
+	}
+}
+
+// release makes the next calls fail and waits for the running ones, it returns false when the object was
+// already released
+func (f *inFlight) release() bool {
+	f.lock.Lock()
+	if f.released {
+		f.lock.Unlock()
+		return false
+	}
+	f.released = true
+	f.lock.Unlock()
+	f.calls.Wait()
+	return true
+}
+
+// tracked returns call counted in f, it fails with CO_E_OBJNOTCONNECTED once f is released
+func tracked[T any](f *inFlight, op string, call func() (T, error)) func() (T, error) {
+	return func() (T, error) {
+		if !f.enter() {
+			var zero T
+			return zero, NewOPCError(op, "", CO_E_OBJNOTCONNECTED)
+		}
+		defer f.leave()
+		return call()
+	}
+}
+
+// trackedErr is tracked for calls that only return an error
+func trackedErr(f *inFlight, op string, call func() error) func() error {
+	return func() error {
+		if !f.enter() {
+			return NewOPCError(op, "", CO_E_OBJNOTCONNECTED)
+		}
+		defer f.leave()
+		return call()
+	}
+}
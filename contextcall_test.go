@@ -0,0 +1,95 @@
+package opcae
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCallContext(t *testing.T) {
+	value, err := CallContext(context.Background(), 0, func() (int, error) { return 1, nil }, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, value)
+	failure := errors.New("failure")
+	_, err = CallContext(context.Background(), time.Second, func() (int, error) { return 0, failure }, nil)
+	assert.Equal(t, failure, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	called := false
+	_, err = CallContext(ctx, 0, func() (int, error) { called = true; return 1, nil }, nil)
+	assert.Equal(t, context.Canceled, err)
+	assert.False(t, called, "a done ctx does not start the call")
+
+	// the default timeout abandons the call, its late result is released
+	resume := make(chan struct{})
+	released := make(chan int, 1)
+	start := time.Now()
+	_, err = CallContext(context.Background(), 20*time.Millisecond, func() (int, error) {
+		<-resume
+		return 2, nil
+	}, func(v int) { released <- v })
+	assert.Equal(t, context.DeadlineExceeded, err)
+	assert.Less(t, time.Since(start), time.Second)
+	close(resume)
+	select {
+	case v := <-released:
+		assert.Equal(t, 2, v)
+	case <-time.After(2 * time.Second):
+		t.Fatal("the abandoned result was not released")
+	}
+
+	// the deadline of ctx wins over the default timeout
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	value, err = CallContext(ctx, time.Millisecond, func() (int, error) {
+		time.Sleep(20 * time.Millisecond)
+		return 3, nil
+	}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, value)
+}
+
+func TestInFlight(t *testing.T) {
+	var server, sub inFlight
+	sub.parent = &server
+
+	// an abandoned call holds the release of its object and of the parent
+	resume := make(chan struct{})
+	started := make(chan struct{})
+	_, err := CallContext(context.Background(), 20*time.Millisecond, tracked(&sub, "Refresh", func() (int, error) {
+		close(started)
+		<-resume
+		return 1, nil
+	}), nil)
+	assert.Equal(t, context.DeadlineExceeded, err)
+	<-started
+	released := make(chan bool, 1)
+	go func() {
+		released <- server.release()
+	}()
+	select {
+	case <-released:
+		t.Fatal("the parent was released during the call")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(resume)
+	select {
+	case ok := <-released:
+		assert.True(t, ok)
+	case <-time.After(2 * time.Second):
+		t.Fatal("the parent was not released after the call")
+	}
+	assert.False(t, server.release(), "a second release does nothing")
+
+	// the calls after the release of the parent fail without running
+	called := false
+	err = trackedErr(&sub, "Refresh", func() error { called = true; return nil })()
+	assert.False(t, called)
+	assert.Equal(t, NewOPCError("Refresh", "", CO_E_OBJNOTCONNECTED), err)
+	assert.True(t, ConnectionLost(err))
+	assert.True(t, sub.release())
+}
@@ -0,0 +1,151 @@
+package opcae
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultDedupWindow is the number of condition transitions a Deduplicator remembers when none is given
+const DefaultDedupWindow = 4096
+
+// dedupKey identifies a condition transition, mask is 0 in the key that ignores the change mask
+type dedupKey struct {
+	source       string
+	condition    string
+	subCondition string
+	mask         ChangeMask
+	activeTime   int64
+	cookie       uint32
+	// time tells repeated transitions of an occurrence apart, e.g. two quality changes
+	time int64
+}
+
+func newDedupKey(event *OnEventStruct) dedupKey {
+	var mask ChangeMask
+	for _, m := range event.ChangeMask {
+		mask |= m
+	}
+	return dedupKey{
+		source:       event.Source,
+		condition:    event.Condition,
+		subCondition: event.Subcond,
+		mask:         mask,
+		activeTime:   event.ActiveTime.UnixNano(),
+		cookie:       event.Cookie,
+		time:         event.Time.UnixNano(),
+	}
+}
+
+// Deduplicator suppresses condition events that report a transition that was already seen.
+// A transition is keyed on source, condition, sub-condition, change mask, active time, cookie and event time.
+// Refresh events usually carry no change mask and the time of the last transition, they are duplicates when
+// any transition with the same remaining key was seen.
+// Simple and tracking events are never suppressed.
+//
+// The last window transitions are remembered. A Deduplicator can be shared by the subscriptions that replace
+// each other after a reconnect, see WithDeduplicator.
+type Deduplicator struct {
+	lock   sync.Mutex
+	window int
+	seen   map[dedupKey]struct{}
+	// transitions counts the remembered transitions per key without change mask
+	transitions map[dedupKey]int
+	// ring holds the remembered keys in the order they were seen, next is the slot that is overwritten next
+	ring       []dedupKey
+	next       int
+	suppressed atomic.Uint64
+}
+
+// NewDeduplicator returns a Deduplicator that remembers the last window transitions, DefaultDedupWindow
+// when window is not positive
+func NewDeduplicator(window int) *Deduplicator {
+	if window <= 0 {
+		window = DefaultDedupWindow
+	}
+	return &Deduplicator{
+		window:      window,
+		seen:        make(map[dedupKey]struct{}, window),
+		transitions: make(map[dedupKey]int, window),
+	}
+}
+
+// Filter returns the events that are not duplicates and remembers their transitions, refresh tells whether
+// the events come from a refresh. events is returned unchanged when none of them is a duplicate.
+func (d *Deduplicator) Filter(events []*OnEventStruct, refresh bool) []*OnEventStruct {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	var result []*OnEventStruct
+	for i, event := range events {
+		if event.EventType != uint32(OPC_CONDITION_EVENT) || !d.duplicate(newDedupKey(event), refresh) {
+			if result != nil {
+				result = append(result, event)
+			}
+			continue
+		}
+		d.suppressed.Add(1)
+		if result == nil {
+			result = append(make([]*OnEventStruct, 0, len(events)-1), events[:i]...)
+		}
+	}
+	if result == nil {
+		return events
+	}
+	return result
+}
+
+// Record remembers the transitions of the events without suppressing any of them
+func (d *Deduplicator) Record(events []*OnEventStruct) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	for _, event := range events {
+		if event.EventType == uint32(OPC_CONDITION_EVENT) {
+			d.remember(newDedupKey(event))
+		}
+	}
+}
+
+// Suppressed returns the number of events suppressed as duplicates
+func (d *Deduplicator) Suppressed() uint64 {
+	return d.suppressed.Load()
+}
+
+// duplicate reports whether the transition was seen and remembers it otherwise. d.lock must be held.
+func (d *Deduplicator) duplicate(key dedupKey, refresh bool) bool {
+	if _, ok := d.seen[key]; ok {
+		return true
+	}
+	if refresh && key.mask == 0 {
+		if d.transitions[key] != 0 {
+			return true
+		}
+	}
+	d.remember(key)
+	return false
+}
+
+// remember adds the transition and forgets the oldest one when the window is full. d.lock must be held.
+func (d *Deduplicator) remember(key dedupKey) {
+	if _, ok := d.seen[key]; ok {
+		return
+	}
+	if len(d.ring) < d.window {
+		d.ring = append(d.ring, key)
+	} else {
+		d.forget(d.ring[d.next])
+		d.ring[d.next] = key
+		d.next = (d.next + 1) % d.window
+	}
+	d.seen[key] = struct{}{}
+	base := key
+	base.mask = 0
+	d.transitions[base]++
+}
+
+func (d *Deduplicator) forget(key dedupKey) {
+	delete(d.seen, key)
+	base := key
+	base.mask = 0
+	if d.transitions[base]--; d.transitions[base] <= 0 {
+		delete(d.transitions, base)
+	}
+}
@@ -0,0 +1,72 @@
+package opcae
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func transition(source string, cookie uint32, masks ...ChangeMask) *OnEventStruct {
+	return &OnEventStruct{
+		EventType:  uint32(OPC_CONDITION_EVENT),
+		Source:     source,
+		Condition:  "LEVEL",
+		Subcond:    "HI",
+		ChangeMask: masks,
+		ActiveTime: time.Unix(1000, 0),
+		Cookie:     cookie,
+	}
+}
+
+func TestDeduplicator_Filter(t *testing.T) {
+	d := NewDeduplicator(0)
+	activate := transition("Tank1", 1, OPC_CHANGE_ACTIVE_STATE, OPC_CHANGE_ACK_STATE)
+	events := []*OnEventStruct{activate, {EventType: uint32(OPC_SIMPLE_EVENT), Source: "Tank1"}}
+	assert.Equal(t, events, d.Filter(events, false))
+
+	again := []*OnEventStruct{
+		transition("Tank1", 1, OPC_CHANGE_ACK_STATE, OPC_CHANGE_ACTIVE_STATE),
+		{EventType: uint32(OPC_SIMPLE_EVENT), Source: "Tank1"},
+		transition("Tank1", 1, OPC_CHANGE_ACK_STATE),
+	}
+	filtered := d.Filter(again, false)
+	assert.Equal(t, again[1:], filtered, "the order of the change mask does not matter, simple events are kept")
+	assert.Equal(t, uint64(1), d.Suppressed())
+
+	assert.Empty(t, d.Filter([]*OnEventStruct{transition("Tank1", 1)}, true), "the refresh reports a known transition")
+	assert.Len(t, d.Filter([]*OnEventStruct{transition("Tank1", 2)}, true), 1)
+	assert.Len(t, d.Filter([]*OnEventStruct{transition("Tank2", 1)}, false), 1, "live events without change mask need an exact match")
+	assert.Equal(t, uint64(2), d.Suppressed())
+}
+
+func TestDeduplicator_Window(t *testing.T) {
+	d := NewDeduplicator(2)
+	d.Record([]*OnEventStruct{
+		transition("Tank1", 1, OPC_CHANGE_ACTIVE_STATE),
+		transition("Tank1", 1, OPC_CHANGE_ACK_STATE),
+		transition("Tank1", 1, OPC_CHANGE_ACK_STATE),
+	})
+	assert.Empty(t, d.Filter([]*OnEventStruct{transition("Tank1", 1, OPC_CHANGE_ACTIVE_STATE)}, false))
+	d.Record([]*OnEventStruct{transition("Tank2", 1, OPC_CHANGE_ACTIVE_STATE)})
+	assert.Len(t, d.Filter([]*OnEventStruct{transition("Tank1", 1, OPC_CHANGE_ACTIVE_STATE)}, false), 1, "the oldest transition was forgotten")
+	assert.Empty(t, d.Filter([]*OnEventStruct{transition("Tank1", 1)}, true))
+	assert.Len(t, d.ring, 2)
+	assert.Len(t, d.seen, 2)
+}
+
+func TestDeduplicator_RepeatedChange(t *testing.T) {
+	d := NewDeduplicator(0)
+	bad := transition("Tank1", 1, OPC_CHANGE_QUALITY)
+	bad.Time = time.Unix(2000, 0)
+	good := transition("Tank1", 1, OPC_CHANGE_QUALITY)
+	good.Time = time.Unix(2001, 0)
+	assert.Len(t, d.Filter([]*OnEventStruct{bad}, false), 1)
+	assert.Len(t, d.Filter([]*OnEventStruct{good}, false), 1, "a second quality change of the occurrence is a new transition")
+	assert.Empty(t, d.Filter([]*OnEventStruct{good}, false))
+
+	refresh := transition("Tank1", 1)
+	refresh.Time = good.Time
+	assert.Empty(t, d.Filter([]*OnEventStruct{refresh}, true), "the refresh reports the last transition with its time")
+	assert.Equal(t, uint64(2), d.Suppressed())
+}
@@ -0,0 +1,422 @@
+package opcae
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DeliveryPolicy decides what happens to an event notification when the receiver of a subscription is full
+type DeliveryPolicy int
+
+const (
+	// DeliverBlock waits until the receiver has room, the server's callback is blocked meanwhile
+	DeliverBlock DeliveryPolicy = iota
+	// DeliverBlockTimeout waits up to the delivery timeout, DefaultDeliveryTimeout unless WithDeliveryTimeout
+	// sets it, and drops the notification afterwards
+	DeliverBlockTimeout
+	// DeliverDropNewest drops the notification that does not fit
+	DeliverDropNewest
+	// DeliverDropOldest drops the oldest notification in the receiver to make room
+	DeliverDropOldest
+	// DeliverSpill queues the notification in an unbounded queue that is drained into the receiver
+	DeliverSpill
+)
+
+// DefaultDeliveryTimeout is how long DeliverBlockTimeout waits without WithDeliveryTimeout
+const DefaultDeliveryTimeout = time.Second
+
+func (p DeliveryPolicy) String() string {
+	switch p {
+	case DeliverBlock:
+		return "block"
+	case DeliverBlockTimeout:
+		return "block-timeout"
+	case DeliverDropNewest:
+		return "drop-newest"
+	case DeliverDropOldest:
+		return "drop-oldest"
+	case DeliverSpill:
+		return "spill"
+	}
+	return "unknown"
+}
+
+// DeliveryStats are the counters of a Dispatcher
+type DeliveryStats struct {
+	// Delivered notifications were put into the receiver and not evicted by DeliverDropOldest
+	Delivered uint64
+	// Dropped notifications were discarded because of the policy
+	Dropped uint64
+	// Delayed notifications found the receiver full and had to wait for room
+	Delayed uint64
+	// Filtered events were removed by the event filter of the subscription
+	Filtered uint64
+	// Duplicates are events suppressed by the deduplicator of the subscription
+	Duplicates uint64
+	// Queued is the current length of the spill queue, MaxQueued its high water mark
+	Queued    int
+	MaxQueued int
+}
+
+// SubscriptionOption configures a subscription created by CreateEventSubscription
+type SubscriptionOption func(*subscriptionOptions)
+
+type subscriptionOptions struct {
+	policy  DeliveryPolicy
+	timeout time.Duration
+	filter  *EventFilter
+	dedup   *Deduplicator
+	schema  *AttributeSchema
+}
+
+func newSubscriptionOptions(opts []SubscriptionOption) *subscriptionOptions {
+	o := &subscriptionOptions{policy: DeliverBlock}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithDeliveryPolicy sets the policy used when the receiver is full, the default is DeliverBlock
+func WithDeliveryPolicy(policy DeliveryPolicy) SubscriptionOption {
+	return func(o *subscriptionOptions) {
+		o.policy = policy
+	}
+}
+
+// WithDeliveryTimeout sets how long DeliverBlockTimeout waits for room in the receiver, timeouts that are not
+// positive keep DefaultDeliveryTimeout
+func WithDeliveryTimeout(timeout time.Duration) SubscriptionOption {
+	return func(o *subscriptionOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithEventFilter removes the events that do not pass filter before they are delivered, callbacks left
+// without events are dropped unless they are refresh or keep-alive callbacks
+func WithEventFilter(filter *EventFilter) SubscriptionOption {
+	return func(o *subscriptionOptions) {
+		o.filter = filter
+	}
+}
+
+// WithDeduplication suppresses duplicate condition events with a new Deduplicator that remembers window transitions
+func WithDeduplication(window int) SubscriptionOption {
+	return WithDeduplicator(NewDeduplicator(window))
+}
+
+// WithDeduplicator suppresses duplicate condition events with dedup, pass the same Deduplicator to the
+// subscription that replaces this one after a reconnect.
+// The events of RefreshAndWait are recorded but never suppressed, they are a complete snapshot. Refresh events
+// read from the receiver are suppressed, so a Handler that relies on complete refreshes must not be combined
+// with deduplication, ConditionCache.Sync uses RefreshAndWait and is not affected.
+func WithDeduplicator(dedup *Deduplicator) SubscriptionOption {
+	return func(o *subscriptionOptions) {
+		o.dedup = dedup
+	}
+}
+
+// WithAttributeSchema annotates the events with the attributes selected through schema before they are
+// filtered. It is used by implementations of EventSubscription.
+func WithAttributeSchema(schema *AttributeSchema) SubscriptionOption {
+	return func(o *subscriptionOptions) {
+		o.schema = schema
+	}
+}
+
+// NewSubscriptionDispatcher returns a dispatcher for receiver configured by the subscription options.
+// It is used by implementations of EventSubscription.
+func NewSubscriptionDispatcher(receiver chan *EventSinkOnEventData, opts ...SubscriptionOption) *Dispatcher {
+	return newDispatcher(receiver, newSubscriptionOptions(opts))
+}
+
+func newDispatcher(receiver chan *EventSinkOnEventData, o *subscriptionOptions) *Dispatcher {
+	d := NewDispatcher(receiver, o.policy, o.timeout)
+	d.filter = o.filter
+	d.dedup = o.dedup
+	d.schema = o.schema
+	return d
+}
+
+// Dispatcher puts event notifications into the receiver of a subscription according to a DeliveryPolicy.
+// Deliver is called on the server's callback thread, only DeliverBlock can block it indefinitely.
+type Dispatcher struct {
+	receiver chan *EventSinkOnEventData
+	policy   DeliveryPolicy
+	timeout  time.Duration
+	filter   *EventFilter
+	dedup    *Deduplicator
+	schema   *AttributeSchema
+
+	delivered atomic.Uint64
+	dropped   atomic.Uint64
+	delayed   atomic.Uint64
+	filtered  atomic.Uint64
+	duplicate atomic.Uint64
+
+	// refresh diverts refresh callbacks while RefreshAndWait runs
+	refresh atomic.Pointer[refreshCollector]
+
+	// lock serializes DeliverDropOldest and guards the spill queue
+	lock      sync.Mutex
+	queue     []*EventSinkOnEventData
+	maxQueued int
+	wake      chan struct{}
+	// sending is held shared by every Deliver, Close takes it exclusively before closing the receiver
+	sending   sync.RWMutex
+	done      chan struct{}
+	drained   chan struct{}
+	closeOnce sync.Once
+}
+
+// NewDispatcher returns a dispatcher that delivers into receiver with policy, timeout is the wait of
+// DeliverBlockTimeout and DefaultDeliveryTimeout when it is not positive
+func NewDispatcher(receiver chan *EventSinkOnEventData, policy DeliveryPolicy, timeout time.Duration) *Dispatcher {
+	if timeout <= 0 {
+		timeout = DefaultDeliveryTimeout
+	}
+	d := &Dispatcher{
+		receiver: receiver,
+		policy:   policy,
+		timeout:  timeout,
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		drained:  make(chan struct{}),
+	}
+	if policy == DeliverSpill {
+		go d.drain()
+	} else {
+		close(d.drained)
+	}
+	return d
+}
+
+func (d *Dispatcher) Policy() DeliveryPolicy {
+	return d.policy
+}
+
+// Deliver hands the notification to the receiver, notifications delivered after Close are dropped
+func (d *Dispatcher) Deliver(data *EventSinkOnEventData) {
+	d.sending.RLock()
+	defer d.sending.RUnlock()
+	select {
+	case <-d.done:
+		d.dropped.Add(1)
+		return
+	default:
+	}
+	if d.schema != nil {
+		d.schema.Annotate(data.Events)
+	}
+	if d.filter != nil && len(data.Events) != 0 {
+		events := d.filter.Filter(data.Events)
+		d.filtered.Add(uint64(len(data.Events) - len(events)))
+		if data = withEvents(data, events); data == nil {
+			return
+		}
+	}
+	c := d.refresh.Load()
+	collect := c != nil && (data.Refresh || data.LastRefresh)
+	if d.dedup != nil && len(data.Events) != 0 {
+		if collect {
+			d.dedup.Record(data.Events)
+		} else {
+			events := d.dedup.Filter(data.Events, data.Refresh)
+			d.duplicate.Add(uint64(len(data.Events) - len(events)))
+			if data = withEvents(data, events); data == nil {
+				return
+			}
+		}
+	}
+	if collect {
+		c.add(data)
+		if data.LastRefresh {
+			d.refresh.CompareAndSwap(c, nil)
+		}
+		d.delivered.Add(1)
+		return
+	}
+	switch d.policy {
+	case DeliverBlockTimeout:
+		d.deliverTimeout(data)
+	case DeliverDropNewest:
+		d.deliverDropNewest(data)
+	case DeliverDropOldest:
+		d.deliverDropOldest(data)
+	case DeliverSpill:
+		d.spill(data)
+	default:
+		d.deliverBlock(data)
+	}
+}
+
+// withEvents returns data with its events replaced, or nil when no events are left and the callback does
+// not need to be delivered without them
+func withEvents(data *EventSinkOnEventData, events []*OnEventStruct) *EventSinkOnEventData {
+	if len(events) == len(data.Events) {
+		return data
+	}
+	if len(events) == 0 && !data.Refresh && !data.LastRefresh && !data.KeepAlive {
+		return nil
+	}
+	result := *data
+	result.Events = events
+	return &result
+}
+
+func (d *Dispatcher) deliverBlock(data *EventSinkOnEventData) {
+	select {
+	case d.receiver <- data:
+		d.delivered.Add(1)
+		return
+	default:
+	}
+	d.delayed.Add(1)
+	select {
+	case d.receiver <- data:
+		d.delivered.Add(1)
+	case <-d.done:
+		d.dropped.Add(1)
+	}
+}
+
+func (d *Dispatcher) deliverTimeout(data *EventSinkOnEventData) {
+	select {
+	case d.receiver <- data:
+		d.delivered.Add(1)
+		return
+	default:
+	}
+	d.delayed.Add(1)
+	timer := time.NewTimer(d.timeout)
+	defer timer.Stop()
+	select {
+	case d.receiver <- data:
+		d.delivered.Add(1)
+	case <-timer.C:
+		d.dropped.Add(1)
+	case <-d.done:
+		d.dropped.Add(1)
+	}
+}
+
+func (d *Dispatcher) deliverDropNewest(data *EventSinkOnEventData) {
+	select {
+	case d.receiver <- data:
+		d.delivered.Add(1)
+	default:
+		d.dropped.Add(1)
+	}
+}
+
+func (d *Dispatcher) deliverDropOldest(data *EventSinkOnEventData) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	for {
+		select {
+		case d.receiver <- data:
+			d.delivered.Add(1)
+			return
+		default:
+		}
+		select {
+		case <-d.receiver:
+			// the evicted notification was counted as delivered when it was put into the receiver
+			d.delivered.Add(^uint64(0))
+			d.dropped.Add(1)
+		default:
+			// an unbuffered receiver without a waiting consumer has nothing to drop
+			if cap(d.receiver) == 0 {
+				d.dropped.Add(1)
+				return
+			}
+		}
+	}
+}
+
+func (d *Dispatcher) spill(data *EventSinkOnEventData) {
+	d.lock.Lock()
+	select {
+	case <-d.done:
+		d.lock.Unlock()
+		d.dropped.Add(1)
+		return
+	default:
+	}
+	d.queue = append(d.queue, data)
+	if len(d.queue) > d.maxQueued {
+		d.maxQueued = len(d.queue)
+	}
+	d.lock.Unlock()
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// drain moves the spill queue into the receiver in order
+func (d *Dispatcher) drain() {
+	defer close(d.drained)
+	for {
+		d.lock.Lock()
+		if len(d.queue) == 0 {
+			d.lock.Unlock()
+			select {
+			case <-d.wake:
+				continue
+			case <-d.done:
+				return
+			}
+		}
+		data := d.queue[0]
+		d.queue[0] = nil
+		d.queue = d.queue[1:]
+		d.lock.Unlock()
+		select {
+		case d.receiver <- data:
+			d.delivered.Add(1)
+			continue
+		default:
+		}
+		d.delayed.Add(1)
+		select {
+		case d.receiver <- data:
+			d.delivered.Add(1)
+		case <-d.done:
+			d.dropped.Add(1)
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) Stats() DeliveryStats {
+	d.lock.Lock()
+	queued, maxQueued := len(d.queue), d.maxQueued
+	d.lock.Unlock()
+	return DeliveryStats{
+		Delivered:  d.delivered.Load(),
+		Dropped:    d.dropped.Load(),
+		Delayed:    d.delayed.Load(),
+		Filtered:   d.filtered.Load(),
+		Duplicates: d.duplicate.Load(),
+		Queued:     queued,
+		MaxQueued:  maxQueued,
+	}
+}
+
+// Close unblocks pending deliveries and stops draining the spill queue, queued notifications are dropped.
+// The receiver is closed once no delivery is running, notifications already in it can still be read.
+func (d *Dispatcher) Close() {
+	d.closeOnce.Do(func() {
+		close(d.done)
+		<-d.drained
+		d.lock.Lock()
+		d.dropped.Add(uint64(len(d.queue)))
+		d.queue = nil
+		d.lock.Unlock()
+		d.sending.Lock()
+		close(d.receiver)
+		d.sending.Unlock()
+	})
+}
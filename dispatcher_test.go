@@ -0,0 +1,243 @@
+package opcae
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestData(n int) *EventSinkOnEventData {
+	return &EventSinkOnEventData{ClientHandle: uint32(n)}
+}
+
+func TestDeliveryPolicy_String(t *testing.T) {
+	assert.Equal(t, "block", DeliverBlock.String())
+	assert.Equal(t, "spill", DeliverSpill.String())
+	assert.Equal(t, "unknown", DeliveryPolicy(100).String())
+}
+
+func TestDispatcher_Block(t *testing.T) {
+	receiver := make(chan *EventSinkOnEventData, 1)
+	d := NewSubscriptionDispatcher(receiver)
+	defer d.Close()
+	assert.Equal(t, DeliverBlock, d.Policy())
+	d.Deliver(newTestData(1))
+	delivered := make(chan struct{})
+	go func() {
+		d.Deliver(newTestData(2))
+		close(delivered)
+	}()
+	select {
+	case <-delivered:
+		t.Fatal("deliver did not block on a full receiver")
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.Equal(t, uint32(1), (<-receiver).ClientHandle)
+	<-delivered
+	assert.Equal(t, uint32(2), (<-receiver).ClientHandle)
+	assert.Equal(t, DeliveryStats{Delivered: 2, Delayed: 1}, d.Stats())
+}
+
+func TestDispatcher_CloseUnblocks(t *testing.T) {
+	receiver := make(chan *EventSinkOnEventData)
+	d := NewDispatcher(receiver, DeliverBlock, 0)
+	delivered := make(chan struct{})
+	go func() {
+		d.Deliver(newTestData(1))
+		close(delivered)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	d.Close()
+	d.Close()
+	<-delivered
+	d.Deliver(newTestData(2))
+	assert.Equal(t, DeliveryStats{Dropped: 2, Delayed: 1}, d.Stats())
+	_, ok := <-receiver
+	assert.False(t, ok, "the receiver is closed")
+}
+
+func TestDispatcher_BlockTimeout(t *testing.T) {
+	receiver := make(chan *EventSinkOnEventData, 1)
+	d := NewSubscriptionDispatcher(receiver, WithDeliveryPolicy(DeliverBlockTimeout), WithDeliveryTimeout(10*time.Millisecond))
+	defer d.Close()
+	d.Deliver(newTestData(1))
+	start := time.Now()
+	d.Deliver(newTestData(2))
+	assert.GreaterOrEqual(t, time.Since(start), 10*time.Millisecond)
+	assert.Equal(t, uint32(1), (<-receiver).ClientHandle)
+	assert.Equal(t, DeliveryStats{Delivered: 1, Dropped: 1, Delayed: 1}, d.Stats())
+}
+
+func TestDispatcher_BlockTimeoutDefault(t *testing.T) {
+	receiver := make(chan *EventSinkOnEventData, 1)
+	d := NewSubscriptionDispatcher(receiver, WithDeliveryPolicy(DeliverBlockTimeout))
+	defer d.Close()
+	d.Deliver(newTestData(1))
+	delivered := make(chan struct{})
+	go func() {
+		d.Deliver(newTestData(2))
+		close(delivered)
+	}()
+	// the notification waits for room instead of being dropped at once
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, uint32(1), (<-receiver).ClientHandle)
+	<-delivered
+	assert.Equal(t, uint32(2), (<-receiver).ClientHandle)
+	assert.Equal(t, DeliveryStats{Delivered: 2, Delayed: 1}, d.Stats())
+}
+
+func TestDispatcher_DropNewest(t *testing.T) {
+	receiver := make(chan *EventSinkOnEventData, 2)
+	d := NewSubscriptionDispatcher(receiver, WithDeliveryPolicy(DeliverDropNewest))
+	defer d.Close()
+	for i := 1; i <= 5; i++ {
+		d.Deliver(newTestData(i))
+	}
+	assert.Equal(t, uint32(1), (<-receiver).ClientHandle)
+	assert.Equal(t, uint32(2), (<-receiver).ClientHandle)
+	assert.Equal(t, DeliveryStats{Delivered: 2, Dropped: 3}, d.Stats())
+}
+
+func TestDispatcher_DropOldest(t *testing.T) {
+	receiver := make(chan *EventSinkOnEventData, 2)
+	d := NewSubscriptionDispatcher(receiver, WithDeliveryPolicy(DeliverDropOldest))
+	defer d.Close()
+	for i := 1; i <= 5; i++ {
+		d.Deliver(newTestData(i))
+	}
+	assert.Equal(t, uint32(4), (<-receiver).ClientHandle)
+	assert.Equal(t, uint32(5), (<-receiver).ClientHandle)
+	assert.Equal(t, DeliveryStats{Delivered: 2, Dropped: 3}, d.Stats())
+
+	unbuffered := NewDispatcher(make(chan *EventSinkOnEventData), DeliverDropOldest, 0)
+	defer unbuffered.Close()
+	unbuffered.Deliver(newTestData(1))
+	assert.Equal(t, DeliveryStats{Dropped: 1}, unbuffered.Stats())
+}
+
+func TestDispatcher_Spill(t *testing.T) {
+	receiver := make(chan *EventSinkOnEventData, 1)
+	d := NewSubscriptionDispatcher(receiver, WithDeliveryPolicy(DeliverSpill))
+	defer d.Close()
+	for i := 1; i <= 100; i++ {
+		d.Deliver(newTestData(i))
+	}
+	for i := 1; i <= 100; i++ {
+		assert.Equal(t, uint32(i), (<-receiver).ClientHandle)
+	}
+	assert.Eventually(t, func() bool {
+		return d.Stats().Delivered == 100
+	}, time.Second, time.Millisecond)
+	stats := d.Stats()
+	assert.Zero(t, stats.Queued)
+	assert.Greater(t, stats.MaxQueued, 0)
+	assert.Zero(t, stats.Dropped)
+}
+
+func TestDispatcher_SpillClose(t *testing.T) {
+	receiver := make(chan *EventSinkOnEventData)
+	d := NewDispatcher(receiver, DeliverSpill, 0)
+	for i := 1; i <= 10; i++ {
+		d.Deliver(newTestData(i))
+	}
+	d.Close()
+	d.Deliver(newTestData(11))
+	stats := d.Stats()
+	assert.Zero(t, stats.Queued)
+	assert.Equal(t, uint64(11), stats.Dropped+stats.Delivered)
+}
+
+// TestDispatcher_Stress delivers from several goroutines with a slow consumer and checks that nothing is lost or counted twice
+func TestDispatcher_Stress(t *testing.T) {
+	const producers, perProducer = 4, 500
+	for _, policy := range []DeliveryPolicy{DeliverBlock, DeliverBlockTimeout, DeliverDropNewest, DeliverDropOldest, DeliverSpill} {
+		t.Run(policy.String(), func(t *testing.T) {
+			receiver := make(chan *EventSinkOnEventData, 8)
+			d := NewDispatcher(receiver, policy, time.Millisecond)
+			var received uint64
+			consumed := make(chan struct{})
+			go func() {
+				defer close(consumed)
+				for range receiver {
+					received++
+					if received%50 == 0 {
+						time.Sleep(time.Millisecond)
+					}
+				}
+			}()
+			var wg sync.WaitGroup
+			for p := 0; p < producers; p++ {
+				wg.Add(1)
+				go func(p int) {
+					defer wg.Done()
+					for i := 0; i < perProducer; i++ {
+						d.Deliver(newTestData(p*perProducer + i))
+					}
+				}(p)
+			}
+			wg.Wait()
+			assert.Eventually(t, func() bool {
+				return d.Stats().Queued == 0
+			}, 5*time.Second, time.Millisecond)
+			d.Close()
+			<-consumed
+			stats := d.Stats()
+			assert.Equal(t, uint64(producers*perProducer), stats.Delivered+stats.Dropped)
+			assert.Equal(t, stats.Delivered, received)
+			if policy == DeliverBlock || policy == DeliverSpill {
+				assert.Zero(t, stats.Dropped)
+			}
+		})
+	}
+}
+
+func TestDispatcher_EventFilter(t *testing.T) {
+	filter, err := CompileEventFilter(`severity >= 500`, nil)
+	assert.NoError(t, err)
+	receiver := make(chan *EventSinkOnEventData, 10)
+	d := NewSubscriptionDispatcher(receiver, WithEventFilter(filter))
+	defer d.Close()
+	d.Deliver(&EventSinkOnEventData{Events: []*OnEventStruct{{Severity: 100}, {Severity: 600}}})
+	d.Deliver(&EventSinkOnEventData{Events: []*OnEventStruct{{Severity: 100}}})
+	d.Deliver(&EventSinkOnEventData{Refresh: true, LastRefresh: true, Events: []*OnEventStruct{{Severity: 200}}})
+	d.Deliver(&EventSinkOnEventData{KeepAlive: true, Events: []*OnEventStruct{}})
+	data := <-receiver
+	assert.Len(t, data.Events, 1)
+	assert.Equal(t, uint32(600), data.Events[0].Severity)
+	data = <-receiver
+	assert.True(t, data.LastRefresh)
+	assert.Empty(t, data.Events)
+	assert.True(t, (<-receiver).KeepAlive)
+	assert.Empty(t, receiver)
+	assert.Equal(t, DeliveryStats{Delivered: 3, Filtered: 3}, d.Stats())
+}
+
+func TestDispatcher_Deduplication(t *testing.T) {
+	receiver := make(chan *EventSinkOnEventData, 10)
+	dedup := NewDeduplicator(10)
+	d := NewSubscriptionDispatcher(receiver, WithDeduplicator(dedup))
+	defer d.Close()
+	refresh := func() error {
+		go d.Deliver(&EventSinkOnEventData{Refresh: true, LastRefresh: true, Events: []*OnEventStruct{transition("Tank1", 1)}})
+		return nil
+	}
+	for i := 0; i < 2; i++ {
+		events, err := d.RefreshAndWait(context.Background(), refresh, nil)
+		assert.NoError(t, err)
+		assert.Len(t, events, 1, "RefreshAndWait is never deduplicated")
+	}
+
+	d.Deliver(&EventSinkOnEventData{Events: []*OnEventStruct{transition("Tank1", 2, OPC_CHANGE_ACTIVE_STATE)}})
+	d.Deliver(&EventSinkOnEventData{Events: []*OnEventStruct{transition("Tank1", 2, OPC_CHANGE_ACTIVE_STATE)}})
+	d.Deliver(&EventSinkOnEventData{Refresh: true, LastRefresh: true, Events: []*OnEventStruct{transition("Tank1", 1), transition("Tank1", 2)}})
+	assert.Len(t, (<-receiver).Events, 1)
+	data := <-receiver
+	assert.True(t, data.LastRefresh)
+	assert.Empty(t, data.Events)
+	assert.Empty(t, receiver)
+	assert.Equal(t, uint64(3), d.Stats().Duplicates)
+	assert.Equal(t, uint64(3), dedup.Suppressed())
+}
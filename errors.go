@@ -0,0 +1,232 @@
+package opcae
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+)
+
+// ErrEventServer2NotSupported is returned by methods that need IOPCEventServer2 when the server only implements IOPCEventServer
+var ErrEventServer2NotSupported = errors.New("opcae: server does not support IOPCEventServer2")
+
+// ErrSubscriptionMgt2NotSupported is returned by the keep-alive methods when the server only implements IOPCEventSubscriptionMgt
+var ErrSubscriptionMgt2NotSupported = errors.New("opcae: server does not support IOPCEventSubscriptionMgt2")
+
+// ErrServerShutdown is reported to a Handler when the server requested a shutdown or the client disconnected
+var ErrServerShutdown = errors.New("opcae: server is shutting down")
+
+// ErrSubscriptionReleased is returned by RefreshAndWait when the subscription is released while it waits
+var ErrSubscriptionReleased = errors.New("opcae: subscription is released")
+
+// ErrNoAttributeSchema is returned by SelectReturnedAttributesByName when the subscription was created without AttributeSchema
+var ErrNoAttributeSchema = errors.New("opcae: subscription has no attribute schema")
+
+// Sentinel errors for the OPC AE result codes, use errors.Is to test an error against them.
+// Only Code is compared, Op and Item of the sentinels are empty.
+var (
+	ErrAlreadyAcked         = &OPCError{Code: OPC_S_ALREADYACKED}
+	ErrInvalidBufferTime    = &OPCError{Code: OPC_S_INVALIDBUFFERTIME}
+	ErrInvalidMaxSize       = &OPCError{Code: OPC_S_INVALIDMAXSIZE}
+	ErrInvalidKeepAliveTime = &OPCError{Code: OPC_S_INVALIDKEEPALIVETIME}
+	ErrInvalidBranchName    = &OPCError{Code: OPC_E_INVALIDBRANCHNAME}
+	ErrInvalidTime          = &OPCError{Code: OPC_E_INVALIDTIME}
+	ErrBusy                 = &OPCError{Code: OPC_E_BUSY}
+	ErrNoInfo               = &OPCError{Code: OPC_E_NOINFO}
+)
+
+// OPCError is an HRESULT returned by an OPC AE call.
+// Op is the name of the operation, Item is the area, source or condition the result applies to when the
+// operation handles several items, and Message is the server's description from IOPCCommon::GetErrorString.
+type OPCError struct {
+	Code    uint32
+	Op      string
+	Item    string
+	Message string
+}
+
+func NewOPCError(op, item string, code uint32) *OPCError {
+	return &OPCError{Code: code, Op: op, Item: item}
+}
+
+func (e *OPCError) Error() string {
+	var b strings.Builder
+	b.WriteString("opcae: ")
+	if e.Op != "" {
+		b.WriteString(e.Op)
+		if e.Item != "" {
+			fmt.Fprintf(&b, " %q", e.Item)
+		}
+		b.WriteString(": ")
+	}
+	fmt.Fprintf(&b, "HRESULT 0x%08X", e.Code)
+	if name := CodeName(e.Code); name != "" {
+		b.WriteString(" ")
+		b.WriteString(name)
+	}
+	message := e.Message
+	if message == "" {
+		message = codeDescriptions[e.Code]
+	}
+	if message != "" {
+		b.WriteString(": ")
+		b.WriteString(message)
+	}
+	return b.String()
+}
+
+// Is reports whether target is an *OPCError or a syscall.Errno with the same code
+func (e *OPCError) Is(target error) bool {
+	switch t := target.(type) {
+	case *OPCError:
+		return t.Code == e.Code
+	case syscall.Errno:
+		return uint32(t) == e.Code
+	}
+	return false
+}
+
+// Success reports whether the code is an informational success code such as OPC_S_ALREADYACKED
+func (e *OPCError) Success() bool {
+	return int32(e.Code) >= 0
+}
+
+// Retryable reports whether repeating the call later may succeed
+func (e *OPCError) Retryable() bool {
+	return retryableCodes[e.Code]
+}
+
+// Retryable reports whether err is an OPC AE error that may succeed when the call is repeated later
+func Retryable(err error) bool {
+	var e *OPCError
+	if errors.As(err, &e) {
+		return e.Retryable()
+	}
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		return retryableCodes[uint32(errno)]
+	}
+	return false
+}
+
+// Succeeded reports whether err is nil or an informational success code, e.g. OPC_S_INVALIDBUFFERTIME
+// returned together with the revised value when the server did not accept the requested one
+func Succeeded(err error) bool {
+	if err == nil {
+		return true
+	}
+	var e *OPCError
+	return errors.As(err, &e) && e.Success()
+}
+
+// ConnectionLost reports whether err means the connection to the server is lost and the server must be
+// connected again, e.g. RPC_S_SERVER_UNAVAILABLE after the server process died
+func ConnectionLost(err error) bool {
+	var e *OPCError
+	if errors.As(err, &e) {
+		return connectionLostCodes[e.Code]
+	}
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		return connectionLostCodes[uint32(errno)]
+	}
+	return false
+}
+
+// CodeName returns the symbolic name of a known HRESULT, or an empty string
+func CodeName(code uint32) string {
+	return codeNames[code]
+}
+
+// wrapError converts an HRESULT returned as syscall.Errno to an *OPCError.
+// Other errors, including errnos that are not HRESULTs such as syscall.EINVAL,
+// are returned unchanged, a nil error stays nil.
+func wrapError(op, item string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *OPCError
+	if errors.As(err, &e) {
+		return err
+	}
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return err
+	}
+	if int32(errno) >= 0 && !successCodes[uint32(errno)] {
+		return err
+	}
+	return NewOPCError(op, item, uint32(errno))
+}
+
+// successError converts the HRESULT of a call that succeeded to an informational *OPCError,
+// S_OK returns nil
+func successError(op, item string, hr uint32) error {
+	if hr == 0 || int32(hr) < 0 {
+		return nil
+	}
+	return NewOPCError(op, item, hr)
+}
+
+var codeNames = map[uint32]string{
+	OPC_S_ALREADYACKED:          "OPC_S_ALREADYACKED",
+	OPC_S_INVALIDBUFFERTIME:     "OPC_S_INVALIDBUFFERTIME",
+	OPC_S_INVALIDMAXSIZE:        "OPC_S_INVALIDMAXSIZE",
+	OPC_S_INVALIDKEEPALIVETIME:  "OPC_S_INVALIDKEEPALIVETIME",
+	OPC_E_INVALIDBRANCHNAME:     "OPC_E_INVALIDBRANCHNAME",
+	OPC_E_INVALIDTIME:           "OPC_E_INVALIDTIME",
+	OPC_E_BUSY:                  "OPC_E_BUSY",
+	OPC_E_NOINFO:                "OPC_E_NOINFO",
+	S_FALSE:                     "S_FALSE",
+	E_NOTIMPL:                   "E_NOTIMPL",
+	E_NOINTERFACE:               "E_NOINTERFACE",
+	E_FAIL:                      "E_FAIL",
+	E_ACCESSDENIED:              "E_ACCESSDENIED",
+	E_OUTOFMEMORY:               "E_OUTOFMEMORY",
+	E_INVALIDARG:                "E_INVALIDARG",
+	CONNECT_E_NOCONNECTION:      "CONNECT_E_NOCONNECTION",
+	CO_E_OBJNOTCONNECTED:        "CO_E_OBJNOTCONNECTED",
+	RPC_E_CALL_REJECTED:         "RPC_E_CALL_REJECTED",
+	RPC_E_DISCONNECTED:          "RPC_E_DISCONNECTED",
+	RPC_E_SERVERCALL_RETRYLATER: "RPC_E_SERVERCALL_RETRYLATER",
+	RPC_S_SERVER_UNAVAILABLE:    "RPC_S_SERVER_UNAVAILABLE",
+	RPC_S_CALL_FAILED:           "RPC_S_CALL_FAILED",
+	RPC_S_CALL_FAILED_DNE:       "RPC_S_CALL_FAILED_DNE",
+}
+
+var codeDescriptions = map[uint32]string{
+	OPC_S_ALREADYACKED:         "The condition has already been acknowledged",
+	OPC_S_INVALIDBUFFERTIME:    "The buffer time parameter was invalid",
+	OPC_S_INVALIDMAXSIZE:       "The max size parameter was invalid",
+	OPC_S_INVALIDKEEPALIVETIME: "The keep-alive time parameter was invalid",
+	OPC_E_INVALIDBRANCHNAME:    "The string was not recognized as an area name",
+	OPC_E_INVALIDTIME:          "The time does not match the latest active time",
+	OPC_E_BUSY:                 "A refresh is currently in progress",
+	OPC_E_NOINFO:               "Information is not available",
+}
+
+var successCodes = map[uint32]bool{
+	OPC_S_ALREADYACKED:         true,
+	OPC_S_INVALIDBUFFERTIME:    true,
+	OPC_S_INVALIDMAXSIZE:       true,
+	OPC_S_INVALIDKEEPALIVETIME: true,
+}
+
+var retryableCodes = map[uint32]bool{
+	OPC_E_BUSY:                  true,
+	CO_E_OBJNOTCONNECTED:        true,
+	RPC_E_CALL_REJECTED:         true,
+	RPC_E_DISCONNECTED:          true,
+	RPC_E_SERVERCALL_RETRYLATER: true,
+	RPC_S_SERVER_UNAVAILABLE:    true,
+	RPC_S_CALL_FAILED:           true,
+	RPC_S_CALL_FAILED_DNE:       true,
+}
+
+var connectionLostCodes = map[uint32]bool{
+	CO_E_OBJNOTCONNECTED:     true,
+	RPC_E_DISCONNECTED:       true,
+	RPC_S_SERVER_UNAVAILABLE: true,
+	RPC_S_CALL_FAILED:        true,
+	RPC_S_CALL_FAILED_DNE:    true,
+}
@@ -0,0 +1,105 @@
+package opcae
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOPCError_Is(t *testing.T) {
+	err := NewOPCError("Refresh", "", OPC_E_BUSY)
+	assert.ErrorIs(t, err, ErrBusy)
+	assert.ErrorIs(t, err, syscall.Errno(OPC_E_BUSY))
+	assert.NotErrorIs(t, err, ErrNoInfo)
+	wrapped := fmt.Errorf("refresh subscription: %w", err)
+	assert.ErrorIs(t, wrapped, ErrBusy)
+	var opcErr *OPCError
+	assert.ErrorAs(t, wrapped, &opcErr)
+	assert.Equal(t, "Refresh", opcErr.Op)
+}
+
+func TestOPCError_Error(t *testing.T) {
+	tests := []struct {
+		err  *OPCError
+		want string
+	}{
+		{
+			err:  &OPCError{Code: OPC_E_INVALIDTIME, Op: "AckConditions", Item: "Tank1/Level"},
+			want: `opcae: AckConditions "Tank1/Level": HRESULT 0xC0040204 OPC_E_INVALIDTIME: The time does not match the latest active time`,
+		},
+		{
+			err:  &OPCError{Code: E_FAIL, Op: "GetStatus", Message: "server failure"},
+			want: `opcae: GetStatus: HRESULT 0x80004005 E_FAIL: server failure`,
+		},
+		{
+			err:  &OPCError{Code: 0x80041234},
+			want: `opcae: HRESULT 0x80041234`,
+		},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tt.err.Error())
+	}
+}
+
+func TestOPCError_Success(t *testing.T) {
+	assert.True(t, ErrAlreadyAcked.Success())
+	assert.True(t, ErrInvalidBufferTime.Success())
+	assert.True(t, ErrInvalidMaxSize.Success())
+	assert.True(t, ErrInvalidKeepAliveTime.Success())
+	assert.False(t, ErrInvalidBranchName.Success())
+	assert.False(t, ErrInvalidTime.Success())
+	assert.False(t, ErrBusy.Success())
+	assert.False(t, ErrNoInfo.Success())
+}
+
+func TestRetryable(t *testing.T) {
+	assert.True(t, Retryable(NewOPCError("Refresh", "", OPC_E_BUSY)))
+	assert.True(t, Retryable(fmt.Errorf("call: %w", NewOPCError("GetStatus", "", RPC_S_SERVER_UNAVAILABLE))))
+	assert.True(t, Retryable(syscall.Errno(RPC_E_DISCONNECTED)))
+	assert.False(t, Retryable(NewOPCError("AckConditions", "", OPC_E_INVALIDTIME)))
+	assert.False(t, Retryable(errors.New("other")))
+	assert.False(t, Retryable(nil))
+}
+
+func TestConnectionLost(t *testing.T) {
+	assert.True(t, ConnectionLost(fmt.Errorf("call: %w", NewOPCError("GetStatus", "", RPC_S_SERVER_UNAVAILABLE))))
+	assert.True(t, ConnectionLost(syscall.Errno(CO_E_OBJNOTCONNECTED)))
+	assert.False(t, ConnectionLost(NewOPCError("Refresh", "", OPC_E_BUSY)))
+	assert.False(t, ConnectionLost(errors.New("other")))
+	assert.False(t, ConnectionLost(nil))
+}
+
+func TestWrapError(t *testing.T) {
+	assert.NoError(t, wrapError("GetStatus", "", nil))
+	other := errors.New("other")
+	assert.Equal(t, other, wrapError("GetStatus", "", other))
+	err := wrapError("QuerySourceConditions", "Tank1", syscall.Errno(E_INVALIDARG))
+	var opcErr *OPCError
+	if assert.ErrorAs(t, err, &opcErr) {
+		assert.Equal(t, E_INVALIDARG, opcErr.Code)
+		assert.Equal(t, "QuerySourceConditions", opcErr.Op)
+		assert.Equal(t, "Tank1", opcErr.Item)
+	}
+	assert.Same(t, err, wrapError("Other", "", err))
+	assert.Equal(t, syscall.EINVAL, wrapError("QuerySourceConditions", "", syscall.EINVAL))
+	assert.ErrorIs(t, wrapError("SetState", "", syscall.Errno(OPC_S_INVALIDBUFFERTIME)), ErrInvalidBufferTime)
+}
+
+func TestSucceeded(t *testing.T) {
+	assert.True(t, Succeeded(nil))
+	assert.True(t, Succeeded(successError("SetKeepAlive", "", OPC_S_INVALIDKEEPALIVETIME)))
+	assert.False(t, Succeeded(NewOPCError("SetKeepAlive", "", E_INVALIDARG)))
+	assert.False(t, Succeeded(errors.New("other")))
+	assert.NoError(t, successError("SetKeepAlive", "", 0))
+	assert.NoError(t, successError("SetKeepAlive", "", E_FAIL))
+}
+
+func TestCodeName(t *testing.T) {
+	for code, name := range codeNames {
+		assert.Equal(t, name, CodeName(code))
+	}
+	assert.Empty(t, CodeName(0x80041234))
+}
@@ -0,0 +1,796 @@
+package opcae
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// EventFilter is a compiled client-side filter expression over the fields and attributes of an OnEventStruct.
+// It complements SetFilter for criteria the server does not support, see QueryAvailableFilters.
+//
+// An expression combines comparisons with &&, || and !, and parentheses:
+//
+//	severity >= 700 && source =~ "Boiler*" && !acked && attr["Operator"] == "A"
+//
+// Fields:
+//
+//	severity, category, quality, cookie                  numbers
+//	source, condition, subcondition, message, actor      strings
+//	eventtype                                            "simple", "tracking" or "condition"
+//	enabled, active, acked, ackreq                       booleans
+//
+// attr["name"] is the attribute returned by the AttributeLookup of the filter, attr[n] is the n-th value
+// of Attributes. Literals are numbers, Go quoted strings, true and false. The comparison operators are
+// ==, !=, <, <=, >, >=, and =~ and !~ that match a string against a pattern where * matches any sequence
+// and ? a single character. Comparing values of different types or a missing attribute is false.
+type EventFilter struct {
+	root   filterNode
+	lookup AttributeLookup
+}
+
+// AttributeLookup returns the value of the attribute named name of event, the bool is false when the event
+// has no such attribute
+type AttributeLookup func(event *OnEventStruct, name string) (interface{}, bool)
+
+// FilterSyntaxError is returned by CompileEventFilter, Pos is the byte offset of the error in the expression
+type FilterSyntaxError struct {
+	Expr string
+	Pos  int
+	Msg  string
+}
+
+func (e *FilterSyntaxError) Error() string {
+	return fmt.Sprintf("opcae: filter: %s at offset %d", e.Msg, e.Pos)
+}
+
+// CompileEventFilter compiles the expression, lookup resolves attr["name"], when it is nil the name is
+// looked up with OnEventStruct.Attribute
+func CompileEventFilter(expr string, lookup AttributeLookup) (*EventFilter, error) {
+	p := &filterParser{lexer: filterLexer{src: expr}}
+	root, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	return &EventFilter{root: root, lookup: lookup}, nil
+}
+
+// Match reports whether the event passes the filter
+func (f *EventFilter) Match(event *OnEventStruct) bool {
+	return f.root.eval(&filterContext{event: event, lookup: f.lookup}).isTrue()
+}
+
+// Filter returns the events that pass the filter, events is returned unchanged when all of them pass
+func (f *EventFilter) Filter(events []*OnEventStruct) []*OnEventStruct {
+	for i, event := range events {
+		if f.Match(event) {
+			continue
+		}
+		result := append([]*OnEventStruct(nil), events[:i]...)
+		for _, event := range events[i+1:] {
+			if f.Match(event) {
+				result = append(result, event)
+			}
+		}
+		return result
+	}
+	return events
+}
+
+// String returns the expression in a canonical form, it compiles to the same filter
+func (f *EventFilter) String() string {
+	var b strings.Builder
+	f.root.write(&b)
+	return b.String()
+}
+
+type filterType int
+
+const (
+	filterAny filterType = iota
+	filterBool
+	filterNumber
+	filterString
+)
+
+func (t filterType) String() string {
+	switch t {
+	case filterBool:
+		return "bool"
+	case filterNumber:
+		return "number"
+	case filterString:
+		return "string"
+	}
+	return "any"
+}
+
+// filterValue is the result of a node, a missing value has the type filterAny
+type filterValue struct {
+	typ filterType
+	b   bool
+	num float64
+	str string
+}
+
+func (v filterValue) isTrue() bool {
+	return v.typ == filterBool && v.b
+}
+
+func boolValue(b bool) filterValue {
+	return filterValue{typ: filterBool, b: b}
+}
+
+func numberValue(num float64) filterValue {
+	return filterValue{typ: filterNumber, num: num}
+}
+
+func stringValue(s string) filterValue {
+	return filterValue{typ: filterString, str: s}
+}
+
+// toFilterValue converts an attribute value
+func toFilterValue(v interface{}) filterValue {
+	switch v := v.(type) {
+	case bool:
+		return boolValue(v)
+	case string:
+		return stringValue(v)
+	case int:
+		return numberValue(float64(v))
+	case int8:
+		return numberValue(float64(v))
+	case int16:
+		return numberValue(float64(v))
+	case int32:
+		return numberValue(float64(v))
+	case int64:
+		return numberValue(float64(v))
+	case uint:
+		return numberValue(float64(v))
+	case uint8:
+		return numberValue(float64(v))
+	case uint16:
+		return numberValue(float64(v))
+	case uint32:
+		return numberValue(float64(v))
+	case uint64:
+		return numberValue(float64(v))
+	case float32:
+		return numberValue(float64(v))
+	case float64:
+		return numberValue(v)
+	}
+	return filterValue{}
+}
+
+type filterContext struct {
+	event  *OnEventStruct
+	lookup AttributeLookup
+}
+
+type filterNode interface {
+	eval(ctx *filterContext) filterValue
+	typ() filterType
+	// write appends the canonical form to b, the nodes share one builder so long expressions print in linear time
+	write(b *strings.Builder)
+}
+
+type literalNode struct {
+	value filterValue
+}
+
+func (n *literalNode) eval(*filterContext) filterValue {
+	return n.value
+}
+
+func (n *literalNode) typ() filterType {
+	return n.value.typ
+}
+
+func (n *literalNode) write(b *strings.Builder) {
+	switch n.value.typ {
+	case filterBool:
+		b.WriteString(strconv.FormatBool(n.value.b))
+	case filterNumber:
+		b.WriteString(strconv.FormatFloat(n.value.num, 'g', -1, 64))
+	default:
+		b.WriteString(strconv.Quote(n.value.str))
+	}
+}
+
+type filterField struct {
+	typ filterType
+	get func(event *OnEventStruct) filterValue
+}
+
+var filterFields = map[string]filterField{
+	"severity":     {filterNumber, func(e *OnEventStruct) filterValue { return numberValue(float64(e.Severity)) }},
+	"category":     {filterNumber, func(e *OnEventStruct) filterValue { return numberValue(float64(e.Category)) }},
+	"quality":      {filterNumber, func(e *OnEventStruct) filterValue { return numberValue(float64(e.Quality)) }},
+	"cookie":       {filterNumber, func(e *OnEventStruct) filterValue { return numberValue(float64(e.Cookie)) }},
+	"source":       {filterString, func(e *OnEventStruct) filterValue { return stringValue(e.Source) }},
+	"condition":    {filterString, func(e *OnEventStruct) filterValue { return stringValue(e.Condition) }},
+	"subcondition": {filterString, func(e *OnEventStruct) filterValue { return stringValue(e.Subcond) }},
+	"message":      {filterString, func(e *OnEventStruct) filterValue { return stringValue(e.Message) }},
+	"actor":        {filterString, func(e *OnEventStruct) filterValue { return stringValue(e.ActorID) }},
+	"eventtype": {filterString, func(e *OnEventStruct) filterValue {
+		switch EventCategoryType(e.EventType) {
+		case OPC_SIMPLE_EVENT:
+			return stringValue("simple")
+		case OPC_TRACKING_EVENT:
+			return stringValue("tracking")
+		case OPC_CONDITION_EVENT:
+			return stringValue("condition")
+		}
+		return stringValue("")
+	}},
+	"enabled": {filterBool, func(e *OnEventStruct) filterValue { return boolValue(e.NewState.IsEnabled()) }},
+	"active":  {filterBool, func(e *OnEventStruct) filterValue { return boolValue(e.NewState.IsActive()) }},
+	"acked":   {filterBool, func(e *OnEventStruct) filterValue { return boolValue(e.NewState.IsAcked()) }},
+	"ackreq":  {filterBool, func(e *OnEventStruct) filterValue { return boolValue(e.AckReq) }},
+}
+
+type fieldNode struct {
+	name  string
+	field filterField
+}
+
+func (n *fieldNode) eval(ctx *filterContext) filterValue {
+	return n.field.get(ctx.event)
+}
+
+func (n *fieldNode) typ() filterType {
+	return n.field.typ
+}
+
+func (n *fieldNode) write(b *strings.Builder) {
+	b.WriteString(n.name)
+}
+
+// attrNode is attr["name"] or attr[index]
+type attrNode struct {
+	name  string
+	index int
+	byPos bool
+}
+
+func (n *attrNode) eval(ctx *filterContext) filterValue {
+	if n.byPos {
+		if n.index >= len(ctx.event.Attributes) {
+			return filterValue{}
+		}
+		return toFilterValue(ctx.event.Attributes[n.index])
+	}
+	lookup := ctx.lookup
+	if lookup == nil {
+		lookup = (*OnEventStruct).Attribute
+	}
+	v, ok := lookup(ctx.event, n.name)
+	if !ok {
+		return filterValue{}
+	}
+	return toFilterValue(v)
+}
+
+func (n *attrNode) typ() filterType {
+	return filterAny
+}
+
+func (n *attrNode) write(b *strings.Builder) {
+	b.WriteString("attr[")
+	if n.byPos {
+		b.WriteString(strconv.Itoa(n.index))
+	} else {
+		b.WriteString(strconv.Quote(n.name))
+	}
+	b.WriteByte(']')
+}
+
+type notNode struct {
+	x filterNode
+}
+
+func (n *notNode) eval(ctx *filterContext) filterValue {
+	v := n.x.eval(ctx)
+	if v.typ != filterBool {
+		return filterValue{}
+	}
+	return boolValue(!v.b)
+}
+
+func (n *notNode) typ() filterType {
+	return filterBool
+}
+
+func (n *notNode) write(b *strings.Builder) {
+	b.WriteByte('!')
+	// ! binds looser than a comparison, !a == b is !(a == b)
+	_, logical := n.x.(*logicalNode)
+	writeNode(b, n.x, logical)
+}
+
+type logicalNode struct {
+	and  bool
+	l, r filterNode
+}
+
+func (n *logicalNode) eval(ctx *filterContext) filterValue {
+	l := n.l.eval(ctx).isTrue()
+	if n.and {
+		return boolValue(l && n.r.eval(ctx).isTrue())
+	}
+	return boolValue(l || n.r.eval(ctx).isTrue())
+}
+
+func (n *logicalNode) typ() filterType {
+	return filterBool
+}
+
+// write parenthesizes an || operand of && and a right operand of the same operator, the operators are left associative
+func (n *logicalNode) write(b *strings.Builder) {
+	left, ok := n.l.(*logicalNode)
+	writeNode(b, n.l, ok && n.and && !left.and)
+	if n.and {
+		b.WriteString(" && ")
+	} else {
+		b.WriteString(" || ")
+	}
+	right, ok := n.r.(*logicalNode)
+	writeNode(b, n.r, ok && (n.and || !right.and))
+}
+
+type compareNode struct {
+	op   string
+	l, r filterNode
+}
+
+func (n *compareNode) eval(ctx *filterContext) filterValue {
+	l, r := n.l.eval(ctx), n.r.eval(ctx)
+	if l.typ == filterAny || r.typ == filterAny {
+		return boolValue(false)
+	}
+	switch n.op {
+	case "=~", "!~":
+		if l.typ != filterString || r.typ != filterString {
+			return boolValue(false)
+		}
+		return boolValue(matchPattern(l.str, r.str) == (n.op == "=~"))
+	case "==":
+		return boolValue(l == r)
+	case "!=":
+		return boolValue(l != r)
+	}
+	var c int
+	switch {
+	case l.typ == filterNumber && r.typ == filterNumber:
+		switch {
+		case l.num < r.num:
+			c = -1
+		case l.num > r.num:
+			c = 1
+		case l.num != r.num:
+			// NaN is unordered
+			return boolValue(false)
+		}
+	case l.typ == filterString && r.typ == filterString:
+		c = strings.Compare(l.str, r.str)
+	default:
+		return boolValue(false)
+	}
+	switch n.op {
+	case "<":
+		return boolValue(c < 0)
+	case "<=":
+		return boolValue(c <= 0)
+	case ">":
+		return boolValue(c > 0)
+	}
+	return boolValue(c >= 0)
+}
+
+func (n *compareNode) typ() filterType {
+	return filterBool
+}
+
+func (n *compareNode) write(b *strings.Builder) {
+	writeOperand(b, n.l)
+	b.WriteString(" " + n.op + " ")
+	writeOperand(b, n.r)
+}
+
+func writeOperand(b *strings.Builder, n filterNode) {
+	switch n.(type) {
+	case *logicalNode, *compareNode, *notNode:
+		writeNode(b, n, true)
+	default:
+		n.write(b)
+	}
+}
+
+// writeNode writes n, in parentheses when paren is set
+func writeNode(b *strings.Builder, n filterNode, paren bool) {
+	if paren {
+		b.WriteByte('(')
+	}
+	n.write(b)
+	if paren {
+		b.WriteByte(')')
+	}
+}
+
+// matchPattern matches s against pattern, * matches any sequence of characters and ? a single character
+func matchPattern(s, pattern string) bool {
+	var star, next = -1, 0
+	i, j := 0, 0
+	for i < len(s) {
+		if j < len(pattern) && pattern[j] == '*' {
+			star, next = j, i
+			j++
+			continue
+		}
+		if j < len(pattern) && (pattern[j] == '?' || pattern[j] == s[i]) {
+			if pattern[j] == '?' {
+				_, size := utf8.DecodeRuneInString(s[i:])
+				i += size
+			} else {
+				i++
+			}
+			j++
+			continue
+		}
+		if star < 0 {
+			return false
+		}
+		// let the last * consume one more character
+		_, size := utf8.DecodeRuneInString(s[next:])
+		next += size
+		i, j = next, star+1
+	}
+	for j < len(pattern) && pattern[j] == '*' {
+		j++
+	}
+	return j == len(pattern)
+}
+
+type filterTokenKind int
+
+const (
+	tokenEOF filterTokenKind = iota
+	tokenIdent
+	tokenNumber
+	tokenString
+	tokenOperator
+)
+
+type filterToken struct {
+	kind filterTokenKind
+	text string
+	pos  int
+	num  float64
+}
+
+type filterLexer struct {
+	src string
+	pos int
+}
+
+var filterOperators = []string{"&&", "||", "==", "!=", "<=", ">=", "=~", "!~", "<", ">", "!", "(", ")", "[", "]"}
+
+func (l *filterLexer) next() (filterToken, error) {
+	for l.pos < len(l.src) && strings.IndexByte(" \t\r\n", l.src[l.pos]) >= 0 {
+		l.pos++
+	}
+	start := l.pos
+	if l.pos == len(l.src) {
+		return filterToken{kind: tokenEOF, pos: start}, nil
+	}
+	c := l.src[l.pos]
+	switch {
+	case isIdentStart(c):
+		for l.pos < len(l.src) && (isIdentStart(l.src[l.pos]) || isDigit(l.src[l.pos])) {
+			l.pos++
+		}
+		return filterToken{kind: tokenIdent, text: l.src[start:l.pos], pos: start}, nil
+	case isDigit(c) || (c == '-' && l.pos+1 < len(l.src) && isDigit(l.src[l.pos+1])):
+		l.pos++
+		for l.pos < len(l.src) {
+			c := l.src[l.pos]
+			if isDigit(c) || c == '.' || c == 'e' || c == 'E' ||
+				((c == '+' || c == '-') && (l.src[l.pos-1] == 'e' || l.src[l.pos-1] == 'E')) {
+				l.pos++
+				continue
+			}
+			break
+		}
+		text := l.src[start:l.pos]
+		num, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return filterToken{}, &FilterSyntaxError{Expr: l.src, Pos: start, Msg: fmt.Sprintf("invalid number %q", text)}
+		}
+		return filterToken{kind: tokenNumber, text: text, pos: start, num: num}, nil
+	case c == '"':
+		l.pos++
+		for l.pos < len(l.src) && l.src[l.pos] != '"' {
+			if l.src[l.pos] == '\\' {
+				l.pos++
+			}
+			l.pos++
+		}
+		if l.pos >= len(l.src) {
+			return filterToken{}, &FilterSyntaxError{Expr: l.src, Pos: start, Msg: "unterminated string"}
+		}
+		l.pos++
+		text, err := strconv.Unquote(l.src[start:l.pos])
+		if err != nil {
+			return filterToken{}, &FilterSyntaxError{Expr: l.src, Pos: start, Msg: "invalid string literal"}
+		}
+		return filterToken{kind: tokenString, text: text, pos: start}, nil
+	}
+	for _, op := range filterOperators {
+		if strings.HasPrefix(l.src[l.pos:], op) {
+			l.pos += len(op)
+			return filterToken{kind: tokenOperator, text: op, pos: start}, nil
+		}
+	}
+	r, _ := utf8.DecodeRuneInString(l.src[l.pos:])
+	return filterToken{}, &FilterSyntaxError{Expr: l.src, Pos: start, Msg: fmt.Sprintf("unexpected character %q", r)}
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// filterParser is a recursive descent parser:
+//
+//	or      = and { "||" and }
+//	and     = unary { "&&" unary }
+//	unary   = "!" unary | compare
+//	compare = operand [ op operand ]
+//	operand = field | "attr" "[" string | integer "]" | number | string | "true" | "false" | "(" or ")"
+type filterParser struct {
+	lexer filterLexer
+	tok   filterToken
+}
+
+// maxFilterDepth limits the nesting of parentheses and ! so that hostile input cannot exhaust the stack
+const maxFilterDepth = 100
+
+func (p *filterParser) parse() (filterNode, error) {
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	node, err := p.parseOr(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokenEOF {
+		return nil, p.errorf(p.tok.pos, "unexpected %s", p.describe())
+	}
+	if err := p.checkBool(node, 0); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+func (p *filterParser) advance() error {
+	tok, err := p.lexer.next()
+	if err != nil {
+		return err
+	}
+	p.tok = tok
+	return nil
+}
+
+func (p *filterParser) errorf(pos int, format string, args ...interface{}) error {
+	return &FilterSyntaxError{Expr: p.lexer.src, Pos: pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *filterParser) describe() string {
+	switch p.tok.kind {
+	case tokenEOF:
+		return "end of expression"
+	case tokenString:
+		return strconv.Quote(p.tok.text)
+	}
+	return "'" + p.tok.text + "'"
+}
+
+func (p *filterParser) isOperator(op string) bool {
+	return p.tok.kind == tokenOperator && p.tok.text == op
+}
+
+func (p *filterParser) checkBool(node filterNode, pos int) error {
+	if t := node.typ(); t != filterBool && t != filterAny {
+		return p.errorf(pos, "%s is not a condition", t)
+	}
+	return nil
+}
+
+func (p *filterParser) parseOr(depth int) (filterNode, error) {
+	pos := p.tok.pos
+	l, err := p.parseAnd(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("||") {
+		if err := p.checkBool(l, pos); err != nil {
+			return nil, err
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		pos = p.tok.pos
+		r, err := p.parseAnd(depth)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.checkBool(r, pos); err != nil {
+			return nil, err
+		}
+		l = &logicalNode{l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *filterParser) parseAnd(depth int) (filterNode, error) {
+	pos := p.tok.pos
+	l, err := p.parseUnary(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("&&") {
+		if err := p.checkBool(l, pos); err != nil {
+			return nil, err
+		}
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		pos = p.tok.pos
+		r, err := p.parseUnary(depth)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.checkBool(r, pos); err != nil {
+			return nil, err
+		}
+		l = &logicalNode{and: true, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *filterParser) parseUnary(depth int) (filterNode, error) {
+	if depth > maxFilterDepth {
+		return nil, p.errorf(p.tok.pos, "expression nested too deeply")
+	}
+	if p.isOperator("!") {
+		if err := p.advance(); err != nil {
+			return nil, err
+		}
+		pos := p.tok.pos
+		x, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.checkBool(x, pos); err != nil {
+			return nil, err
+		}
+		return &notNode{x: x}, nil
+	}
+	return p.parseCompare(depth)
+}
+
+func (p *filterParser) parseCompare(depth int) (filterNode, error) {
+	l, err := p.parseOperand(depth)
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokenOperator {
+		return l, nil
+	}
+	op, pos := p.tok.text, p.tok.pos
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=", "=~", "!~":
+	default:
+		return l, nil
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	r, err := p.parseOperand(depth)
+	if err != nil {
+		return nil, err
+	}
+	lt, rt := l.typ(), r.typ()
+	if lt != filterAny && rt != filterAny && lt != rt {
+		return nil, p.errorf(pos, "cannot compare %s with %s", lt, rt)
+	}
+	switch op {
+	case "=~", "!~":
+		if lt != filterString && lt != filterAny || rt != filterString && rt != filterAny {
+			return nil, p.errorf(pos, "%s needs strings", op)
+		}
+	case "<", "<=", ">", ">=":
+		if lt == filterBool || rt == filterBool {
+			return nil, p.errorf(pos, "%s cannot order booleans", op)
+		}
+	}
+	return &compareNode{op: op, l: l, r: r}, nil
+}
+
+func (p *filterParser) parseOperand(depth int) (filterNode, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokenNumber:
+		return &literalNode{value: numberValue(tok.num)}, p.advance()
+	case tokenString:
+		return &literalNode{value: stringValue(tok.text)}, p.advance()
+	case tokenIdent:
+		switch tok.text {
+		case "true", "false":
+			return &literalNode{value: boolValue(tok.text == "true")}, p.advance()
+		case "attr":
+			return p.parseAttr()
+		}
+		field, ok := filterFields[tok.text]
+		if !ok {
+			return nil, p.errorf(tok.pos, "unknown field %q", tok.text)
+		}
+		return &fieldNode{name: tok.text, field: field}, p.advance()
+	case tokenOperator:
+		if tok.text == "(" {
+			if depth > maxFilterDepth {
+				return nil, p.errorf(tok.pos, "expression nested too deeply")
+			}
+			if err := p.advance(); err != nil {
+				return nil, err
+			}
+			node, err := p.parseOr(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			if !p.isOperator(")") {
+				return nil, p.errorf(p.tok.pos, "expected ')' to close '(' at offset %d, found %s", tok.pos, p.describe())
+			}
+			return node, p.advance()
+		}
+	}
+	return nil, p.errorf(tok.pos, "unexpected %s", p.describe())
+}
+
+func (p *filterParser) parseAttr() (filterNode, error) {
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if !p.isOperator("[") {
+		return nil, p.errorf(p.tok.pos, "expected '[' after attr, found %s", p.describe())
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	var node *attrNode
+	switch tok := p.tok; tok.kind {
+	case tokenString:
+		node = &attrNode{name: tok.text}
+	case tokenNumber:
+		index, err := strconv.Atoi(tok.text)
+		if err != nil || index < 0 {
+			return nil, p.errorf(tok.pos, "attribute index must be a non-negative integer")
+		}
+		node = &attrNode{index: index, byPos: true}
+	default:
+		return nil, p.errorf(tok.pos, "expected attribute name or index, found %s", p.describe())
+	}
+	if err := p.advance(); err != nil {
+		return nil, err
+	}
+	if !p.isOperator("]") {
+		return nil, p.errorf(p.tok.pos, "expected ']', found %s", p.describe())
+	}
+	return node, p.advance()
+}
@@ -0,0 +1,185 @@
+package opcae
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newFilterTestEvent() *OnEventStruct {
+	return &OnEventStruct{
+		EventType:  uint32(OPC_CONDITION_EVENT),
+		Source:     "Boiler1.Drum",
+		Condition:  "LEVEL",
+		Subcond:    "HI",
+		Message:    "level high",
+		Severity:   750,
+		Category:   3,
+		Quality:    OPC_QUALITY_GOOD,
+		NewState:   OPC_CONDITION_ENABLED | OPC_CONDITION_ACTIVE,
+		AckReq:     true,
+		Attributes: []interface{}{int32(42), "A", 1.5, nil},
+	}
+}
+
+func filterTestLookup(event *OnEventStruct, name string) (interface{}, bool) {
+	switch name {
+	case "Value":
+		return event.Attributes[0], true
+	case "Operator":
+		return event.Attributes[1], true
+	}
+	return nil, false
+}
+
+func TestEventFilter_Match(t *testing.T) {
+	event := newFilterTestEvent()
+	tests := []struct {
+		expr  string
+		match bool
+	}{
+		{`severity >= 700 && source =~ "Boiler*" && !acked && attr["Operator"] == "A"`, true},
+		{`severity > 750`, false},
+		{`severity <= 750.0 && severity != 1`, true},
+		{`source =~ "Boiler?.Drum"`, true},
+		{`source !~ "Boiler*"`, false},
+		{`condition == "LEVEL" && subcondition == "HI" && message =~ "*high"`, true},
+		{`eventtype == "condition" && enabled && active && ackreq`, true},
+		{`eventtype == "simple" || quality < 192`, false},
+		{`category == 3 && cookie == 0 && actor == ""`, true},
+		{`attr[0] == 42 && attr[2] > 1 && attr["Value"] < 1e3`, true},
+		{`attr[3] == 0 || attr[9] == 0 || attr["Missing"] == "A"`, false},
+		{`attr["Missing"] != "A" || attr[1] == 42`, false},
+		{`!(acked || severity < 500)`, true},
+		{`!acked == true`, true},
+		{`source > "A" && source < "C"`, true},
+		{`attr["Operator"]`, false},
+		{`true && !false`, true},
+	}
+	for _, test := range tests {
+		f, err := CompileEventFilter(test.expr, filterTestLookup)
+		if !assert.NoError(t, err, test.expr) {
+			continue
+		}
+		assert.Equal(t, test.match, f.Match(event), test.expr)
+	}
+}
+
+func TestEventFilter_SyntaxError(t *testing.T) {
+	tests := []struct {
+		expr string
+		pos  int
+	}{
+		{``, 0},
+		{`severity >=`, 11},
+		{`severity >= 700 &&`, 18},
+		{`sevrity > 1`, 0},
+		{`source =~ 5`, 7},
+		{`severity && acked`, 0},
+		{`acked < true`, 6},
+		{`(acked`, 6},
+		{`attr("x")`, 4},
+		{`attr[-1] == 1`, 5},
+		{`source == "abc`, 10},
+		{`source # 1`, 7},
+		{`1.2.3 == 1`, 0},
+		{`acked acked`, 6},
+		{`!severity`, 1},
+	}
+	for _, test := range tests {
+		_, err := CompileEventFilter(test.expr, nil)
+		var syntaxErr *FilterSyntaxError
+		if assert.True(t, errors.As(err, &syntaxErr), test.expr) {
+			assert.Equal(t, test.pos, syntaxErr.Pos, "%s: %s", test.expr, err)
+		}
+	}
+}
+
+func TestEventFilter_String(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{`(severity>=700)&&((acked)||!active)`, `severity >= 700 && (acked || !active)`},
+		{`a_ || b_`, ``},
+		{`acked && (active && enabled)`, `acked && (active && enabled)`},
+		{`!(source == "x\ty") == false`, `!(source == "x\ty") == false`},
+		{`attr[1] =~ "A*" || attr["Op"] != 1e21`, `attr[1] =~ "A*" || attr["Op"] != 1e+21`},
+	}
+	for _, test := range tests {
+		f, err := CompileEventFilter(test.expr, nil)
+		if test.want == "" {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		assert.Equal(t, test.want, f.String())
+	}
+}
+
+func TestEventFilter_StringLongExpression(t *testing.T) {
+	// the canonical form of long chains is written in linear time
+	terms := make([]string, 100000)
+	for i := range terms {
+		terms[i] = "severity > " + strconv.Itoa(i)
+	}
+	for _, op := range []string{" && ", " || "} {
+		expr := strings.Join(terms, op)
+		f, err := CompileEventFilter(expr, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, expr, f.String())
+	}
+}
+
+func TestEventFilter_Filter(t *testing.T) {
+	f, err := CompileEventFilter(`severity >= 500`, nil)
+	assert.NoError(t, err)
+	events := []*OnEventStruct{{Severity: 600}, {Severity: 700}}
+	assert.Equal(t, events, f.Filter(events))
+	filtered := f.Filter([]*OnEventStruct{{Severity: 100}, {Severity: 600}, {Severity: 200}})
+	assert.Len(t, filtered, 1)
+	assert.Equal(t, uint32(600), filtered[0].Severity)
+}
+
+func TestMatchPattern(t *testing.T) {
+	assert.True(t, matchPattern("", "*"))
+	assert.True(t, matchPattern("abc", "a*c"))
+	assert.True(t, matchPattern("abcbc", "*bc"))
+	assert.True(t, matchPattern("äbc", "?bc"))
+	assert.False(t, matchPattern("abc", "a?"))
+	assert.False(t, matchPattern("abc", ""))
+	assert.True(t, matchPattern("a*c", "a*c"))
+}
+
+func FuzzCompileEventFilter(f *testing.F) {
+	f.Add(`severity >= 700 && source =~ "Boiler*" && !acked && attr["Operator"] == "A"`)
+	f.Add(`!(acked || severity < 500) && attr[0] != 1.5e3`)
+	f.Add(`eventtype == "tracking" || message !~ "*ä?"`)
+	f.Add(`((((active))))`)
+	event := newFilterTestEvent()
+	f.Fuzz(func(t *testing.T, expr string) {
+		filter, err := CompileEventFilter(expr, filterTestLookup)
+		if err != nil {
+			var syntaxErr *FilterSyntaxError
+			if !errors.As(err, &syntaxErr) || syntaxErr.Pos < 0 || syntaxErr.Pos > len(expr) {
+				t.Fatalf("%q: unexpected error %v", expr, err)
+			}
+			return
+		}
+		match := filter.Match(event)
+		canonical := filter.String()
+		again, err := CompileEventFilter(canonical, filterTestLookup)
+		if err != nil {
+			t.Fatalf("%q: canonical form %q does not compile: %v", expr, canonical, err)
+		}
+		if again.String() != canonical {
+			t.Fatalf("%q: canonical form is not stable: %q != %q", expr, again.String(), canonical)
+		}
+		if again.Match(event) != match {
+			t.Fatalf("%q: canonical form %q matches differently", expr, canonical)
+		}
+	})
+}
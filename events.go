@@ -0,0 +1,46 @@
+package opcae
+
+import "time"
+
+type EventSinkOnEventData struct {
+	ClientHandle uint32
+	Refresh      bool
+	LastRefresh  bool
+	// KeepAlive is true for keep-alive callbacks, they carry no events
+	KeepAlive bool
+	Events    []*OnEventStruct
+}
+type OnEventStruct struct {
+	ChangeMask []ChangeMask
+	NewState   State
+	Source     string
+	Time       time.Time
+	Message    string
+	EventType  uint32
+	Category   uint32
+	Severity   uint32
+	Condition  string
+	Subcond    string
+	Quality    uint16
+	Reserved   uint16
+	AckReq     bool
+	ActiveTime time.Time
+	Cookie     uint32
+	NumAttrs   uint32
+	Attributes []interface{}
+	ActorID    string
+	// AttributeIDs are the IDs of Attributes and NamedAttributes maps the attribute descriptions to the values,
+	// both are set when the returned attributes of the category were selected through an AttributeSchema
+	AttributeIDs    []uint32
+	NamedAttributes map[string]interface{}
+}
+
+// AckRequest returns the request needed to acknowledge the condition this event reports
+func (e *OnEventStruct) AckRequest() *AckRequest {
+	return &AckRequest{
+		Source:     e.Source,
+		Condition:  e.Condition,
+		ActiveTime: e.ActiveTime,
+		Cookie:     e.Cookie,
+	}
+}
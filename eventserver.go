@@ -0,0 +1,65 @@
+//go:build windows
+
+package opcae
+
+import (
+	"context"
+
+	"golang.org/x/sys/windows"
+)
+
+var _ EventServer = eventServer{}
+
+// clsid is the type of ItemID.CLSID, windows.GUID on Windows
+type clsid = windows.GUID
+
+// EventServer returns v as an EventServer. The methods of OPCEventServer that create objects return the
+// concrete types, the EventServer returns them as EventSubscription and AreaBrowser.
+func (v *OPCEventServer) EventServer() EventServer {
+	return eventServer{v}
+}
+
+// eventServer adapts OPCEventServer to EventServer
+type eventServer struct {
+	*OPCEventServer
+}
+
+func (s eventServer) GetStatus() (*EventServerStatus, error) {
+	return s.eventServerStatus()
+}
+
+func (s eventServer) CreateEventSubscription(active bool, bufferTime, maxSize, receiverBufSize uint32, opts ...SubscriptionOption) (EventSubscription, uint32, uint32, error) {
+	sub, revisedBufferTime, revisedMaxSize, err := s.OPCEventServer.CreateEventSubscription(active, bufferTime, maxSize, receiverBufSize, opts...)
+	if sub == nil {
+		return nil, revisedBufferTime, revisedMaxSize, err
+	}
+	return sub, revisedBufferTime, revisedMaxSize, err
+}
+
+func (s eventServer) CreateAreaBrowser() (AreaBrowser, error) {
+	browser, err := s.OPCEventServer.CreateAreaBrowser()
+	if browser == nil {
+		return nil, err
+	}
+	return browser, err
+}
+
+func (s eventServer) GetStatusContext(ctx context.Context) (*EventServerStatus, error) {
+	return CallContext(ctx, s.timeout, tracked(&s.calls, "GetStatus", s.eventServerStatus), nil)
+}
+
+func (s eventServer) CreateEventSubscriptionContext(ctx context.Context, active bool, bufferTime, maxSize, receiverBufSize uint32, opts ...SubscriptionOption) (EventSubscription, uint32, uint32, error) {
+	sub, revisedBufferTime, revisedMaxSize, err := s.OPCEventServer.CreateEventSubscriptionContext(ctx, active, bufferTime, maxSize, receiverBufSize, opts...)
+	if sub == nil {
+		return nil, revisedBufferTime, revisedMaxSize, err
+	}
+	return sub, revisedBufferTime, revisedMaxSize, err
+}
+
+func (s eventServer) CreateAreaBrowserContext(ctx context.Context) (AreaBrowser, error) {
+	browser, err := s.OPCEventServer.CreateAreaBrowserContext(ctx)
+	if browser == nil {
+		return nil, err
+	}
+	return browser, err
+}
@@ -6,10 +6,10 @@ require (
 	github.com/huskar-t/opcda v0.3.0
 	github.com/stretchr/testify v1.9.0
 	golang.org/x/sys v0.18.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,92 @@
+package opcae
+
+import (
+	"context"
+)
+
+// Handler receives the notifications of a subscription started by Subscribe.
+// The methods are called from a single goroutine, a slow handler fills the receiver of the subscription.
+type Handler interface {
+	// OnEvent is called for every callback that carries events, keep-alive callbacks are not passed on
+	OnEvent(data *EventSinkOnEventData)
+	// OnRefreshStart is called before the events of the first callback of a refresh
+	OnRefreshStart()
+	// OnRefreshDone is called after the last callback of a refresh, also when the refresh was cancelled
+	OnRefreshDone()
+	// OnError is called with ErrServerShutdown when the server requested a shutdown or the client disconnected
+	OnError(err error)
+}
+
+// HandlerFuncs is a Handler built from functions, nil functions are skipped
+type HandlerFuncs struct {
+	Event        func(data *EventSinkOnEventData)
+	RefreshStart func()
+	RefreshDone  func()
+	Error        func(err error)
+}
+
+func (h HandlerFuncs) OnEvent(data *EventSinkOnEventData) {
+	if h.Event != nil {
+		h.Event(data)
+	}
+}
+
+func (h HandlerFuncs) OnRefreshStart() {
+	if h.RefreshStart != nil {
+		h.RefreshStart()
+	}
+}
+
+func (h HandlerFuncs) OnRefreshDone() {
+	if h.RefreshDone != nil {
+		h.RefreshDone()
+	}
+}
+
+func (h HandlerFuncs) OnError(err error) {
+	if h.Error != nil {
+		h.Error(err)
+	}
+}
+
+// Subscribe passes the notifications of sub to handler on a new goroutine.
+// The goroutine stops when ctx is cancelled or sub is released, the returned channel is closed when it has stopped.
+// Cancelling ctx does not release sub.
+func Subscribe(ctx context.Context, sub EventSubscription, handler Handler) <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		dispatch(ctx, sub, handler)
+	}()
+	return done
+}
+
+func dispatch(ctx context.Context, sub EventSubscription, handler Handler) {
+	receiver := sub.GetReceiver()
+	shutdown := sub.Closed()
+	refreshing := false
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-shutdown:
+			shutdown = nil
+			handler.OnError(ErrServerShutdown)
+		case data, ok := <-receiver:
+			if !ok {
+				return
+			}
+			if data.Refresh && !refreshing {
+				refreshing = true
+				handler.OnRefreshStart()
+			}
+			if len(data.Events) > 0 {
+				handler.OnEvent(data)
+			}
+			if data.LastRefresh {
+				refreshing = false
+				handler.OnRefreshDone()
+			}
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package opcae
+
+import (
+	"context"
+)
+
+// EventServer is the method set of OPCEventServer, OPCEventServer.EventServer adapts an OPCEventServer to it.
+// Code that only depends on EventServer builds on every platform and can be tested against a fake server.
+// The Context methods return ctx.Err() when ctx is done before the server answers, see CallContext, the calls
+// that change the server may still take effect.
+// Calls that return a revised value may return it with an informational *OPCError, see Succeeded.
+type EventServer interface {
+	RegisterServerShutDown(ch chan string)
+	ConnectionState() ConnectionState
+	ShutdownReason() string
+	ShutdownNotify() <-chan struct{}
+
+	SetLocaleID(localeID uint32) error
+	GetLocaleID() (uint32, error)
+	QueryAvailableLocaleIDs() ([]uint32, error)
+	SetClientName(clientName string) error
+	GetClientName() string
+	GetErrorString(errorCode int32) (string, error)
+
+	GetStatus() (*EventServerStatus, error)
+	CreateEventSubscription(active bool, bufferTime, maxSize, receiverBufSize uint32, opts ...SubscriptionOption) (EventSubscription, uint32, uint32, error)
+	QueryAvailableFilters() ([]Filter, error)
+	QueryEventCategories(categories []EventCategoryType) ([]*EventCategory, error)
+	QueryConditionNames(categories []EventCategoryType) ([]string, error)
+	QuerySourceConditions(source string) ([]string, error)
+	QuerySubConditionNames(conditionName string) ([]string, error)
+	QueryEventAttributes(eventCategoryID uint32) ([]*EventAttribute, error)
+	TranslateToItemIDs(source string, eventCategoryID uint32, conditionName string, subConditionName string, assocAttrIDs []uint32) ([]*ItemID, error)
+	GetConditionState(source, conditionName string, eventCategoryID uint32, attributeIDs []uint32) (*ConditionState, error)
+	AckConditions(acknowledgerID, comment string, requests []*AckRequest) ([]*AckResult, error)
+
+	EnableConditionByArea(areas []string) ([]error, error)
+	EnableConditionBySource(sources []string) ([]error, error)
+	DisableConditionByArea(areas []string) ([]error, error)
+	DisableConditionBySource(sources []string) ([]error, error)
+	SupportsEventServer2() bool
+	EnableConditionByArea2(areas []string) ([]error, error)
+	EnableConditionBySource2(sources []string) ([]error, error)
+	DisableConditionByArea2(areas []string) ([]error, error)
+	DisableConditionBySource2(sources []string) ([]error, error)
+	GetEnableStateByArea(areas []string) ([]*EnableState, error)
+	GetEnableStateBySource(sources []string) ([]*EnableState, error)
+
+	CreateAreaBrowser() (AreaBrowser, error)
+	Disconnect() error
+
+	SetLocaleIDContext(ctx context.Context, localeID uint32) error
+	GetLocaleIDContext(ctx context.Context) (uint32, error)
+	QueryAvailableLocaleIDsContext(ctx context.Context) ([]uint32, error)
+	SetClientNameContext(ctx context.Context, clientName string) error
+	GetErrorStringContext(ctx context.Context, errorCode int32) (string, error)
+	GetStatusContext(ctx context.Context) (*EventServerStatus, error)
+	CreateEventSubscriptionContext(ctx context.Context, active bool, bufferTime, maxSize, receiverBufSize uint32, opts ...SubscriptionOption) (EventSubscription, uint32, uint32, error)
+	QueryAvailableFiltersContext(ctx context.Context) ([]Filter, error)
+	QueryEventCategoriesContext(ctx context.Context, categories []EventCategoryType) ([]*EventCategory, error)
+	QueryConditionNamesContext(ctx context.Context, categories []EventCategoryType) ([]string, error)
+	QuerySourceConditionsContext(ctx context.Context, source string) ([]string, error)
+	QuerySubConditionNamesContext(ctx context.Context, conditionName string) ([]string, error)
+	QueryEventAttributesContext(ctx context.Context, eventCategoryID uint32) ([]*EventAttribute, error)
+	TranslateToItemIDsContext(ctx context.Context, source string, eventCategoryID uint32, conditionName string, subConditionName string, assocAttrIDs []uint32) ([]*ItemID, error)
+	GetConditionStateContext(ctx context.Context, source, conditionName string, eventCategoryID uint32, attributeIDs []uint32) (*ConditionState, error)
+	AckConditionsContext(ctx context.Context, acknowledgerID, comment string, requests []*AckRequest) ([]*AckResult, error)
+	EnableConditionByAreaContext(ctx context.Context, areas []string) ([]error, error)
+	EnableConditionBySourceContext(ctx context.Context, sources []string) ([]error, error)
+	DisableConditionByAreaContext(ctx context.Context, areas []string) ([]error, error)
+	DisableConditionBySourceContext(ctx context.Context, sources []string) ([]error, error)
+	EnableConditionByArea2Context(ctx context.Context, areas []string) ([]error, error)
+	EnableConditionBySource2Context(ctx context.Context, sources []string) ([]error, error)
+	DisableConditionByArea2Context(ctx context.Context, areas []string) ([]error, error)
+	DisableConditionBySource2Context(ctx context.Context, sources []string) ([]error, error)
+	GetEnableStateByAreaContext(ctx context.Context, areas []string) ([]*EnableState, error)
+	GetEnableStateBySourceContext(ctx context.Context, sources []string) ([]*EnableState, error)
+	CreateAreaBrowserContext(ctx context.Context) (AreaBrowser, error)
+}
+
+// EventSubscription is the method set of OPCEventSubscription
+type EventSubscription interface {
+	GetClientHandle() uint32
+	ConnectionState() ConnectionState
+	Closed() <-chan struct{}
+
+	GetState() (active bool, bufferTime uint32, maxSize uint32, clientSubscription uint32, err error)
+	SetActive(active bool) error
+	SetBufferTime(bufferTime uint32) (uint32, error)
+	SetMaxSize(maxSize uint32) (uint32, error)
+	SetFilter(events []EventCategoryType, eventCategories []uint32, lowSeverity uint32, highSeverity uint32, areaList []string, sourceList []string) error
+	GetFilter() (events []EventCategoryType, eventCategories []uint32, lowSeverity uint32, highSeverity uint32, areaList []string, sourceList []string, err error)
+	SelectReturnedAttributes(eventCategory uint32, attributeIDs []uint32) error
+	SelectReturnedAttributesByName(eventCategory uint32, names []string) error
+	GetReturnedAttributes(eventCategory uint32) ([]uint32, error)
+	Refresh() error
+	CancelRefresh() error
+	RefreshAndWait(ctx context.Context) ([]*OnEventStruct, error)
+
+	SetKeepAlive(keepAliveTime uint32) (uint32, error)
+	GetKeepAlive() (uint32, error)
+	StartWatchdog(multiple uint32, notify chan<- *SubscriptionStall) error
+	StopWatchdog()
+
+	GetReceiver() <-chan *EventSinkOnEventData
+	DeliveryStats() DeliveryStats
+	Release() error
+
+	GetStateContext(ctx context.Context) (active bool, bufferTime uint32, maxSize uint32, clientSubscription uint32, err error)
+	GetFilterContext(ctx context.Context) (events []EventCategoryType, eventCategories []uint32, lowSeverity uint32, highSeverity uint32, areaList []string, sourceList []string, err error)
+	SetActiveContext(ctx context.Context, active bool) error
+	SetBufferTimeContext(ctx context.Context, bufferTime uint32) (uint32, error)
+	SetMaxSizeContext(ctx context.Context, maxSize uint32) (uint32, error)
+	SetFilterContext(ctx context.Context, events []EventCategoryType, eventCategories []uint32, lowSeverity uint32, highSeverity uint32, areaList []string, sourceList []string) error
+	SelectReturnedAttributesContext(ctx context.Context, eventCategory uint32, attributeIDs []uint32) error
+	SelectReturnedAttributesByNameContext(ctx context.Context, eventCategory uint32, names []string) error
+	GetReturnedAttributesContext(ctx context.Context, eventCategory uint32) ([]uint32, error)
+	RefreshContext(ctx context.Context) error
+	CancelRefreshContext(ctx context.Context) error
+	SetKeepAliveContext(ctx context.Context, keepAliveTime uint32) (uint32, error)
+	GetKeepAliveContext(ctx context.Context) (uint32, error)
+}
+
+// AreaBrowser is the method set of OPCAreaBrowser
+type AreaBrowser interface {
+	MoveToRoot() error
+	MoveUP() error
+	MoveDown(area string) error
+	BrowseOPCAreas(browseFilterType BrowseType, filterCriteria string) ([]string, error)
+	GetQualifiedAreaName(areaName string) (string, error)
+	GetQualifiedSourceName(sourceName string) (string, error)
+	Release() error
+
+	MoveToRootContext(ctx context.Context) error
+	MoveUPContext(ctx context.Context) error
+	MoveDownContext(ctx context.Context, area string) error
+	BrowseOPCAreasContext(ctx context.Context, browseFilterType BrowseType, filterCriteria string) ([]string, error)
+	GetQualifiedAreaNameContext(ctx context.Context, areaName string) (string, error)
+	GetQualifiedSourceNameContext(ctx context.Context, sourceName string) (string, error)
+}
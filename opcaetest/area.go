@@ -0,0 +1,224 @@
+package opcaetest
+
+import (
+	"strings"
+
+	"github.com/huskar-t/opcae"
+)
+
+// Separator joins area and source names to fully qualified names
+const Separator = "."
+
+type area struct {
+	name      string
+	qualified string
+	parent    *area
+	enabled   bool
+	areas     []*area
+	sources   []*source
+}
+
+func newArea(name string, parent *area) *area {
+	a := &area{name: name, parent: parent, enabled: true}
+	if parent != nil {
+		a.qualified = qualify(parent.qualified, name)
+	}
+	return a
+}
+
+func qualify(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + Separator + name
+}
+
+func (a *area) area(name string) *area {
+	for _, child := range a.areas {
+		if child.name == name {
+			return child
+		}
+	}
+	return nil
+}
+
+func (a *area) source(name string) *source {
+	for _, child := range a.sources {
+		if child.name == name {
+			return child
+		}
+	}
+	return nil
+}
+
+// effectivelyEnabled reports whether the area and all areas above it are enabled
+func (a *area) effectivelyEnabled() bool {
+	for p := a; p != nil; p = p.parent {
+		if !p.enabled {
+			return false
+		}
+	}
+	return true
+}
+
+// walk calls fa for the area and every area below it and fs for every source below it
+func (a *area) walk(fa func(*area), fs func(*source)) {
+	fa(a)
+	for _, s := range a.sources {
+		fs(s)
+	}
+	for _, child := range a.areas {
+		child.walk(fa, fs)
+	}
+}
+
+// matches reports whether the area or an area above it matches the pattern
+func (a *area) matches(pattern string) bool {
+	for p := a; p != nil && p.parent != nil; p = p.parent {
+		if matchWildcard(pattern, p.qualified) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchWildcard matches name against an OPC filter pattern.
+// '*' matches any sequence of characters and '?' matches a single character, an empty pattern matches everything.
+func matchWildcard(pattern, name string) bool {
+	if pattern == "" {
+		return true
+	}
+	p := []rune(pattern)
+	n := []rune(name)
+	pi, ni := 0, 0
+	star, mark := -1, 0
+	for ni < len(n) {
+		switch {
+		case pi < len(p) && (p[pi] == '?' || p[pi] == n[ni]):
+			pi++
+			ni++
+		case pi < len(p) && p[pi] == '*':
+			star = pi
+			mark = ni
+			pi++
+		case star >= 0:
+			pi = star + 1
+			mark++
+			ni = mark
+		default:
+			return false
+		}
+	}
+	for pi < len(p) && p[pi] == '*' {
+		pi++
+	}
+	return pi == len(p)
+}
+
+func splitQualified(qualified string) []string {
+	if qualified == "" {
+		return nil
+	}
+	return strings.Split(qualified, Separator)
+}
+
+var _ opcae.AreaBrowser = (*AreaBrowser)(nil)
+
+// AreaBrowser browses the area tree of a Server
+type AreaBrowser struct {
+	server   *Server
+	position *area
+}
+
+func (b *AreaBrowser) MoveToRoot() error {
+	b.server.lock.Lock()
+	defer b.server.lock.Unlock()
+	if err := b.server.call("MoveToRoot"); err != nil {
+		return err
+	}
+	b.position = b.server.root
+	return nil
+}
+
+func (b *AreaBrowser) MoveUP() error {
+	b.server.lock.Lock()
+	defer b.server.lock.Unlock()
+	if err := b.server.call("MoveUP"); err != nil {
+		return err
+	}
+	if b.position.parent == nil {
+		return opcae.NewOPCError("MoveUP", "", opcae.E_FAIL)
+	}
+	b.position = b.position.parent
+	return nil
+}
+
+func (b *AreaBrowser) MoveDown(area string) error {
+	b.server.lock.Lock()
+	defer b.server.lock.Unlock()
+	if err := b.server.call("MoveDown"); err != nil {
+		return err
+	}
+	child := b.position.area(area)
+	if child == nil {
+		return opcae.NewOPCError("MoveDown", area, opcae.E_INVALIDARG)
+	}
+	b.position = child
+	return nil
+}
+
+func (b *AreaBrowser) BrowseOPCAreas(browseFilterType opcae.BrowseType, filterCriteria string) ([]string, error) {
+	b.server.lock.Lock()
+	defer b.server.lock.Unlock()
+	if err := b.server.call("BrowseOPCAreas"); err != nil {
+		return nil, err
+	}
+	var names []string
+	switch browseFilterType {
+	case opcae.OPC_AREA:
+		for _, child := range b.position.areas {
+			if matchWildcard(filterCriteria, child.name) {
+				names = append(names, child.name)
+			}
+		}
+	case opcae.OPC_SOURCE:
+		for _, child := range b.position.sources {
+			if matchWildcard(filterCriteria, child.name) {
+				names = append(names, child.name)
+			}
+		}
+	default:
+		return nil, opcae.NewOPCError("BrowseOPCAreas", filterCriteria, opcae.E_INVALIDARG)
+	}
+	return names, nil
+}
+
+func (b *AreaBrowser) GetQualifiedAreaName(areaName string) (string, error) {
+	b.server.lock.Lock()
+	defer b.server.lock.Unlock()
+	if err := b.server.call("GetQualifiedAreaName"); err != nil {
+		return "", err
+	}
+	child := b.position.area(areaName)
+	if child == nil {
+		return "", opcae.NewOPCError("GetQualifiedAreaName", areaName, opcae.E_INVALIDARG)
+	}
+	return child.qualified, nil
+}
+
+func (b *AreaBrowser) GetQualifiedSourceName(sourceName string) (string, error) {
+	b.server.lock.Lock()
+	defer b.server.lock.Unlock()
+	if err := b.server.call("GetQualifiedSourceName"); err != nil {
+		return "", err
+	}
+	child := b.position.source(sourceName)
+	if child == nil {
+		return "", opcae.NewOPCError("GetQualifiedSourceName", sourceName, opcae.E_INVALIDARG)
+	}
+	return child.qualified, nil
+}
+
+func (b *AreaBrowser) Release() error {
+	return nil
+}
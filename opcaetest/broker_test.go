@@ -0,0 +1,90 @@
+package opcaetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/huskar-t/opcae"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func receiveFrom(t *testing.T, c *opcae.Consumer) *opcae.EventSinkOnEventData {
+	t.Helper()
+	select {
+	case data := <-c.GetReceiver():
+		return data
+	case <-time.After(2 * time.Second):
+		t.Fatal("no callback received")
+		return nil
+	}
+}
+
+func TestBroker(t *testing.T) {
+	s := newTestServer(t)
+	sub, _, _, err := s.CreateEventSubscription(true, 0, 0, 10)
+	require.NoError(t, err)
+	broker := opcae.NewBroker(sub)
+	defer broker.Close()
+
+	_, err = broker.Subscribe(10, opcae.WithDeliveryPolicy(opcae.DeliverBlock))
+	assert.Equal(t, opcae.ErrBlockingConsumer, err)
+	all, err := broker.Subscribe(10)
+	require.NoError(t, err)
+	filter, err := opcae.CompileEventFilter(`source =~ "*.Pump?"`, nil)
+	require.NoError(t, err)
+	pumps, err := broker.Subscribe(10, opcae.WithEventFilter(filter))
+	require.NoError(t, err)
+	// slow never reads, it must not stall the other consumers
+	slow, err := broker.Subscribe(1, opcae.WithDeliveryPolicy(opcae.DeliverDropNewest))
+	require.NoError(t, err)
+	assert.Equal(t, 3, broker.Len())
+
+	require.NoError(t, s.Activate("Plant.Area1.Tank1", "LEVEL", "", ""))
+	assert.Equal(t, "Plant.Area1.Tank1", receiveFrom(t, all).Events[0].Source)
+	require.NoError(t, s.Activate("Plant.Area2.Pump1", "COMM", "", ""))
+	assert.Equal(t, "Plant.Area2.Pump1", receiveFrom(t, all).Events[0].Source)
+	assert.Equal(t, "Plant.Area2.Pump1", receiveFrom(t, pumps).Events[0].Source)
+	assert.Eventually(t, func() bool { return slow.DeliveryStats().Dropped == 1 }, time.Second, time.Millisecond)
+
+	events, err := pumps.RefreshAndWait(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, events, 1)
+	data := receiveFrom(t, all)
+	assert.True(t, data.Refresh, "the other consumers receive the refresh")
+
+	pumps.Unsubscribe()
+	_, ok := <-pumps.GetReceiver()
+	assert.False(t, ok)
+	assert.Equal(t, 2, broker.Len())
+	require.NoError(t, s.Deactivate("Plant.Area2.Pump1", "COMM", ""))
+	data = receiveFrom(t, all)
+	assert.False(t, data.Refresh)
+	assert.Equal(t, "Plant.Area2.Pump1", data.Events[0].Source)
+	active, _, _, _, err := sub.GetState()
+	assert.NoError(t, err)
+	assert.True(t, active, "unsubscribing does not affect the subscription")
+
+	require.NoError(t, sub.Release())
+	assert.Eventually(t, func() bool { return broker.Len() == 0 }, time.Second, time.Millisecond)
+	for range all.GetReceiver() {
+	}
+	_, err = broker.Subscribe(10)
+	assert.Equal(t, opcae.ErrBrokerClosed, err)
+}
+
+func TestBroker_Close(t *testing.T) {
+	s := newTestServer(t)
+	sub, _, _, err := s.CreateEventSubscription(true, 0, 0, 10)
+	require.NoError(t, err)
+	defer sub.Release()
+	broker := opcae.NewBroker(sub)
+	consumer, err := broker.Subscribe(10, opcae.WithDeliveryPolicy(opcae.DeliverSpill))
+	require.NoError(t, err)
+	broker.Close()
+	broker.Close()
+	_, ok := <-consumer.GetReceiver()
+	assert.False(t, ok)
+	consumer.Unsubscribe()
+}
@@ -0,0 +1,70 @@
+package opcaetest
+
+import (
+	"time"
+
+	"github.com/huskar-t/opcae"
+)
+
+type category struct {
+	id          uint32
+	eventType   opcae.EventCategoryType
+	description string
+	attributes  []*opcae.EventAttribute
+}
+
+func (c *category) attribute(id uint32) *opcae.EventAttribute {
+	for _, attribute := range c.attributes {
+		if attribute.ID == id {
+			return attribute
+		}
+	}
+	return nil
+}
+
+type conditionDefinition struct {
+	name          string
+	category      *category
+	subConditions []*opcae.SubCondition
+}
+
+type source struct {
+	name       string
+	qualified  string
+	area       *area
+	enabled    bool
+	conditions []*condition
+	attributes map[uint32]interface{}
+}
+
+func (s *source) condition(name string) *condition {
+	for _, c := range s.conditions {
+		if c.definition.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func (s *source) effectivelyEnabled() bool {
+	return s.enabled && s.area.effectivelyEnabled()
+}
+
+// condition is a condition instance of a source with the values of its attributes
+type condition struct {
+	*opcae.Condition
+	source     *source
+	definition *conditionDefinition
+	attributes map[uint32]interface{}
+	// eventTime is the time of the last condition event, a refresh reports it
+	eventTime time.Time
+}
+
+func newCondition(source *source, definition *conditionDefinition) *condition {
+	return &condition{
+		Condition:  opcae.NewCondition(source.qualified, definition.name, definition.subConditions),
+		source:     source,
+		definition: definition,
+		attributes: make(map[uint32]interface{}),
+	}
+}
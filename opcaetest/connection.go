@@ -0,0 +1,67 @@
+package opcaetest
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/huskar-t/opcae"
+)
+
+// connection tracks the shutdown requests of a Server like the shutdown sink of OPCEventServer
+type connection struct {
+	state     atomic.Int32
+	lock      sync.Mutex
+	reason    string
+	done      chan struct{}
+	receivers []chan string
+}
+
+func newConnection() *connection {
+	return &connection{done: make(chan struct{})}
+}
+
+func (c *connection) State() opcae.ConnectionState {
+	return opcae.ConnectionState(c.state.Load())
+}
+
+func (c *connection) Reason() string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.reason
+}
+
+func (c *connection) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *connection) AddReceiver(ch chan string) {
+	c.lock.Lock()
+	c.receivers = append(c.receivers, ch)
+	c.lock.Unlock()
+}
+
+func (c *connection) Shutdown(reason string) {
+	if !c.state.CompareAndSwap(int32(opcae.ConnectionConnected), int32(opcae.ConnectionShuttingDown)) {
+		return
+	}
+	c.lock.Lock()
+	c.reason = reason
+	receivers := c.receivers
+	close(c.done)
+	c.lock.Unlock()
+	for _, ch := range receivers {
+		select {
+		case ch <- reason:
+		default:
+		}
+	}
+}
+
+func (c *connection) Disconnect() {
+	old := opcae.ConnectionState(c.state.Swap(int32(opcae.ConnectionDisconnected)))
+	if old == opcae.ConnectionConnected {
+		c.lock.Lock()
+		close(c.done)
+		c.lock.Unlock()
+	}
+}
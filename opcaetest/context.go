@@ -0,0 +1,370 @@
+package opcaetest
+
+import (
+	"context"
+	"time"
+
+	"github.com/huskar-t/opcae"
+)
+
+// SetDefaultTimeout limits the Context methods of the server, its subscriptions and area browsers when
+// their ctx has no deadline, like opcae.WithDefaultTimeout
+func (s *Server) SetDefaultTimeout(timeout time.Duration) {
+	s.timeout.Store(int64(timeout))
+}
+
+func (s *Server) defaultTimeout() time.Duration {
+	return time.Duration(s.timeout.Load())
+}
+
+func callContext(ctx context.Context, timeout time.Duration, call func() error) error {
+	_, err := opcae.CallContext(ctx, timeout, func() (struct{}, error) {
+		return struct{}{}, call()
+	}, nil)
+	return err
+}
+
+// SetLocaleIDContext is SetLocaleID with a context, see opcae.CallContext
+func (s *Server) SetLocaleIDContext(ctx context.Context, localeID uint32) error {
+	return callContext(ctx, s.defaultTimeout(), func() error {
+		return s.SetLocaleID(localeID)
+	})
+}
+
+// GetLocaleIDContext is GetLocaleID with a context, see opcae.CallContext
+func (s *Server) GetLocaleIDContext(ctx context.Context) (uint32, error) {
+	return opcae.CallContext(ctx, s.defaultTimeout(), func() (uint32, error) {
+		return s.GetLocaleID()
+	}, nil)
+}
+
+// QueryAvailableLocaleIDsContext is QueryAvailableLocaleIDs with a context, see opcae.CallContext
+func (s *Server) QueryAvailableLocaleIDsContext(ctx context.Context) ([]uint32, error) {
+	return opcae.CallContext(ctx, s.defaultTimeout(), func() ([]uint32, error) {
+		return s.QueryAvailableLocaleIDs()
+	}, nil)
+}
+
+// SetClientNameContext is SetClientName with a context, see opcae.CallContext
+func (s *Server) SetClientNameContext(ctx context.Context, clientName string) error {
+	return callContext(ctx, s.defaultTimeout(), func() error {
+		return s.SetClientName(clientName)
+	})
+}
+
+// GetErrorStringContext is GetErrorString with a context, see opcae.CallContext
+func (s *Server) GetErrorStringContext(ctx context.Context, errorCode int32) (string, error) {
+	return opcae.CallContext(ctx, s.defaultTimeout(), func() (string, error) {
+		return s.GetErrorString(errorCode)
+	}, nil)
+}
+
+// GetStatusContext is GetStatus with a context, see opcae.CallContext
+func (s *Server) GetStatusContext(ctx context.Context) (*opcae.EventServerStatus, error) {
+	return opcae.CallContext(ctx, s.defaultTimeout(), func() (*opcae.EventServerStatus, error) {
+		return s.GetStatus()
+	}, nil)
+}
+
+// QueryAvailableFiltersContext is QueryAvailableFilters with a context, see opcae.CallContext
+func (s *Server) QueryAvailableFiltersContext(ctx context.Context) ([]opcae.Filter, error) {
+	return opcae.CallContext(ctx, s.defaultTimeout(), func() ([]opcae.Filter, error) {
+		return s.QueryAvailableFilters()
+	}, nil)
+}
+
+// QueryEventCategoriesContext is QueryEventCategories with a context, see opcae.CallContext
+func (s *Server) QueryEventCategoriesContext(ctx context.Context, categories []opcae.EventCategoryType) ([]*opcae.EventCategory, error) {
+	return opcae.CallContext(ctx, s.defaultTimeout(), func() ([]*opcae.EventCategory, error) {
+		return s.QueryEventCategories(categories)
+	}, nil)
+}
+
+// QueryConditionNamesContext is QueryConditionNames with a context, see opcae.CallContext
+func (s *Server) QueryConditionNamesContext(ctx context.Context, categories []opcae.EventCategoryType) ([]string, error) {
+	return opcae.CallContext(ctx, s.defaultTimeout(), func() ([]string, error) {
+		return s.QueryConditionNames(categories)
+	}, nil)
+}
+
+// QuerySourceConditionsContext is QuerySourceConditions with a context, see opcae.CallContext
+func (s *Server) QuerySourceConditionsContext(ctx context.Context, source string) ([]string, error) {
+	return opcae.CallContext(ctx, s.defaultTimeout(), func() ([]string, error) {
+		return s.QuerySourceConditions(source)
+	}, nil)
+}
+
+// QuerySubConditionNamesContext is QuerySubConditionNames with a context, see opcae.CallContext
+func (s *Server) QuerySubConditionNamesContext(ctx context.Context, conditionName string) ([]string, error) {
+	return opcae.CallContext(ctx, s.defaultTimeout(), func() ([]string, error) {
+		return s.QuerySubConditionNames(conditionName)
+	}, nil)
+}
+
+// QueryEventAttributesContext is QueryEventAttributes with a context, see opcae.CallContext
+func (s *Server) QueryEventAttributesContext(ctx context.Context, eventCategoryID uint32) ([]*opcae.EventAttribute, error) {
+	return opcae.CallContext(ctx, s.defaultTimeout(), func() ([]*opcae.EventAttribute, error) {
+		return s.QueryEventAttributes(eventCategoryID)
+	}, nil)
+}
+
+// TranslateToItemIDsContext is TranslateToItemIDs with a context, see opcae.CallContext
+func (s *Server) TranslateToItemIDsContext(ctx context.Context, source string, eventCategoryID uint32, conditionName string, subConditionName string, assocAttrIDs []uint32) ([]*opcae.ItemID, error) {
+	return opcae.CallContext(ctx, s.defaultTimeout(), func() ([]*opcae.ItemID, error) {
+		return s.TranslateToItemIDs(source, eventCategoryID, conditionName, subConditionName, assocAttrIDs)
+	}, nil)
+}
+
+// GetConditionStateContext is GetConditionState with a context, see opcae.CallContext
+func (s *Server) GetConditionStateContext(ctx context.Context, source, conditionName string, eventCategoryID uint32, attributeIDs []uint32) (*opcae.ConditionState, error) {
+	return opcae.CallContext(ctx, s.defaultTimeout(), func() (*opcae.ConditionState, error) {
+		return s.GetConditionState(source, conditionName, eventCategoryID, attributeIDs)
+	}, nil)
+}
+
+// AckConditionsContext is AckConditions with a context, see opcae.CallContext
+func (s *Server) AckConditionsContext(ctx context.Context, acknowledgerID, comment string, requests []*opcae.AckRequest) ([]*opcae.AckResult, error) {
+	return opcae.CallContext(ctx, s.defaultTimeout(), func() ([]*opcae.AckResult, error) {
+		return s.AckConditions(acknowledgerID, comment, requests)
+	}, nil)
+}
+
+// EnableConditionByAreaContext is EnableConditionByArea with a context, see opcae.CallContext
+func (s *Server) EnableConditionByAreaContext(ctx context.Context, areas []string) ([]error, error) {
+	return opcae.CallContext(ctx, s.defaultTimeout(), func() ([]error, error) {
+		return s.EnableConditionByArea(areas)
+	}, nil)
+}
+
+// EnableConditionBySourceContext is EnableConditionBySource with a context, see opcae.CallContext
+func (s *Server) EnableConditionBySourceContext(ctx context.Context, sources []string) ([]error, error) {
+	return opcae.CallContext(ctx, s.defaultTimeout(), func() ([]error, error) {
+		return s.EnableConditionBySource(sources)
+	}, nil)
+}
+
+// DisableConditionByAreaContext is DisableConditionByArea with a context, see opcae.CallContext
+func (s *Server) DisableConditionByAreaContext(ctx context.Context, areas []string) ([]error, error) {
+	return opcae.CallContext(ctx, s.defaultTimeout(), func() ([]error, error) {
+		return s.DisableConditionByArea(areas)
+	}, nil)
+}
+
+// DisableConditionBySourceContext is DisableConditionBySource with a context, see opcae.CallContext
+func (s *Server) DisableConditionBySourceContext(ctx context.Context, sources []string) ([]error, error) {
+	return opcae.CallContext(ctx, s.defaultTimeout(), func() ([]error, error) {
+		return s.DisableConditionBySource(sources)
+	}, nil)
+}
+
+// EnableConditionByArea2Context is EnableConditionByArea2 with a context, see opcae.CallContext
+func (s *Server) EnableConditionByArea2Context(ctx context.Context, areas []string) ([]error, error) {
+	return opcae.CallContext(ctx, s.defaultTimeout(), func() ([]error, error) {
+		return s.EnableConditionByArea2(areas)
+	}, nil)
+}
+
+// EnableConditionBySource2Context is EnableConditionBySource2 with a context, see opcae.CallContext
+func (s *Server) EnableConditionBySource2Context(ctx context.Context, sources []string) ([]error, error) {
+	return opcae.CallContext(ctx, s.defaultTimeout(), func() ([]error, error) {
+		return s.EnableConditionBySource2(sources)
+	}, nil)
+}
+
+// DisableConditionByArea2Context is DisableConditionByArea2 with a context, see opcae.CallContext
+func (s *Server) DisableConditionByArea2Context(ctx context.Context, areas []string) ([]error, error) {
+	return opcae.CallContext(ctx, s.defaultTimeout(), func() ([]error, error) {
+		return s.DisableConditionByArea2(areas)
+	}, nil)
+}
+
+// DisableConditionBySource2Context is DisableConditionBySource2 with a context, see opcae.CallContext
+func (s *Server) DisableConditionBySource2Context(ctx context.Context, sources []string) ([]error, error) {
+	return opcae.CallContext(ctx, s.defaultTimeout(), func() ([]error, error) {
+		return s.DisableConditionBySource2(sources)
+	}, nil)
+}
+
+// GetEnableStateByAreaContext is GetEnableStateByArea with a context, see opcae.CallContext
+func (s *Server) GetEnableStateByAreaContext(ctx context.Context, areas []string) ([]*opcae.EnableState, error) {
+	return opcae.CallContext(ctx, s.defaultTimeout(), func() ([]*opcae.EnableState, error) {
+		return s.GetEnableStateByArea(areas)
+	}, nil)
+}
+
+// GetEnableStateBySourceContext is GetEnableStateBySource with a context, see opcae.CallContext
+func (s *Server) GetEnableStateBySourceContext(ctx context.Context, sources []string) ([]*opcae.EnableState, error) {
+	return opcae.CallContext(ctx, s.defaultTimeout(), func() ([]*opcae.EnableState, error) {
+		return s.GetEnableStateBySource(sources)
+	}, nil)
+}
+
+// CreateEventSubscriptionContext is CreateEventSubscription with a context, see opcae.CallContext
+func (s *Server) CreateEventSubscriptionContext(ctx context.Context, active bool, bufferTime, maxSize, receiverBufSize uint32, opts ...opcae.SubscriptionOption) (opcae.EventSubscription, uint32, uint32, error) {
+	type created struct {
+		sub                 opcae.EventSubscription
+		bufferTime, maxSize uint32
+	}
+	result, err := opcae.CallContext(ctx, s.defaultTimeout(), func() (created, error) {
+		sub, revisedBufferTime, revisedMaxSize, err := s.CreateEventSubscription(active, bufferTime, maxSize, receiverBufSize, opts...)
+		return created{sub: sub, bufferTime: revisedBufferTime, maxSize: revisedMaxSize}, err
+	}, func(c created) {
+		c.sub.Release()
+	})
+	return result.sub, result.bufferTime, result.maxSize, err
+}
+
+// CreateAreaBrowserContext is CreateAreaBrowser with a context, see opcae.CallContext
+func (s *Server) CreateAreaBrowserContext(ctx context.Context) (opcae.AreaBrowser, error) {
+	return opcae.CallContext(ctx, s.defaultTimeout(), s.CreateAreaBrowser, func(browser opcae.AreaBrowser) {
+		browser.Release()
+	})
+}
+
+// GetStateContext is GetState with a context, see opcae.CallContext
+func (sub *Subscription) GetStateContext(ctx context.Context) (active bool, bufferTime uint32, maxSize uint32, clientSubscription uint32, err error) {
+	type state struct {
+		active                                  bool
+		bufferTime, maxSize, clientSubscription uint32
+	}
+	result, err := opcae.CallContext(ctx, sub.server.defaultTimeout(), func() (state, error) {
+		var s state
+		var err error
+		s.active, s.bufferTime, s.maxSize, s.clientSubscription, err = sub.GetState()
+		return s, err
+	}, nil)
+	return result.active, result.bufferTime, result.maxSize, result.clientSubscription, err
+}
+
+// GetFilterContext is GetFilter with a context, see opcae.CallContext
+func (sub *Subscription) GetFilterContext(ctx context.Context) (events []opcae.EventCategoryType, eventCategories []uint32, lowSeverity uint32, highSeverity uint32, areaList []string, sourceList []string, err error) {
+	f, err := opcae.CallContext(ctx, sub.server.defaultTimeout(), func() (*opcae.SubscriptionFilter, error) {
+		var f opcae.SubscriptionFilter
+		var err error
+		f.EventTypes, f.Categories, f.LowSeverity, f.HighSeverity, f.Areas, f.Sources, err = sub.GetFilter()
+		return &f, err
+	}, nil)
+	if f == nil {
+		return nil, nil, 0, 0, nil, nil, err
+	}
+	return f.EventTypes, f.Categories, f.LowSeverity, f.HighSeverity, f.Areas, f.Sources, err
+}
+
+// SetActiveContext is SetActive with a context, see opcae.CallContext
+func (sub *Subscription) SetActiveContext(ctx context.Context, active bool) error {
+	return callContext(ctx, sub.server.defaultTimeout(), func() error {
+		return sub.SetActive(active)
+	})
+}
+
+// SetBufferTimeContext is SetBufferTime with a context, see opcae.CallContext
+func (sub *Subscription) SetBufferTimeContext(ctx context.Context, bufferTime uint32) (uint32, error) {
+	return opcae.CallContext(ctx, sub.server.defaultTimeout(), func() (uint32, error) {
+		return sub.SetBufferTime(bufferTime)
+	}, nil)
+}
+
+// SetMaxSizeContext is SetMaxSize with a context, see opcae.CallContext
+func (sub *Subscription) SetMaxSizeContext(ctx context.Context, maxSize uint32) (uint32, error) {
+	return opcae.CallContext(ctx, sub.server.defaultTimeout(), func() (uint32, error) {
+		return sub.SetMaxSize(maxSize)
+	}, nil)
+}
+
+// SetFilterContext is SetFilter with a context, see opcae.CallContext
+func (sub *Subscription) SetFilterContext(ctx context.Context, events []opcae.EventCategoryType, eventCategories []uint32, lowSeverity uint32, highSeverity uint32, areaList []string, sourceList []string) error {
+	return callContext(ctx, sub.server.defaultTimeout(), func() error {
+		return sub.SetFilter(events, eventCategories, lowSeverity, highSeverity, areaList, sourceList)
+	})
+}
+
+// SelectReturnedAttributesContext is SelectReturnedAttributes with a context, see opcae.CallContext
+func (sub *Subscription) SelectReturnedAttributesContext(ctx context.Context, eventCategory uint32, attributeIDs []uint32) error {
+	return callContext(ctx, sub.server.defaultTimeout(), func() error {
+		return sub.SelectReturnedAttributes(eventCategory, attributeIDs)
+	})
+}
+
+// SelectReturnedAttributesByNameContext is SelectReturnedAttributesByName with a context, see opcae.CallContext
+func (sub *Subscription) SelectReturnedAttributesByNameContext(ctx context.Context, eventCategory uint32, names []string) error {
+	return callContext(ctx, sub.server.defaultTimeout(), func() error {
+		return sub.SelectReturnedAttributesByName(eventCategory, names)
+	})
+}
+
+// GetReturnedAttributesContext is GetReturnedAttributes with a context, see opcae.CallContext
+func (sub *Subscription) GetReturnedAttributesContext(ctx context.Context, eventCategory uint32) ([]uint32, error) {
+	return opcae.CallContext(ctx, sub.server.defaultTimeout(), func() ([]uint32, error) {
+		return sub.GetReturnedAttributes(eventCategory)
+	}, nil)
+}
+
+// RefreshContext is Refresh with a context, see opcae.CallContext
+func (sub *Subscription) RefreshContext(ctx context.Context) error {
+	return callContext(ctx, sub.server.defaultTimeout(), func() error {
+		return sub.Refresh()
+	})
+}
+
+// CancelRefreshContext is CancelRefresh with a context, see opcae.CallContext
+func (sub *Subscription) CancelRefreshContext(ctx context.Context) error {
+	return callContext(ctx, sub.server.defaultTimeout(), func() error {
+		return sub.CancelRefresh()
+	})
+}
+
+// SetKeepAliveContext is SetKeepAlive with a context, see opcae.CallContext
+func (sub *Subscription) SetKeepAliveContext(ctx context.Context, keepAliveTime uint32) (uint32, error) {
+	return opcae.CallContext(ctx, sub.server.defaultTimeout(), func() (uint32, error) {
+		return sub.SetKeepAlive(keepAliveTime)
+	}, nil)
+}
+
+// GetKeepAliveContext is GetKeepAlive with a context, see opcae.CallContext
+func (sub *Subscription) GetKeepAliveContext(ctx context.Context) (uint32, error) {
+	return opcae.CallContext(ctx, sub.server.defaultTimeout(), func() (uint32, error) {
+		return sub.GetKeepAlive()
+	}, nil)
+}
+
+// MoveToRootContext is MoveToRoot with a context, see opcae.CallContext
+func (b *AreaBrowser) MoveToRootContext(ctx context.Context) error {
+	return callContext(ctx, b.server.defaultTimeout(), func() error {
+		return b.MoveToRoot()
+	})
+}
+
+// MoveUPContext is MoveUP with a context, see opcae.CallContext
+func (b *AreaBrowser) MoveUPContext(ctx context.Context) error {
+	return callContext(ctx, b.server.defaultTimeout(), func() error {
+		return b.MoveUP()
+	})
+}
+
+// MoveDownContext is MoveDown with a context, see opcae.CallContext
+func (b *AreaBrowser) MoveDownContext(ctx context.Context, area string) error {
+	return callContext(ctx, b.server.defaultTimeout(), func() error {
+		return b.MoveDown(area)
+	})
+}
+
+// BrowseOPCAreasContext is BrowseOPCAreas with a context, see opcae.CallContext
+func (b *AreaBrowser) BrowseOPCAreasContext(ctx context.Context, browseFilterType opcae.BrowseType, filterCriteria string) ([]string, error) {
+	return opcae.CallContext(ctx, b.server.defaultTimeout(), func() ([]string, error) {
+		return b.BrowseOPCAreas(browseFilterType, filterCriteria)
+	}, nil)
+}
+
+// GetQualifiedAreaNameContext is GetQualifiedAreaName with a context, see opcae.CallContext
+func (b *AreaBrowser) GetQualifiedAreaNameContext(ctx context.Context, areaName string) (string, error) {
+	return opcae.CallContext(ctx, b.server.defaultTimeout(), func() (string, error) {
+		return b.GetQualifiedAreaName(areaName)
+	}, nil)
+}
+
+// GetQualifiedSourceNameContext is GetQualifiedSourceName with a context, see opcae.CallContext
+func (b *AreaBrowser) GetQualifiedSourceNameContext(ctx context.Context, sourceName string) (string, error) {
+	return opcae.CallContext(ctx, b.server.defaultTimeout(), func() (string, error) {
+		return b.GetQualifiedSourceName(sourceName)
+	}, nil)
+}
@@ -0,0 +1,106 @@
+package opcaetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/huskar-t/opcae"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer_Context(t *testing.T) {
+	s := newTestServer(t)
+	s.SetDefaultTimeout(20 * time.Millisecond)
+	resume := s.HangNext("QueryEventCategories")
+	defer resume()
+	_, err := s.QueryEventCategoriesContext(context.Background(), []opcae.EventCategoryType{opcae.OPC_ALL_EVENTS})
+	assert.Equal(t, context.DeadlineExceeded, err)
+	// the hung call does not block other calls
+	filters, err := s.QueryAvailableFiltersContext(context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, filters, 5)
+	resume()
+	categories, err := s.QueryEventCategoriesContext(context.Background(), []opcae.EventCategoryType{opcae.OPC_ALL_EVENTS})
+	assert.NoError(t, err)
+	assert.Len(t, categories, 3)
+
+	// a subscription created after the call was abandoned is released
+	resume = s.HangNext("CreateEventSubscription")
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	_, _, _, err = s.CreateEventSubscriptionContext(ctx, true, 0, 0, 10)
+	assert.Equal(t, context.Canceled, err)
+	resume()
+	assert.Eventually(t, func() bool {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		return s.clientSubscriptionHandle == 1 && len(s.subscriptions) == 0
+	}, 2*time.Second, 5*time.Millisecond)
+
+	sub, _, _, err := s.CreateEventSubscriptionContext(context.Background(), true, 100, 5, 10)
+	require.NoError(t, err)
+	active, bufferTime, maxSize, _, err := sub.GetStateContext(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, active)
+	assert.Equal(t, uint32(100), bufferTime)
+	assert.Equal(t, uint32(5), maxSize)
+	require.NoError(t, sub.SetFilterContext(context.Background(), nil, nil, 500, 1000, []string{"Plant.Area1"}, nil))
+	_, _, low, _, areas, _, err := sub.GetFilterContext(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(500), low)
+	assert.Equal(t, []string{"Plant.Area1"}, areas)
+	resume = s.HangNext("Refresh")
+	assert.Equal(t, context.DeadlineExceeded, sub.RefreshContext(context.Background()))
+	resume()
+
+	browser, err := s.CreateAreaBrowserContext(context.Background())
+	require.NoError(t, err)
+	defer browser.Release()
+	resume = s.HangNext("BrowseOPCAreas")
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = browser.BrowseOPCAreasContext(ctx, opcae.OPC_AREA, "")
+	assert.Equal(t, context.DeadlineExceeded, err)
+	resume()
+	areas, err = browser.BrowseOPCAreasContext(context.Background(), opcae.OPC_AREA, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Plant"}, areas)
+}
+
+func TestServer_DisconnectWaitsForAbandonedCall(t *testing.T) {
+	s := newTestServer(t)
+	resume := s.HangNext("GetStatus")
+	defer resume()
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	_, err := s.GetStatusContext(ctx)
+	assert.Equal(t, context.Canceled, err)
+	require.Eventually(t, func() bool { return s.Calls("GetStatus") == 1 }, 2*time.Second, time.Millisecond)
+
+	disconnected := make(chan struct{})
+	go func() {
+		s.Disconnect()
+		close(disconnected)
+	}()
+	select {
+	case <-disconnected:
+		t.Fatal("Disconnect returned during the abandoned GetStatus")
+	case <-time.After(20 * time.Millisecond):
+	}
+	resume()
+	select {
+	case <-disconnected:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Disconnect did not return after the call")
+	}
+	_, err = s.GetStatusContext(context.Background())
+	assert.True(t, opcae.ConnectionLost(err))
+}
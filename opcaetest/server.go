@@ -0,0 +1,955 @@
+// Package opcaetest provides an in-memory OPC AE server for tests.
+//
+// Server implements opcae.EventServer, the area tree, categories, conditions and attributes are configured
+// with the Add methods and conditions are driven with Activate, Deactivate and SetQuality.
+// Subscriptions honour the filter, buffer time, max size and keep-alive time and deliver events to
+// their receiver like OPCEventSubscription.
+package opcaetest
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/huskar-t/opcae"
+)
+
+// OPCAE_STATUS_RUNNING is the server state reported by GetStatus until SetServerState changes it
+const OPCAE_STATUS_RUNNING = opcae.OPCAE_STATUS_RUNNING
+
+var localeIDs = []uint32{0x800, 0x409}
+
+var _ opcae.EventServer = (*Server)(nil)
+
+type Server struct {
+	lock                     sync.Mutex
+	clock                    opcae.Clock
+	root                     *area
+	categories               []*category
+	conditions               []*conditionDefinition
+	subscriptions            []*Subscription
+	clientSubscriptionHandle uint32
+	cookie                   uint32
+	localeID                 uint32
+	clientName               string
+	startTime                time.Time
+	lastUpdateTime           time.Time
+	status                   *connection
+	failures                 map[string]uint32
+	availableFilters         uint32
+	minBufferTime            uint32
+	crashed                  bool
+	serverState              opcae.ServerState
+	hangs                    map[string]chan struct{}
+	hanging                  sync.WaitGroup
+	calls                    map[string]int
+	disconnected             bool
+	timeout                  atomic.Int64
+}
+
+// NewServer returns an empty server, use SetClock before creating subscriptions to replace the system clock
+func NewServer() *Server {
+	return &Server{
+		clock:            opcae.SystemClock,
+		root:             newArea("", nil),
+		localeID:         localeIDs[0],
+		startTime:        opcae.SystemClock.Now(),
+		status:           newConnection(),
+		failures:         make(map[string]uint32),
+		hangs:            make(map[string]chan struct{}),
+		calls:            make(map[string]int),
+		availableFilters: 0x1F,
+		serverState:      OPCAE_STATUS_RUNNING,
+	}
+}
+
+// SetAvailableFilters replaces the filter kinds returned by QueryAvailableFilters, by default all are available
+func (s *Server) SetAvailableFilters(filters ...opcae.Filter) {
+	s.lock.Lock()
+	s.availableFilters = opcae.MarshalFilter(filters)
+	s.lock.Unlock()
+}
+
+// SetServerState sets the server state reported by GetStatus
+func (s *Server) SetServerState(state opcae.ServerState) {
+	s.lock.Lock()
+	s.serverState = state
+	s.lock.Unlock()
+}
+
+// SetMinBufferTime makes the server revise shorter buffer times of subscriptions to min and return
+// OPC_S_INVALIDBUFFERTIME, like servers that cannot send notifications at any rate
+func (s *Server) SetMinBufferTime(min uint32) {
+	s.lock.Lock()
+	s.minBufferTime = min
+	s.lock.Unlock()
+}
+
+// reviseBufferTime returns the buffer time the server grants, with OPC_S_INVALIDBUFFERTIME when it differs
+// from the requested one. s.lock must be held.
+func (s *Server) reviseBufferTime(op string, bufferTime uint32) (uint32, error) {
+	if bufferTime < s.minBufferTime {
+		return s.minBufferTime, opcae.NewOPCError(op, "", opcae.OPC_S_INVALIDBUFFERTIME)
+	}
+	return bufferTime, nil
+}
+
+// SetClock replaces the clock of the server, the server start time is reset to the time of clock
+func (s *Server) SetClock(clock opcae.Clock) {
+	s.lock.Lock()
+	s.clock = clock
+	s.startTime = clock.Now()
+	s.lock.Unlock()
+}
+
+// Crash makes every further call fail with RPC_S_SERVER_UNAVAILABLE like a server process that died
+func (s *Server) Crash() {
+	s.lock.Lock()
+	s.crashed = true
+	s.lock.Unlock()
+}
+
+// Calls returns how often the method op was called
+func (s *Server) Calls(op string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.calls[op]
+}
+
+// FailNext makes the next call of the method op return an *opcae.OPCError with code
+func (s *Server) FailNext(op string, code uint32) {
+	s.lock.Lock()
+	s.failures[op] = code
+	s.lock.Unlock()
+}
+
+// HangNext makes the next call of the method op hang like a DCOM call to an unresponsive server until resume
+// is called, calls of other goroutines are not affected
+func (s *Server) HangNext(op string) (resume func()) {
+	ch := make(chan struct{})
+	s.lock.Lock()
+	s.hangs[op] = ch
+	s.lock.Unlock()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(ch) })
+	}
+}
+
+// call returns the error for op injected with FailNext, or an error when the client disconnected or the server
+// crashed. A call that hangs holds Disconnect until it is resumed. s.lock must be held.
+func (s *Server) call(op string) error {
+	s.calls[op]++
+	if s.disconnected {
+		return opcae.NewOPCError(op, "", opcae.CO_E_OBJNOTCONNECTED)
+	}
+	if ch, ok := s.hangs[op]; ok {
+		delete(s.hangs, op)
+		s.hanging.Add(1)
+		s.lock.Unlock()
+		<-ch
+		s.lock.Lock()
+		s.hanging.Done()
+	}
+	if s.crashed {
+		return opcae.NewOPCError(op, "", opcae.RPC_S_SERVER_UNAVAILABLE)
+	}
+	if code, ok := s.failures[op]; ok {
+		delete(s.failures, op)
+		return opcae.NewOPCError(op, "", code)
+	}
+	return nil
+}
+
+// AddArea adds the area and the areas above it
+func (s *Server) AddArea(qualifiedName string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.addArea(splitQualified(qualifiedName))
+}
+
+func (s *Server) addArea(path []string) *area {
+	a := s.root
+	for _, name := range path {
+		child := a.area(name)
+		if child == nil {
+			child = newArea(name, a)
+			a.areas = append(a.areas, child)
+		}
+		a = child
+	}
+	return a
+}
+
+// AddCategory adds an event category with its attributes
+func (s *Server) AddCategory(id uint32, eventType opcae.EventCategoryType, description string, attributes ...*opcae.EventAttribute) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.category(id) != nil {
+		return fmt.Errorf("opcaetest: category %d already exists", id)
+	}
+	s.categories = append(s.categories, &category{
+		id:          id,
+		eventType:   eventType,
+		description: description,
+		attributes:  attributes,
+	})
+	return nil
+}
+
+// AddCondition adds a condition of a condition event category.
+// A condition without sub-conditions is a single state condition, it gets one sub-condition named after the condition.
+func (s *Server) AddCondition(name string, categoryID uint32, subConditions ...*opcae.SubCondition) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	c := s.category(categoryID)
+	if c == nil || c.eventType != opcae.OPC_CONDITION_EVENT {
+		return fmt.Errorf("opcaetest: category %d is not a condition event category", categoryID)
+	}
+	if s.conditionDefinition(name) != nil {
+		return fmt.Errorf("opcaetest: condition %s already exists", name)
+	}
+	if len(subConditions) == 0 {
+		subConditions = []*opcae.SubCondition{{Name: name, Definition: name, Severity: 500, Description: name}}
+	}
+	s.conditions = append(s.conditions, &conditionDefinition{
+		name:          name,
+		category:      c,
+		subConditions: subConditions,
+	})
+	return nil
+}
+
+// AddSource adds a source with instances of the conditions, the part of qualifiedName before the last
+// separator is the area of the source
+func (s *Server) AddSource(qualifiedName string, conditions ...string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	path := splitQualified(qualifiedName)
+	if len(path) == 0 {
+		return fmt.Errorf("opcaetest: empty source name")
+	}
+	a := s.addArea(path[:len(path)-1])
+	if a.source(path[len(path)-1]) != nil {
+		return fmt.Errorf("opcaetest: source %s already exists", qualifiedName)
+	}
+	src := &source{
+		name:       path[len(path)-1],
+		qualified:  qualifiedName,
+		area:       a,
+		enabled:    true,
+		attributes: make(map[uint32]interface{}),
+	}
+	for _, name := range conditions {
+		definition := s.conditionDefinition(name)
+		if definition == nil {
+			return fmt.Errorf("opcaetest: unknown condition %s", name)
+		}
+		c := newCondition(src, definition)
+		c.SetEnabled(src.effectivelyEnabled(), s.clock.Now())
+		src.conditions = append(src.conditions, c)
+	}
+	a.sources = append(a.sources, src)
+	return nil
+}
+
+// Activate moves the condition into the sub-condition, an empty subCondition selects the first sub-condition.
+// Disabled conditions return opcae.ErrConditionDisabled.
+func (s *Server) Activate(sourceName, conditionName, subCondition, message string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	c, err := s.findCondition(sourceName, conditionName)
+	if err != nil {
+		return err
+	}
+	s.cookie++
+	mask, err := c.Activate(subCondition, message, s.clock.Now(), s.cookie)
+	if err != nil {
+		return err
+	}
+	s.publishCondition(c, mask, "")
+	return nil
+}
+
+// Deactivate returns the condition to normal
+func (s *Server) Deactivate(sourceName, conditionName, message string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	c, err := s.findCondition(sourceName, conditionName)
+	if err != nil {
+		return err
+	}
+	mask, err := c.Deactivate(message, s.clock.Now())
+	if err != nil {
+		return err
+	}
+	s.publishCondition(c, mask, "")
+	return nil
+}
+
+func (s *Server) SetQuality(sourceName, conditionName string, quality uint16) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	c, err := s.findCondition(sourceName, conditionName)
+	if err != nil {
+		return err
+	}
+	s.publishCondition(c, c.SetQuality(quality), "")
+	return nil
+}
+
+// SetAttributeValue sets the value of an attribute of a condition, or of the source for simple and tracking
+// events when conditionName is empty. The value is sent with the next event.
+func (s *Server) SetAttributeValue(sourceName, conditionName string, attributeID uint32, value interface{}) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if conditionName == "" {
+		src := s.findSource(sourceName)
+		if src == nil {
+			return fmt.Errorf("opcaetest: unknown source %s", sourceName)
+		}
+		src.attributes[attributeID] = value
+		return nil
+	}
+	c, err := s.findCondition(sourceName, conditionName)
+	if err != nil {
+		return err
+	}
+	c.attributes[attributeID] = value
+	return nil
+}
+
+// FireEvent sends a simple or tracking event, actorID is only used by tracking events
+func (s *Server) FireEvent(sourceName string, categoryID, severity uint32, message, actorID string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	src := s.findSource(sourceName)
+	if src == nil {
+		return fmt.Errorf("opcaetest: unknown source %s", sourceName)
+	}
+	c := s.category(categoryID)
+	if c == nil || c.eventType == opcae.OPC_CONDITION_EVENT {
+		return fmt.Errorf("opcaetest: category %d is not a simple or tracking event category", categoryID)
+	}
+	event := &opcae.OnEventStruct{
+		Source:    src.qualified,
+		Time:      s.clock.Now(),
+		Message:   message,
+		EventType: uint32(c.eventType),
+		Category:  c.id,
+		Severity:  severity,
+		Quality:   opcae.OPC_QUALITY_GOOD,
+	}
+	if c.eventType == opcae.OPC_TRACKING_EVENT {
+		event.ActorID = actorID
+	}
+	s.publish(event, src, src.attributes)
+	return nil
+}
+
+// Shutdown sends a shutdown request with the reason to the client
+func (s *Server) Shutdown(reason string) {
+	s.status.Shutdown(reason)
+}
+
+func (s *Server) category(id uint32) *category {
+	for _, c := range s.categories {
+		if c.id == id {
+			return c
+		}
+	}
+	return nil
+}
+
+func (s *Server) conditionDefinition(name string) *conditionDefinition {
+	for _, d := range s.conditions {
+		if d.name == name {
+			return d
+		}
+	}
+	return nil
+}
+
+func (s *Server) findArea(qualifiedName string) *area {
+	path := splitQualified(qualifiedName)
+	if len(path) == 0 {
+		return nil
+	}
+	a := s.root
+	for _, name := range path {
+		if a = a.area(name); a == nil {
+			return nil
+		}
+	}
+	return a
+}
+
+func (s *Server) findSource(qualifiedName string) *source {
+	path := splitQualified(qualifiedName)
+	if len(path) == 0 {
+		return nil
+	}
+	a := s.root
+	for _, name := range path[:len(path)-1] {
+		if a = a.area(name); a == nil {
+			return nil
+		}
+	}
+	return a.source(path[len(path)-1])
+}
+
+func (s *Server) findCondition(sourceName, conditionName string) (*condition, error) {
+	src := s.findSource(sourceName)
+	if src == nil {
+		return nil, fmt.Errorf("opcaetest: unknown source %s", sourceName)
+	}
+	c := src.condition(conditionName)
+	if c == nil {
+		return nil, fmt.Errorf("opcaetest: source %s has no condition %s", sourceName, conditionName)
+	}
+	return c, nil
+}
+
+// conditionEvent returns the event for a change of c, refresh events have an empty mask and report the time
+// of the last event of c
+func (s *Server) conditionEvent(c *condition, mask opcae.ChangeMask, actorID string) *opcae.OnEventStruct {
+	if mask != 0 || c.eventTime.IsZero() {
+		c.eventTime = s.clock.Now()
+	}
+	return &opcae.OnEventStruct{
+		ChangeMask: opcae.ParseChangeMask(uint16(mask)),
+		NewState:   c.State(),
+		Source:     c.source.qualified,
+		Time:       c.eventTime,
+		Message:    c.Message,
+		EventType:  uint32(opcae.OPC_CONDITION_EVENT),
+		Category:   c.definition.category.id,
+		Severity:   c.Severity(),
+		Condition:  c.definition.name,
+		Subcond:    c.SubCondition.Name,
+		Quality:    c.Quality,
+		AckReq:     !c.Acked,
+		ActiveTime: c.ActiveTime,
+		Cookie:     c.Cookie,
+		ActorID:    actorID,
+	}
+}
+
+// publishCondition sends a condition event for a state change, nothing is sent when mask is empty
+func (s *Server) publishCondition(c *condition, mask opcae.ChangeMask, actorID string) {
+	if mask == 0 {
+		return
+	}
+	s.publish(s.conditionEvent(c, mask, actorID), c.source, c.attributes)
+}
+
+func (s *Server) publish(event *opcae.OnEventStruct, src *source, attributes map[uint32]interface{}) {
+	for _, sub := range s.subscriptions {
+		sub.enqueue(event, src, attributes)
+	}
+}
+
+// updateEnableState applies the enable state of the areas and sources to their conditions
+func (s *Server) updateEnableState() {
+	now := s.clock.Now()
+	s.root.walk(func(*area) {}, func(src *source) {
+		enabled := src.effectivelyEnabled()
+		for _, c := range src.conditions {
+			s.publishCondition(c, c.SetEnabled(enabled, now), "")
+		}
+	})
+}
+
+func (s *Server) RegisterServerShutDown(ch chan string) {
+	s.status.AddReceiver(ch)
+}
+
+func (s *Server) ConnectionState() opcae.ConnectionState {
+	return s.status.State()
+}
+
+func (s *Server) ShutdownReason() string {
+	return s.status.Reason()
+}
+
+func (s *Server) ShutdownNotify() <-chan struct{} {
+	return s.status.Done()
+}
+
+func (s *Server) SetLocaleID(localeID uint32) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.call("SetLocaleID"); err != nil {
+		return err
+	}
+	for _, id := range localeIDs {
+		if id == localeID {
+			s.localeID = localeID
+			return nil
+		}
+	}
+	return opcae.NewOPCError("SetLocaleID", "", opcae.E_INVALIDARG)
+}
+
+func (s *Server) GetLocaleID() (uint32, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.call("GetLocaleID"); err != nil {
+		return 0, err
+	}
+	return s.localeID, nil
+}
+
+func (s *Server) QueryAvailableLocaleIDs() ([]uint32, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.call("QueryAvailableLocaleIDs"); err != nil {
+		return nil, err
+	}
+	return append([]uint32(nil), localeIDs...), nil
+}
+
+func (s *Server) SetClientName(clientName string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.call("SetClientName"); err != nil {
+		return err
+	}
+	s.clientName = clientName
+	return nil
+}
+
+func (s *Server) GetClientName() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.clientName
+}
+
+// GetErrorString returns the symbolic name of the code
+func (s *Server) GetErrorString(errorCode int32) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.call("GetErrorString"); err != nil {
+		return "", err
+	}
+	name := opcae.CodeName(uint32(errorCode))
+	if name == "" {
+		return "", opcae.NewOPCError("GetErrorString", "", opcae.E_INVALIDARG)
+	}
+	return name, nil
+}
+
+func (s *Server) GetStatus() (*opcae.EventServerStatus, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.call("GetStatus"); err != nil {
+		return nil, err
+	}
+	return &opcae.EventServerStatus{
+		StartTime:      s.startTime,
+		CurrentTime:    s.clock.Now(),
+		LastUpdateTime: s.lastUpdateTime,
+		ServerState:    s.serverState,
+		MajorVersion:   1,
+		MinorVersion:   10,
+		VendorInfo:     "opcaetest",
+	}, nil
+}
+
+// CreateEventSubscription creates a subscription with the default filter, the buffer time and max size are not revised
+func (s *Server) CreateEventSubscription(active bool, bufferTime, maxSize, receiverBufSize uint32, opts ...opcae.SubscriptionOption) (opcae.EventSubscription, uint32, uint32, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.call("CreateEventSubscription"); err != nil {
+		return nil, 0, 0, err
+	}
+	s.clientSubscriptionHandle++
+	bufferTime, revised := s.reviseBufferTime("CreateEventSubscription", bufferTime)
+	sub := newSubscription(s, s.clientSubscriptionHandle, active, bufferTime, maxSize, receiverBufSize, opts)
+	s.subscriptions = append(s.subscriptions, sub)
+	go sub.run()
+	return sub, bufferTime, maxSize, revised
+}
+
+func (s *Server) removeSubscription(sub *Subscription) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for i, v := range s.subscriptions {
+		if v == sub {
+			s.subscriptions = append(s.subscriptions[:i], s.subscriptions[i+1:]...)
+			return
+		}
+	}
+}
+
+func (s *Server) QueryAvailableFilters() ([]opcae.Filter, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.call("QueryAvailableFilters"); err != nil {
+		return nil, err
+	}
+	return opcae.ParseFilter(s.availableFilters), nil
+}
+
+func (s *Server) QueryEventCategories(categories []opcae.EventCategoryType) ([]*opcae.EventCategory, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.call("QueryEventCategories"); err != nil {
+		return nil, err
+	}
+	eventTypes := opcae.MarshalEventCategoryType(categories)
+	var result []*opcae.EventCategory
+	for _, c := range s.categories {
+		if eventTypes&uint32(c.eventType) != 0 {
+			result = append(result, &opcae.EventCategory{ID: c.id, Description: c.description})
+		}
+	}
+	return result, nil
+}
+
+func (s *Server) QueryConditionNames(categories []opcae.EventCategoryType) ([]string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.call("QueryConditionNames"); err != nil {
+		return nil, err
+	}
+	var names []string
+	if opcae.MarshalEventCategoryType(categories)&uint32(opcae.OPC_CONDITION_EVENT) == 0 {
+		return names, nil
+	}
+	for _, d := range s.conditions {
+		names = append(names, d.name)
+	}
+	return names, nil
+}
+
+func (s *Server) QuerySourceConditions(sourceName string) ([]string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.call("QuerySourceConditions"); err != nil {
+		return nil, err
+	}
+	src := s.findSource(sourceName)
+	if src == nil {
+		return nil, opcae.NewOPCError("QuerySourceConditions", sourceName, opcae.E_INVALIDARG)
+	}
+	names := make([]string, len(src.conditions))
+	for i, c := range src.conditions {
+		names[i] = c.definition.name
+	}
+	return names, nil
+}
+
+func (s *Server) QuerySubConditionNames(conditionName string) ([]string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.call("QuerySubConditionNames"); err != nil {
+		return nil, err
+	}
+	d := s.conditionDefinition(conditionName)
+	if d == nil {
+		return nil, opcae.NewOPCError("QuerySubConditionNames", conditionName, opcae.E_INVALIDARG)
+	}
+	names := make([]string, len(d.subConditions))
+	for i, sc := range d.subConditions {
+		names[i] = sc.Name
+	}
+	return names, nil
+}
+
+func (s *Server) QueryEventAttributes(eventCategoryID uint32) ([]*opcae.EventAttribute, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.call("QueryEventAttributes"); err != nil {
+		return nil, err
+	}
+	c := s.category(eventCategoryID)
+	if c == nil {
+		return nil, opcae.NewOPCError("QueryEventAttributes", strconv.FormatUint(uint64(eventCategoryID), 10), opcae.E_INVALIDARG)
+	}
+	result := make([]*opcae.EventAttribute, len(c.attributes))
+	for i, attribute := range c.attributes {
+		copied := *attribute
+		result[i] = &copied
+	}
+	return result, nil
+}
+
+// TranslateToItemIDs returns item IDs of the form source.condition.attributeID, the node name is empty
+func (s *Server) TranslateToItemIDs(sourceName string, eventCategoryID uint32, conditionName string, subConditionName string, assocAttrIDs []uint32) ([]*opcae.ItemID, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.call("TranslateToItemIDs"); err != nil {
+		return nil, err
+	}
+	c := s.category(eventCategoryID)
+	if s.findSource(sourceName) == nil || c == nil {
+		return nil, opcae.NewOPCError("TranslateToItemIDs", sourceName, opcae.E_INVALIDARG)
+	}
+	prefix := sourceName
+	if conditionName != "" {
+		prefix = qualify(prefix, conditionName)
+	}
+	result := make([]*opcae.ItemID, len(assocAttrIDs))
+	for i, id := range assocAttrIDs {
+		result[i] = &opcae.ItemID{}
+		if c.attribute(id) != nil {
+			result[i].ID = qualify(prefix, strconv.FormatUint(uint64(id), 10))
+		}
+	}
+	return result, nil
+}
+
+func (s *Server) GetConditionState(sourceName, conditionName string, eventCategoryID uint32, attributeIDs []uint32) (*opcae.ConditionState, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.call("GetConditionState"); err != nil {
+		return nil, err
+	}
+	c, err := s.findCondition(sourceName, conditionName)
+	if err != nil {
+		return nil, opcae.NewOPCError("GetConditionState", sourceName+"/"+conditionName, opcae.E_INVALIDARG)
+	}
+	if len(attributeIDs) == 0 {
+		for _, attribute := range c.definition.category.attributes {
+			attributeIDs = append(attributeIDs, attribute.ID)
+		}
+	}
+	result := &opcae.ConditionState{
+		State:              c.State(),
+		ActiveSubCondition: c.SubCondition.Name,
+		ASCDefinition:      c.SubCondition.Definition,
+		ASCSeverity:        c.SubCondition.Severity,
+		ASCDescription:     c.SubCondition.Description,
+		Quality:            c.Quality,
+		LastAckTime:        c.LastAckTime,
+		SubCondLastActive:  c.SubCondLastActive,
+		CondLastActive:     c.CondLastActive,
+		CondLastInactive:   c.CondLastInactive,
+		AcknowledgerID:     c.AcknowledgerID,
+		Comment:            c.Comment,
+		SubConditions:      make([]*opcae.SubCondition, len(c.definition.subConditions)),
+		Attributes:         make([]*opcae.ConditionAttribute, 0, len(attributeIDs)),
+		AttributesByID:     make(map[uint32]*opcae.ConditionAttribute, len(attributeIDs)),
+		AttributesByName:   make(map[string]*opcae.ConditionAttribute, len(attributeIDs)),
+	}
+	if !c.Active {
+		result.ActiveSubCondition = ""
+		result.ASCDefinition = ""
+		result.ASCSeverity = 0
+		result.ASCDescription = ""
+	}
+	for i, sc := range c.definition.subConditions {
+		copied := *sc
+		result.SubConditions[i] = &copied
+	}
+	for _, id := range attributeIDs {
+		attribute := &opcae.ConditionAttribute{ID: id}
+		if definition := c.definition.category.attribute(id); definition != nil {
+			attribute.Description = definition.Description
+			attribute.Type = definition.Type
+			attribute.Value = c.attributes[id]
+			result.AttributesByName[attribute.Description] = attribute
+		} else {
+			attribute.Err = opcae.NewOPCError("GetConditionState", strconv.FormatUint(uint64(id), 10), opcae.E_INVALIDARG)
+		}
+		result.Attributes = append(result.Attributes, attribute)
+		result.AttributesByID[id] = attribute
+	}
+	return result, nil
+}
+
+func (s *Server) AckConditions(acknowledgerID, comment string, requests []*opcae.AckRequest) ([]*opcae.AckResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.call("AckConditions"); err != nil {
+		return nil, err
+	}
+	if len(requests) == 0 {
+		return nil, nil
+	}
+	if acknowledgerID == "" {
+		return nil, opcae.NewOPCError("AckConditions", "", opcae.E_INVALIDARG)
+	}
+	now := s.clock.Now()
+	results := make([]*opcae.AckResult, len(requests))
+	for i, request := range requests {
+		c, err := s.findCondition(request.Source, request.Condition)
+		if err != nil {
+			results[i] = ackResult(request, opcae.E_INVALIDARG)
+			continue
+		}
+		mask, err := c.Acknowledge(acknowledgerID, comment, request.ActiveTime, request.Cookie, now)
+		var opcErr *opcae.OPCError
+		if errors.As(err, &opcErr) {
+			results[i] = ackResult(request, opcErr.Code)
+			continue
+		}
+		s.publishCondition(c, mask, acknowledgerID)
+		results[i] = ackResult(request, 0)
+	}
+	return results, nil
+}
+
+func ackResult(request *opcae.AckRequest, code uint32) *opcae.AckResult {
+	result := &opcae.AckResult{Request: request, Code: code}
+	switch code {
+	case 0:
+		result.Status = opcae.AckSucceeded
+	case opcae.OPC_S_ALREADYACKED:
+		result.Status = opcae.AckAlreadyAcked
+	case opcae.OPC_E_INVALIDTIME:
+		result.Status = opcae.AckInvalidTime
+		result.Err = opcae.NewOPCError("AckConditions", request.Source+"/"+request.Condition, code)
+	default:
+		result.Status = opcae.AckFailed
+		result.Err = opcae.NewOPCError("AckConditions", request.Source+"/"+request.Condition, code)
+	}
+	return result
+}
+
+// setAreaEnabled changes the enable state of the areas, the areas and sources below them keep their own
+// state and are effectively enabled only while all areas above them are enabled
+func (s *Server) setAreaEnabled(op string, areas []string, enabled bool) ([]error, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.call(op); err != nil {
+		return nil, err
+	}
+	errs := make([]error, len(areas))
+	for i, name := range areas {
+		a := s.findArea(name)
+		if a == nil {
+			errs[i] = opcae.NewOPCError(op, name, opcae.E_INVALIDARG)
+			continue
+		}
+		a.enabled = enabled
+	}
+	s.updateEnableState()
+	return errs, nil
+}
+
+func (s *Server) setSourceEnabled(op string, sources []string, enabled bool) ([]error, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.call(op); err != nil {
+		return nil, err
+	}
+	errs := make([]error, len(sources))
+	for i, name := range sources {
+		src := s.findSource(name)
+		if src == nil {
+			errs[i] = opcae.NewOPCError(op, name, opcae.E_INVALIDARG)
+			continue
+		}
+		src.enabled = enabled
+	}
+	s.updateEnableState()
+	return errs, nil
+}
+
+func (s *Server) EnableConditionByArea(areas []string) ([]error, error) {
+	return s.setAreaEnabled("EnableConditionByArea", areas, true)
+}
+
+func (s *Server) EnableConditionBySource(sources []string) ([]error, error) {
+	return s.setSourceEnabled("EnableConditionBySource", sources, true)
+}
+
+func (s *Server) DisableConditionByArea(areas []string) ([]error, error) {
+	return s.setAreaEnabled("DisableConditionByArea", areas, false)
+}
+
+func (s *Server) DisableConditionBySource(sources []string) ([]error, error) {
+	return s.setSourceEnabled("DisableConditionBySource", sources, false)
+}
+
+// SupportsEventServer2 is always true
+func (s *Server) SupportsEventServer2() bool {
+	return true
+}
+
+func (s *Server) EnableConditionByArea2(areas []string) ([]error, error) {
+	return s.setAreaEnabled("EnableConditionByArea2", areas, true)
+}
+
+func (s *Server) EnableConditionBySource2(sources []string) ([]error, error) {
+	return s.setSourceEnabled("EnableConditionBySource2", sources, true)
+}
+
+func (s *Server) DisableConditionByArea2(areas []string) ([]error, error) {
+	return s.setAreaEnabled("DisableConditionByArea2", areas, false)
+}
+
+func (s *Server) DisableConditionBySource2(sources []string) ([]error, error) {
+	return s.setSourceEnabled("DisableConditionBySource2", sources, false)
+}
+
+func (s *Server) GetEnableStateByArea(areas []string) ([]*opcae.EnableState, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.call("GetEnableStateByArea"); err != nil {
+		return nil, err
+	}
+	result := make([]*opcae.EnableState, len(areas))
+	for i, name := range areas {
+		result[i] = &opcae.EnableState{Name: name}
+		a := s.findArea(name)
+		if a == nil {
+			result[i].Err = opcae.NewOPCError("GetEnableStateByArea", name, opcae.E_INVALIDARG)
+			continue
+		}
+		result[i].Enabled = a.enabled
+		result[i].EffectivelyEnabled = a.effectivelyEnabled()
+	}
+	return result, nil
+}
+
+func (s *Server) GetEnableStateBySource(sources []string) ([]*opcae.EnableState, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.call("GetEnableStateBySource"); err != nil {
+		return nil, err
+	}
+	result := make([]*opcae.EnableState, len(sources))
+	for i, name := range sources {
+		result[i] = &opcae.EnableState{Name: name}
+		src := s.findSource(name)
+		if src == nil {
+			result[i].Err = opcae.NewOPCError("GetEnableStateBySource", name, opcae.E_INVALIDARG)
+			continue
+		}
+		result[i].Enabled = src.enabled
+		result[i].EffectivelyEnabled = src.effectivelyEnabled()
+	}
+	return result, nil
+}
+
+func (s *Server) CreateAreaBrowser() (opcae.AreaBrowser, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.call("CreateAreaBrowser"); err != nil {
+		return nil, err
+	}
+	return &AreaBrowser{server: s, position: s.root}, nil
+}
+
+// Disconnect releases all subscriptions, later calls fail with CO_E_OBJNOTCONNECTED. Like
+// OPCEventServer.Disconnect it waits for the calls in progress, including hung calls.
+func (s *Server) Disconnect() error {
+	s.lock.Lock()
+	s.disconnected = true
+	s.lock.Unlock()
+	s.hanging.Wait()
+	s.lock.Lock()
+	subscriptions := append([]*Subscription(nil), s.subscriptions...)
+	s.lock.Unlock()
+	for _, sub := range subscriptions {
+		sub.Release()
+	}
+	s.status.Disconnect()
+	return nil
+}
@@ -0,0 +1,251 @@
+package opcaetest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/huskar-t/opcae"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	systemCategory   uint32 = 1
+	operatorCategory uint32 = 2
+	levelCategory    uint32 = 100
+	valueAttribute   uint32 = 1
+	limitAttribute   uint32 = 2
+)
+
+func newTestServer(t *testing.T) *Server {
+	s := NewServer()
+	require.NoError(t, s.AddCategory(systemCategory, opcae.OPC_SIMPLE_EVENT, "System"))
+	require.NoError(t, s.AddCategory(operatorCategory, opcae.OPC_TRACKING_EVENT, "Operator"))
+	require.NoError(t, s.AddCategory(levelCategory, opcae.OPC_CONDITION_EVENT, "Level",
+		&opcae.EventAttribute{ID: valueAttribute, Description: "CV", Type: 5},
+		&opcae.EventAttribute{ID: limitAttribute, Description: "Limit", Type: 5},
+	))
+	require.NoError(t, s.AddCondition("LEVEL", levelCategory,
+		&opcae.SubCondition{Name: "HI", Definition: "CV > 80", Severity: 600, Description: "High"},
+		&opcae.SubCondition{Name: "HIHI", Definition: "CV > 95", Severity: 800, Description: "High high"},
+	))
+	require.NoError(t, s.AddCondition("COMM", levelCategory))
+	require.NoError(t, s.AddSource("Plant.Area1.Tank1", "LEVEL", "COMM"))
+	require.NoError(t, s.AddSource("Plant.Area2.Pump1", "COMM"))
+	t.Cleanup(func() { s.Disconnect() })
+	return s
+}
+
+func receive(t *testing.T, sub opcae.EventSubscription) *opcae.EventSinkOnEventData {
+	t.Helper()
+	select {
+	case data := <-sub.GetReceiver():
+		return data
+	case <-time.After(2 * time.Second):
+		t.Fatal("no callback received")
+		return nil
+	}
+}
+
+// receiveEvents receives callbacks until n events arrived
+func receiveEvents(t *testing.T, sub opcae.EventSubscription, n int) []*opcae.OnEventStruct {
+	t.Helper()
+	var events []*opcae.OnEventStruct
+	for len(events) < n {
+		events = append(events, receive(t, sub).Events...)
+	}
+	return events
+}
+
+func assertNoCallback(t *testing.T, sub opcae.EventSubscription) {
+	t.Helper()
+	select {
+	case data := <-sub.GetReceiver():
+		t.Fatalf("unexpected callback %+v", data)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestServer_Browse(t *testing.T) {
+	s := newTestServer(t)
+	browser, err := s.CreateAreaBrowser()
+	require.NoError(t, err)
+	defer browser.Release()
+	areas, err := browser.BrowseOPCAreas(opcae.OPC_AREA, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Plant"}, areas)
+	assert.Error(t, browser.MoveUP())
+	assert.NoError(t, browser.MoveDown("Plant"))
+	areas, err = browser.BrowseOPCAreas(opcae.OPC_AREA, "*2")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Area2"}, areas)
+	qualified, err := browser.GetQualifiedAreaName("Area1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Plant.Area1", qualified)
+	assert.NoError(t, browser.MoveDown("Area1"))
+	sources, err := browser.BrowseOPCAreas(opcae.OPC_SOURCE, "")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Tank1"}, sources)
+	qualified, err = browser.GetQualifiedSourceName("Tank1")
+	assert.NoError(t, err)
+	assert.Equal(t, "Plant.Area1.Tank1", qualified)
+	_, err = browser.GetQualifiedSourceName("Tank2")
+	assert.True(t, errors.Is(err, opcae.NewOPCError("", "", opcae.E_INVALIDARG)))
+	assert.NoError(t, browser.MoveToRoot())
+}
+
+func TestServer_Query(t *testing.T) {
+	s := newTestServer(t)
+	categories, err := s.QueryEventCategories([]opcae.EventCategoryType{opcae.OPC_CONDITION_EVENT})
+	assert.NoError(t, err)
+	assert.Equal(t, []*opcae.EventCategory{{ID: levelCategory, Description: "Level"}}, categories)
+	names, err := s.QueryConditionNames([]opcae.EventCategoryType{opcae.OPC_ALL_EVENTS})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"LEVEL", "COMM"}, names)
+	names, err = s.QuerySourceConditions("Plant.Area1.Tank1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"LEVEL", "COMM"}, names)
+	names, err = s.QuerySubConditionNames("LEVEL")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"HI", "HIHI"}, names)
+	attributes, err := s.QueryEventAttributes(levelCategory)
+	assert.NoError(t, err)
+	assert.Len(t, attributes, 2)
+	_, err = s.QueryEventAttributes(42)
+	assert.Error(t, err)
+	ids, err := s.TranslateToItemIDs("Plant.Area1.Tank1", levelCategory, "LEVEL", "HI", []uint32{valueAttribute})
+	assert.NoError(t, err)
+	assert.Equal(t, "Plant.Area1.Tank1.LEVEL.1", ids[0].ID)
+}
+
+func TestServer_ConditionLifecycle(t *testing.T) {
+	s := newTestServer(t)
+	sub, _, _, err := s.CreateEventSubscription(true, 0, 0, 10)
+	require.NoError(t, err)
+	require.NoError(t, s.SetAttributeValue("Plant.Area1.Tank1", "LEVEL", valueAttribute, 85.0))
+	require.NoError(t, sub.SelectReturnedAttributes(levelCategory, []uint32{valueAttribute}))
+
+	require.NoError(t, s.Activate("Plant.Area1.Tank1", "LEVEL", "HI", "level high"))
+	event := receive(t, sub).Events[0]
+	assert.Equal(t, opcae.OPC_CONDITION_ENABLED|opcae.OPC_CONDITION_ACTIVE, event.NewState)
+	assert.Contains(t, event.ChangeMask, opcae.OPC_CHANGE_ACTIVE_STATE)
+	assert.Contains(t, event.ChangeMask, opcae.OPC_CHANGE_ACK_STATE)
+	assert.Equal(t, uint32(600), event.Severity)
+	assert.Equal(t, "HI", event.Subcond)
+	assert.True(t, event.AckReq)
+	assert.Equal(t, []interface{}{85.0}, event.Attributes)
+
+	stale := event.AckRequest()
+	stale.ActiveTime = stale.ActiveTime.Add(-time.Second)
+	results, err := s.AckConditions("operator", "", []*opcae.AckRequest{stale})
+	assert.NoError(t, err)
+	assert.Equal(t, opcae.AckInvalidTime, results[0].Status)
+	assert.True(t, errors.Is(results[0].Err, opcae.ErrInvalidTime))
+
+	results, err = s.AckConditions("operator", "seen", []*opcae.AckRequest{event.AckRequest()})
+	assert.NoError(t, err)
+	assert.Equal(t, opcae.AckSucceeded, results[0].Status)
+	acked := receive(t, sub).Events[0]
+	assert.Equal(t, []opcae.ChangeMask{opcae.OPC_CHANGE_ACK_STATE}, acked.ChangeMask)
+	assert.Equal(t, "operator", acked.ActorID)
+
+	results, err = s.AckConditions("operator", "", []*opcae.AckRequest{event.AckRequest()})
+	assert.NoError(t, err)
+	assert.Equal(t, opcae.AckAlreadyAcked, results[0].Status)
+	assert.NoError(t, results[0].Err)
+
+	require.NoError(t, s.Activate("Plant.Area1.Tank1", "LEVEL", "HIHI", "level high high"))
+	escalated := receive(t, sub).Events[0]
+	assert.ElementsMatch(t, []opcae.ChangeMask{opcae.OPC_CHANGE_ACK_STATE, opcae.OPC_CHANGE_SEVERITY, opcae.OPC_CHANGE_SUBCONDITION, opcae.OPC_CHANGE_MESSAGE}, escalated.ChangeMask)
+	assert.False(t, escalated.NewState.IsAcked())
+	assert.NotEqual(t, event.Cookie, escalated.Cookie)
+
+	require.NoError(t, s.Deactivate("Plant.Area1.Tank1", "LEVEL", "level normal"))
+	normal := receive(t, sub).Events[0]
+	assert.Equal(t, opcae.OPC_CONDITION_ENABLED, normal.NewState)
+
+	state, err := s.GetConditionState("Plant.Area1.Tank1", "LEVEL", levelCategory, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, opcae.OPC_CONDITION_ENABLED, state.State)
+	assert.Equal(t, "operator", state.AcknowledgerID)
+	assert.Equal(t, "seen", state.Comment)
+	assert.Len(t, state.SubConditions, 2)
+	assert.Equal(t, 85.0, state.AttributesByName["CV"].Value)
+	assert.Nil(t, state.AttributesByID[limitAttribute].Value)
+}
+
+func TestServer_FireEvent(t *testing.T) {
+	s := newTestServer(t)
+	sub, _, _, err := s.CreateEventSubscription(true, 0, 0, 10)
+	require.NoError(t, err)
+	require.NoError(t, s.FireEvent("Plant.Area2.Pump1", operatorCategory, 100, "setpoint changed", "operator"))
+	event := receive(t, sub).Events[0]
+	assert.Equal(t, uint32(opcae.OPC_TRACKING_EVENT), event.EventType)
+	assert.Equal(t, "operator", event.ActorID)
+	assert.Error(t, s.FireEvent("Plant.Area2.Pump1", levelCategory, 100, "", ""))
+}
+
+func TestServer_EnableState(t *testing.T) {
+	s := newTestServer(t)
+	sub, _, _, err := s.CreateEventSubscription(true, 0, 0, 10)
+	require.NoError(t, err)
+	require.NoError(t, s.Activate("Plant.Area1.Tank1", "LEVEL", "", "level high"))
+	receive(t, sub)
+
+	errs, err := s.DisableConditionByArea([]string{"Plant.Area1", "Plant.Area9"})
+	assert.NoError(t, err)
+	assert.NoError(t, errs[0])
+	assert.Error(t, errs[1])
+	for _, event := range receiveEvents(t, sub, 2) {
+		assert.Contains(t, event.ChangeMask, opcae.OPC_CHANGE_ENABLE_STATE)
+		assert.False(t, event.NewState.IsEnabled())
+		assert.False(t, event.NewState.IsActive())
+	}
+	assert.Equal(t, opcae.ErrConditionDisabled, s.Activate("Plant.Area1.Tank1", "LEVEL", "", "level high"))
+	assertNoCallback(t, sub)
+
+	_, err = s.DisableConditionByArea2([]string{"Plant"})
+	assert.NoError(t, err)
+	_, err = s.EnableConditionBySource2([]string{"Plant.Area1.Tank1"})
+	assert.NoError(t, err)
+	states, err := s.GetEnableStateBySource([]string{"Plant.Area1.Tank1"})
+	assert.NoError(t, err)
+	assert.True(t, states[0].Enabled)
+	assert.False(t, states[0].EffectivelyEnabled)
+	states, err = s.GetEnableStateByArea([]string{"Plant.Area2"})
+	assert.NoError(t, err)
+	assert.True(t, states[0].Enabled)
+	assert.False(t, states[0].EffectivelyEnabled)
+
+	_, err = s.EnableConditionByArea2([]string{"Plant"})
+	assert.NoError(t, err)
+	states, err = s.GetEnableStateByArea([]string{"Plant.Area1", "Plant.Area2"})
+	assert.NoError(t, err)
+	assert.False(t, states[0].Enabled, "Plant.Area1 was disabled on its own")
+	assert.False(t, states[0].EffectivelyEnabled)
+	assert.True(t, states[1].EffectivelyEnabled)
+}
+
+func TestServer_FailNext(t *testing.T) {
+	s := newTestServer(t)
+	s.FailNext("GetStatus", opcae.RPC_S_SERVER_UNAVAILABLE)
+	_, err := s.GetStatus()
+	assert.True(t, opcae.Retryable(err))
+	status, err := s.GetStatus()
+	assert.NoError(t, err)
+	assert.Equal(t, OPCAE_STATUS_RUNNING, status.ServerState)
+}
+
+func TestServer_Shutdown(t *testing.T) {
+	s := newTestServer(t)
+	ch := make(chan string, 1)
+	s.RegisterServerShutDown(ch)
+	s.Shutdown("maintenance")
+	assert.Equal(t, "maintenance", <-ch)
+	assert.Equal(t, opcae.ConnectionShuttingDown, s.ConnectionState())
+	assert.NoError(t, s.Disconnect())
+	assert.Equal(t, opcae.ConnectionDisconnected, s.ConnectionState())
+	_, err := s.GetStatus()
+	assert.True(t, errors.Is(err, opcae.NewOPCError("", "", opcae.CO_E_OBJNOTCONNECTED)))
+}
@@ -0,0 +1,127 @@
+package opcaetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/huskar-t/opcae"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// offsetClock is the system clock shifted by offset
+type offsetClock struct {
+	offset time.Duration
+}
+
+func (c offsetClock) Now() time.Time {
+	return time.Now().Add(c.offset)
+}
+
+func (c offsetClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func receiveStateChange(t *testing.T, ch <-chan opcae.ServerStateChange) opcae.ServerStateChange {
+	t.Helper()
+	select {
+	case change := <-ch:
+		return change
+	case <-time.After(2 * time.Second):
+		t.Fatal("no state change received")
+		return opcae.ServerStateChange{}
+	}
+}
+
+func TestStatusMonitor(t *testing.T) {
+	s := newTestServer(t)
+	s.SetClock(offsetClock{offset: time.Hour})
+	monitor := opcae.NewStatusMonitor(s, opcae.WithMonitorInterval(10*time.Millisecond))
+	changes := make(chan opcae.ServerStateChange, 10)
+	monitor.Notify(changes)
+
+	health := monitor.Poll()
+	require.NoError(t, health.Err)
+	assert.Equal(t, opcae.OPCAE_STATUS_RUNNING, health.State)
+	assert.InDelta(t, float64(time.Hour), float64(health.ClockOffset), float64(time.Second))
+	assert.InDelta(t, 0, float64(health.Uptime), float64(time.Second), "the server start time follows its clock")
+	assert.Equal(t, health.Uptime, health.Staleness, "no notification was sent yet")
+	change := receiveStateChange(t, changes)
+	assert.Equal(t, opcae.ServerState(0), change.Old)
+	assert.Equal(t, opcae.OPCAE_STATUS_RUNNING, change.New)
+
+	sub, _, _, err := s.CreateEventSubscription(true, 0, 0, 10)
+	require.NoError(t, err)
+	require.NoError(t, s.Activate("Plant.Area1.Tank1", "LEVEL", "", ""))
+	receive(t, sub)
+	health = monitor.Poll()
+	assert.Less(t, health.Staleness, time.Second)
+	assert.Empty(t, changes, "the state did not change")
+
+	monitor.Start()
+	defer monitor.Stop()
+	s.SetServerState(opcae.OPCAE_STATUS_COMM_FAULT)
+	change = receiveStateChange(t, changes)
+	assert.Equal(t, opcae.OPCAE_STATUS_RUNNING, change.Old)
+	assert.Equal(t, "COMM_FAULT", change.New.String())
+
+	s.Crash()
+	change = receiveStateChange(t, changes)
+	assert.Equal(t, "UNKNOWN", change.New.String())
+	assert.True(t, opcae.ConnectionLost(change.Health.Err))
+	assert.Nil(t, change.Health.Status)
+	monitor.Stop()
+	assert.Equal(t, opcae.ServerState(0), monitor.Health().State)
+}
+
+// waitClock is the system clock whose After records the durations and never fires
+type waitClock struct {
+	waits chan time.Duration
+}
+
+func (c waitClock) Now() time.Time {
+	return time.Now()
+}
+
+func (c waitClock) After(d time.Duration) <-chan time.Time {
+	c.waits <- d
+	return nil
+}
+
+func TestStatusMonitor_NonPositiveInterval(t *testing.T) {
+	s := newTestServer(t)
+	clock := waitClock{waits: make(chan time.Duration, 1)}
+	monitor := opcae.NewStatusMonitor(s, opcae.WithMonitorClock(clock), opcae.WithMonitorInterval(0))
+	monitor.Start()
+	defer monitor.Stop()
+	select {
+	case d := <-clock.waits:
+		assert.Equal(t, opcae.DefaultMonitorInterval, d)
+	case <-time.After(2 * time.Second):
+		t.Fatal("the monitor did not wait")
+	}
+	require.NoError(t, monitor.Health().Err)
+}
+
+// epochServer reports the last update time as the FILETIME epoch, like servers that never sent a notification
+type epochServer struct {
+	*Server
+}
+
+func (s epochServer) GetStatusContext(ctx context.Context) (*opcae.EventServerStatus, error) {
+	status, err := s.Server.GetStatusContext(ctx)
+	if err == nil {
+		status.LastUpdateTime = time.Date(1601, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return status, err
+}
+
+func TestStatusMonitor_FiletimeEpoch(t *testing.T) {
+	s := newTestServer(t)
+	time.Sleep(10 * time.Millisecond)
+	health := opcae.NewStatusMonitor(epochServer{s}).Poll()
+	require.NoError(t, health.Err)
+	assert.Greater(t, health.Uptime, time.Duration(0))
+	assert.Equal(t, health.Uptime, health.Staleness)
+}
@@ -0,0 +1,552 @@
+package opcaetest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/huskar-t/opcae"
+)
+
+var _ opcae.EventSubscription = (*Subscription)(nil)
+
+// Subscription is an event subscription of a Server.
+// Events are delivered by a goroutine per subscription through an opcae.Dispatcher like the COM event sink.
+type Subscription struct {
+	server       *Server
+	clientHandle uint32
+	receiver     chan *opcae.EventSinkOnEventData
+	dispatcher   *opcae.Dispatcher
+	schema       *opcae.AttributeSchema
+	watchdog     atomic.Pointer[opcae.Watchdog]
+
+	lock         sync.Mutex
+	active       bool
+	bufferTime   uint32
+	maxSize      uint32
+	keepAlive    uint32
+	filter       filter
+	returned     map[uint32][]uint32
+	pending      []*opcae.OnEventStruct
+	refreshing   bool
+	refreshQueue []*opcae.EventSinkOnEventData
+	resetTimers  bool
+	released     bool
+	wake         chan struct{}
+	done         chan struct{}
+	releaseOnce  sync.Once
+}
+
+type filter struct {
+	eventTypes   []opcae.EventCategoryType
+	categories   []uint32
+	lowSeverity  uint32
+	highSeverity uint32
+	areas        []string
+	sources      []string
+}
+
+func (f *filter) match(event *opcae.OnEventStruct, src *source) bool {
+	if len(f.eventTypes) != 0 && opcae.MarshalEventCategoryType(f.eventTypes)&event.EventType == 0 {
+		return false
+	}
+	if len(f.categories) != 0 && !containsUint32(f.categories, event.Category) {
+		return false
+	}
+	if event.Severity < f.lowSeverity || event.Severity > f.highSeverity {
+		return false
+	}
+	if len(f.areas) != 0 {
+		matched := false
+		for _, pattern := range f.areas {
+			if src.area.matches(pattern) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(f.sources) != 0 {
+		matched := false
+		for _, pattern := range f.sources {
+			if matchWildcard(pattern, src.qualified) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func containsUint32(values []uint32, value uint32) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func newSubscription(server *Server, clientHandle uint32, active bool, bufferTime, maxSize, receiverBufSize uint32, opts []opcae.SubscriptionOption) *Subscription {
+	receiver := make(chan *opcae.EventSinkOnEventData, receiverBufSize)
+	schema := opcae.NewAttributeSchema(server.QueryEventAttributes)
+	opts = append([]opcae.SubscriptionOption{opcae.WithAttributeSchema(schema)}, opts...)
+	return &Subscription{
+		server:       server,
+		clientHandle: clientHandle,
+		receiver:     receiver,
+		dispatcher:   opcae.NewSubscriptionDispatcher(receiver, opts...),
+		schema:       schema,
+		active:       active,
+		bufferTime:   bufferTime,
+		maxSize:      maxSize,
+		filter:       filter{lowSeverity: 1, highSeverity: 1000},
+		returned:     make(map[uint32][]uint32),
+		wake:         make(chan struct{}, 1),
+		done:         make(chan struct{}),
+	}
+}
+
+// enqueue queues the event when the subscription is active and the event passes the filter. The server lock is held.
+func (sub *Subscription) enqueue(event *opcae.OnEventStruct, src *source, attributes map[uint32]interface{}) {
+	sub.lock.Lock()
+	defer sub.lock.Unlock()
+	if !sub.active || sub.released || !sub.filter.match(event, src) {
+		return
+	}
+	sub.pending = append(sub.pending, sub.withAttributes(event, attributes))
+	sub.notify()
+}
+
+// withAttributes returns a copy of the event with the values of the attributes selected for its category. sub.lock must be held.
+func (sub *Subscription) withAttributes(event *opcae.OnEventStruct, attributes map[uint32]interface{}) *opcae.OnEventStruct {
+	copied := *event
+	ids := sub.returned[event.Category]
+	copied.NumAttrs = uint32(len(ids))
+	copied.Attributes = make([]interface{}, len(ids))
+	for i, id := range ids {
+		copied.Attributes[i] = attributes[id]
+	}
+	return &copied
+}
+
+func (sub *Subscription) notify() {
+	select {
+	case sub.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run delivers refresh callbacks, buffered events and keep-alive callbacks until the subscription is released
+func (sub *Subscription) run() {
+	clock := sub.server.clock
+	var flush, keepAlive <-chan time.Time
+	flushing := false
+	for {
+		sub.lock.Lock()
+		if sub.resetTimers {
+			sub.resetTimers = false
+			flush, keepAlive = nil, nil
+		}
+		var data *opcae.EventSinkOnEventData
+		switch {
+		case len(sub.refreshQueue) != 0:
+			data = sub.refreshQueue[0]
+			sub.refreshQueue = sub.refreshQueue[1:]
+		case len(sub.pending) != 0 && (sub.bufferTime == 0 || flushing):
+			data = &opcae.EventSinkOnEventData{ClientHandle: sub.clientHandle, Events: sub.takePending()}
+		default:
+			flushing = false
+			if len(sub.pending) != 0 && flush == nil {
+				flush = clock.After(time.Duration(sub.bufferTime) * time.Millisecond)
+			}
+			if sub.keepAlive == 0 {
+				keepAlive = nil
+			} else if keepAlive == nil {
+				keepAlive = clock.After(time.Duration(sub.keepAlive) * time.Millisecond)
+			}
+		}
+		sub.lock.Unlock()
+		if data != nil {
+			if !sub.send(data) {
+				return
+			}
+			if data.LastRefresh {
+				sub.endRefresh()
+			}
+			keepAlive = nil
+			continue
+		}
+		select {
+		case <-sub.done:
+			return
+		case <-sub.wake:
+		case <-flush:
+			flush = nil
+			flushing = true
+		case <-keepAlive:
+			keepAlive = nil
+			if !sub.send(&opcae.EventSinkOnEventData{ClientHandle: sub.clientHandle, KeepAlive: true, Events: []*opcae.OnEventStruct{}}) {
+				return
+			}
+		}
+	}
+}
+
+// endRefresh ends the refresh after its last callback was sent, a new refresh cannot start before
+func (sub *Subscription) endRefresh() {
+	sub.lock.Lock()
+	sub.refreshing = false
+	sub.lock.Unlock()
+}
+
+// takePending removes up to max size events from the queue. sub.lock must be held.
+func (sub *Subscription) takePending() []*opcae.OnEventStruct {
+	n := len(sub.pending)
+	if sub.maxSize != 0 && uint32(n) > sub.maxSize {
+		n = int(sub.maxSize)
+	}
+	events := sub.pending[:n:n]
+	sub.pending = sub.pending[n:]
+	return events
+}
+
+func (sub *Subscription) send(data *opcae.EventSinkOnEventData) bool {
+	if w := sub.watchdog.Load(); w != nil {
+		w.Feed()
+	}
+	sub.dispatcher.Deliver(data)
+	select {
+	case <-sub.done:
+		return false
+	default:
+	}
+	sub.server.lock.Lock()
+	sub.server.lastUpdateTime = sub.server.clock.Now()
+	sub.server.lock.Unlock()
+	return true
+}
+
+func (sub *Subscription) GetClientHandle() uint32 {
+	return sub.clientHandle
+}
+
+func (sub *Subscription) ConnectionState() opcae.ConnectionState {
+	return sub.server.status.State()
+}
+
+// Closed returns a channel that is closed when the server shuts down or is disconnected
+func (sub *Subscription) Closed() <-chan struct{} {
+	return sub.server.status.Done()
+}
+
+// call checks the server for injected errors
+func (sub *Subscription) call(op string) error {
+	sub.server.lock.Lock()
+	defer sub.server.lock.Unlock()
+	return sub.server.call(op)
+}
+
+func (sub *Subscription) GetState() (active bool, bufferTime uint32, maxSize uint32, clientSubscription uint32, err error) {
+	if err = sub.call("GetState"); err != nil {
+		return
+	}
+	sub.lock.Lock()
+	defer sub.lock.Unlock()
+	return sub.active, sub.bufferTime, sub.maxSize, sub.clientHandle, nil
+}
+
+func (sub *Subscription) SetActive(active bool) error {
+	if err := sub.call("SetActive"); err != nil {
+		return err
+	}
+	sub.lock.Lock()
+	defer sub.lock.Unlock()
+	sub.active = active
+	if !active {
+		sub.pending = nil
+	}
+	return nil
+}
+
+func (sub *Subscription) SetBufferTime(bufferTime uint32) (uint32, error) {
+	sub.server.lock.Lock()
+	if err := sub.server.call("SetBufferTime"); err != nil {
+		sub.server.lock.Unlock()
+		return 0, err
+	}
+	bufferTime, revised := sub.server.reviseBufferTime("SetBufferTime", bufferTime)
+	sub.server.lock.Unlock()
+	sub.lock.Lock()
+	defer sub.lock.Unlock()
+	sub.bufferTime = bufferTime
+	sub.resetTimers = true
+	sub.notify()
+	return bufferTime, revised
+}
+
+func (sub *Subscription) SetMaxSize(maxSize uint32) (uint32, error) {
+	if err := sub.call("SetMaxSize"); err != nil {
+		return 0, err
+	}
+	sub.lock.Lock()
+	defer sub.lock.Unlock()
+	sub.maxSize = maxSize
+	return maxSize, nil
+}
+
+// SetFilter replaces the filter, areas and sources may contain the wildcards '*' and '?'
+func (sub *Subscription) SetFilter(events []opcae.EventCategoryType, eventCategories []uint32, lowSeverity uint32, highSeverity uint32, areaList []string, sourceList []string) error {
+	sub.server.lock.Lock()
+	defer sub.server.lock.Unlock()
+	if err := sub.server.call("SetFilter"); err != nil {
+		return err
+	}
+	if lowSeverity > highSeverity || highSeverity > 1000 {
+		return opcae.NewOPCError("SetFilter", "", opcae.E_INVALIDARG)
+	}
+	for _, id := range eventCategories {
+		if sub.server.category(id) == nil {
+			return opcae.NewOPCError("SetFilter", "", opcae.E_INVALIDARG)
+		}
+	}
+	sub.lock.Lock()
+	defer sub.lock.Unlock()
+	sub.filter = filter{
+		eventTypes:   append([]opcae.EventCategoryType(nil), events...),
+		categories:   append([]uint32(nil), eventCategories...),
+		lowSeverity:  lowSeverity,
+		highSeverity: highSeverity,
+		areas:        append([]string(nil), areaList...),
+		sources:      append([]string(nil), sourceList...),
+	}
+	return nil
+}
+
+func (sub *Subscription) GetFilter() (events []opcae.EventCategoryType, eventCategories []uint32, lowSeverity uint32, highSeverity uint32, areaList []string, sourceList []string, err error) {
+	if err = sub.call("GetFilter"); err != nil {
+		return
+	}
+	sub.lock.Lock()
+	defer sub.lock.Unlock()
+	f := sub.filter
+	return append([]opcae.EventCategoryType(nil), f.eventTypes...),
+		append([]uint32(nil), f.categories...),
+		f.lowSeverity,
+		f.highSeverity,
+		append([]string(nil), f.areas...),
+		append([]string(nil), f.sources...),
+		nil
+}
+
+// SelectReturnedAttributes selects the attributes the events of the category return and refreshes the
+// attribute schema of the subscription
+func (sub *Subscription) SelectReturnedAttributes(eventCategory uint32, attributeIDs []uint32) error {
+	// the schema queries the server, the server lock must not be held
+	returned, err := sub.schema.Lookup(eventCategory, attributeIDs)
+	if err != nil {
+		return err
+	}
+	if err := sub.selectReturnedAttributes(eventCategory, attributeIDs); err != nil {
+		return err
+	}
+	sub.schema.Set(eventCategory, returned)
+	return nil
+}
+
+// SelectReturnedAttributesByName selects the attributes the events of the category return by their descriptions
+func (sub *Subscription) SelectReturnedAttributesByName(eventCategory uint32, names []string) error {
+	attributeIDs, err := sub.schema.Resolve(eventCategory, names)
+	if err != nil {
+		return err
+	}
+	return sub.SelectReturnedAttributes(eventCategory, attributeIDs)
+}
+
+func (sub *Subscription) selectReturnedAttributes(eventCategory uint32, attributeIDs []uint32) error {
+	sub.server.lock.Lock()
+	defer sub.server.lock.Unlock()
+	if err := sub.server.call("SelectReturnedAttributes"); err != nil {
+		return err
+	}
+	c := sub.server.category(eventCategory)
+	if c == nil {
+		return opcae.NewOPCError("SelectReturnedAttributes", "", opcae.E_INVALIDARG)
+	}
+	for _, id := range attributeIDs {
+		if c.attribute(id) == nil {
+			return opcae.NewOPCError("SelectReturnedAttributes", "", opcae.E_INVALIDARG)
+		}
+	}
+	sub.lock.Lock()
+	defer sub.lock.Unlock()
+	sub.returned[eventCategory] = append([]uint32(nil), attributeIDs...)
+	return nil
+}
+
+func (sub *Subscription) GetReturnedAttributes(eventCategory uint32) ([]uint32, error) {
+	sub.server.lock.Lock()
+	defer sub.server.lock.Unlock()
+	if err := sub.server.call("GetReturnedAttributes"); err != nil {
+		return nil, err
+	}
+	if sub.server.category(eventCategory) == nil {
+		return nil, opcae.NewOPCError("GetReturnedAttributes", "", opcae.E_INVALIDARG)
+	}
+	sub.lock.Lock()
+	defer sub.lock.Unlock()
+	return append([]uint32(nil), sub.returned[eventCategory]...), nil
+}
+
+// Refresh sends all active and all unacknowledged inactive conditions that pass the filter.
+// The events are sent in callbacks of at most max size events with Refresh set, LastRefresh is set on the last one.
+// A refresh that is still running makes Refresh fail with OPC_E_BUSY.
+func (sub *Subscription) Refresh() error {
+	sub.server.lock.Lock()
+	defer sub.server.lock.Unlock()
+	if err := sub.server.call("Refresh"); err != nil {
+		return err
+	}
+	sub.lock.Lock()
+	defer sub.lock.Unlock()
+	if sub.refreshing {
+		return opcae.NewOPCError("Refresh", "", opcae.OPC_E_BUSY)
+	}
+	var events []*opcae.OnEventStruct
+	sub.server.root.walk(func(*area) {}, func(src *source) {
+		for _, c := range src.conditions {
+			if !c.Enabled || (!c.Active && c.Acked) {
+				continue
+			}
+			event := sub.server.conditionEvent(c, 0, "")
+			if sub.filter.match(event, src) {
+				events = append(events, sub.withAttributes(event, c.attributes))
+			}
+		}
+	})
+	size := len(events)
+	if sub.maxSize != 0 {
+		size = int(sub.maxSize)
+	}
+	for {
+		n := len(events)
+		if n > size {
+			n = size
+		}
+		data := &opcae.EventSinkOnEventData{
+			ClientHandle: sub.clientHandle,
+			Refresh:      true,
+			Events:       events[:n:n],
+		}
+		events = events[n:]
+		data.LastRefresh = len(events) == 0
+		sub.refreshQueue = append(sub.refreshQueue, data)
+		if data.LastRefresh {
+			break
+		}
+	}
+	sub.refreshing = true
+	sub.notify()
+	return nil
+}
+
+// CancelRefresh replaces the refresh callbacks that were not sent yet by a final callback without events that has
+// LastRefresh set, it fails with E_FAIL when no refresh is running
+func (sub *Subscription) CancelRefresh() error {
+	if err := sub.call("CancelRefresh"); err != nil {
+		return err
+	}
+	sub.lock.Lock()
+	defer sub.lock.Unlock()
+	if !sub.refreshing {
+		return opcae.NewOPCError("CancelRefresh", "", opcae.E_FAIL)
+	}
+	sub.refreshQueue = []*opcae.EventSinkOnEventData{{
+		ClientHandle: sub.clientHandle,
+		Refresh:      true,
+		LastRefresh:  true,
+	}}
+	sub.notify()
+	return nil
+}
+
+// RefreshAndWait refreshes the subscription and returns the events of the refresh callbacks, live events
+// still go to the receiver. When ctx is done the refresh is cancelled and ctx.Err() is returned.
+func (sub *Subscription) RefreshAndWait(ctx context.Context) ([]*opcae.OnEventStruct, error) {
+	return sub.dispatcher.RefreshAndWait(ctx, sub.Refresh, sub.CancelRefresh)
+}
+
+func (sub *Subscription) SetKeepAlive(keepAliveTime uint32) (uint32, error) {
+	if err := sub.call("SetKeepAlive"); err != nil {
+		return 0, err
+	}
+	sub.lock.Lock()
+	defer sub.lock.Unlock()
+	sub.keepAlive = keepAliveTime
+	sub.resetTimers = true
+	sub.notify()
+	return keepAliveTime, nil
+}
+
+func (sub *Subscription) GetKeepAlive() (uint32, error) {
+	if err := sub.call("GetKeepAlive"); err != nil {
+		return 0, err
+	}
+	sub.lock.Lock()
+	defer sub.lock.Unlock()
+	return sub.keepAlive, nil
+}
+
+func (sub *Subscription) StartWatchdog(multiple uint32, notify chan<- *opcae.SubscriptionStall) error {
+	keepAlive, err := sub.GetKeepAlive()
+	if err != nil {
+		return err
+	}
+	if keepAlive == 0 {
+		return errors.New("opcaetest: keep-alive is not enabled on the subscription")
+	}
+	watchdog := opcae.NewWatchdog(sub.server.clock, sub.clientHandle, time.Duration(keepAlive)*time.Millisecond, multiple, notify)
+	if old := sub.watchdog.Swap(watchdog); old != nil {
+		old.Stop()
+	}
+	watchdog.Start()
+	return nil
+}
+
+func (sub *Subscription) StopWatchdog() {
+	if old := sub.watchdog.Swap(nil); old != nil {
+		old.Stop()
+	}
+}
+
+// GetReceiver returns the channel of the event notifications, it is closed by Release
+func (sub *Subscription) GetReceiver() <-chan *opcae.EventSinkOnEventData {
+	return sub.receiver
+}
+
+func (sub *Subscription) DeliveryStats() opcae.DeliveryStats {
+	return sub.dispatcher.Stats()
+}
+
+// Release stops the delivery, events that were not sent yet are dropped
+func (sub *Subscription) Release() error {
+	sub.releaseOnce.Do(func() {
+		sub.StopWatchdog()
+		sub.lock.Lock()
+		sub.released = true
+		sub.pending = nil
+		sub.refreshQueue = nil
+		sub.lock.Unlock()
+		close(sub.done)
+		sub.dispatcher.Close()
+		sub.server.removeSubscription(sub)
+	})
+	return nil
+}
@@ -0,0 +1,435 @@
+package opcaetest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/huskar-t/opcae"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscription_Filter(t *testing.T) {
+	s := newTestServer(t)
+	sub, _, _, err := s.CreateEventSubscription(true, 0, 0, 10)
+	require.NoError(t, err)
+	assert.Error(t, sub.SetFilter(nil, nil, 700, 600, nil, nil))
+	assert.Error(t, sub.SetFilter(nil, []uint32{42}, 1, 1000, nil, nil))
+	require.NoError(t, sub.SetFilter([]opcae.EventCategoryType{opcae.OPC_CONDITION_EVENT}, nil, 700, 1000, []string{"Plant.Area1"}, nil))
+
+	require.NoError(t, s.Activate("Plant.Area1.Tank1", "LEVEL", "HI", ""))
+	require.NoError(t, s.Activate("Plant.Area2.Pump1", "COMM", "", ""))
+	require.NoError(t, s.FireEvent("Plant.Area1.Tank1", systemCategory, 900, "", ""))
+	require.NoError(t, s.Activate("Plant.Area1.Tank1", "LEVEL", "HIHI", ""))
+	event := receive(t, sub).Events[0]
+	assert.Equal(t, "HIHI", event.Subcond)
+	assertNoCallback(t, sub)
+
+	events, categories, low, high, areas, sources, err := sub.GetFilter()
+	assert.NoError(t, err)
+	assert.Equal(t, []opcae.EventCategoryType{opcae.OPC_CONDITION_EVENT}, events)
+	assert.Empty(t, categories)
+	assert.Equal(t, uint32(700), low)
+	assert.Equal(t, uint32(1000), high)
+	assert.Equal(t, []string{"Plant.Area1"}, areas)
+	assert.Empty(t, sources)
+
+	require.NoError(t, sub.SetFilter(nil, nil, 1, 1000, nil, []string{"*.Pump?"}))
+	require.NoError(t, s.Deactivate("Plant.Area1.Tank1", "LEVEL", ""))
+	require.NoError(t, s.Deactivate("Plant.Area2.Pump1", "COMM", ""))
+	event = receive(t, sub).Events[0]
+	assert.Equal(t, "Plant.Area2.Pump1", event.Source)
+}
+
+func TestSubscription_InactiveDropsEvents(t *testing.T) {
+	s := newTestServer(t)
+	sub, _, _, err := s.CreateEventSubscription(false, 0, 0, 10)
+	require.NoError(t, err)
+	require.NoError(t, s.Activate("Plant.Area1.Tank1", "LEVEL", "", ""))
+	assertNoCallback(t, sub)
+	require.NoError(t, sub.SetActive(true))
+	active, _, _, handle, err := sub.GetState()
+	assert.NoError(t, err)
+	assert.True(t, active)
+	assert.Equal(t, sub.GetClientHandle(), handle)
+	require.NoError(t, s.Deactivate("Plant.Area1.Tank1", "LEVEL", ""))
+	receive(t, sub)
+}
+
+func TestSubscription_BufferTimeAndMaxSize(t *testing.T) {
+	s := newTestServer(t)
+	sub, bufferTime, maxSize, err := s.CreateEventSubscription(true, 50, 2, 10)
+	require.NoError(t, err)
+	assert.Equal(t, uint32(50), bufferTime)
+	assert.Equal(t, uint32(2), maxSize)
+	require.NoError(t, s.Activate("Plant.Area1.Tank1", "LEVEL", "", ""))
+	require.NoError(t, s.Activate("Plant.Area1.Tank1", "COMM", "", ""))
+	require.NoError(t, s.Activate("Plant.Area2.Pump1", "COMM", "", ""))
+	assert.Len(t, receive(t, sub).Events, 2)
+	assert.Len(t, receive(t, sub).Events, 1)
+}
+
+func TestSubscription_RevisedBufferTime(t *testing.T) {
+	s := newTestServer(t)
+	s.SetMinBufferTime(100)
+	sub, bufferTime, _, err := s.CreateEventSubscription(true, 50, 0, 10)
+	assert.ErrorIs(t, err, opcae.ErrInvalidBufferTime)
+	assert.True(t, opcae.Succeeded(err))
+	require.NotNil(t, sub)
+	assert.Equal(t, uint32(100), bufferTime)
+	bufferTime, err = sub.SetBufferTime(20)
+	assert.ErrorIs(t, err, opcae.ErrInvalidBufferTime)
+	assert.Equal(t, uint32(100), bufferTime)
+	bufferTime, err = sub.SetBufferTime(200)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(200), bufferTime)
+}
+
+func TestSubscription_DeliveryPolicy(t *testing.T) {
+	s := newTestServer(t)
+	sub, _, _, err := s.CreateEventSubscription(true, 0, 0, 1, opcae.WithDeliveryPolicy(opcae.DeliverDropNewest))
+	require.NoError(t, err)
+	require.NoError(t, s.Activate("Plant.Area1.Tank1", "LEVEL", "", ""))
+	assert.Eventually(t, func() bool { return sub.DeliveryStats().Delivered == 1 }, time.Second, time.Millisecond)
+	require.NoError(t, s.Activate("Plant.Area2.Pump1", "COMM", "", ""))
+	assert.Eventually(t, func() bool { return sub.DeliveryStats().Dropped == 1 }, time.Second, time.Millisecond)
+	assert.Equal(t, opcae.DeliveryStats{Delivered: 1, Dropped: 1}, sub.DeliveryStats())
+	assert.Equal(t, "Plant.Area1.Tank1", receive(t, sub).Events[0].Source)
+	assertNoCallback(t, sub)
+}
+
+func TestSubscription_Refresh(t *testing.T) {
+	s := newTestServer(t)
+	require.NoError(t, s.Activate("Plant.Area1.Tank1", "LEVEL", "", ""))
+	require.NoError(t, s.Activate("Plant.Area2.Pump1", "COMM", "", ""))
+	sub, _, _, err := s.CreateEventSubscription(true, 0, 1, 0)
+	require.NoError(t, err)
+
+	require.NoError(t, sub.Refresh())
+	first := receive(t, sub)
+	assert.True(t, first.Refresh)
+	assert.False(t, first.LastRefresh)
+	assert.Len(t, first.Events, 1)
+	assert.Empty(t, first.Events[0].ChangeMask)
+	err = sub.Refresh()
+	assert.True(t, errors.Is(err, opcae.ErrBusy))
+	last := receive(t, sub)
+	assert.True(t, last.LastRefresh)
+
+	assert.Eventually(t, func() bool { return sub.CancelRefresh() != nil }, time.Second, time.Millisecond)
+	require.NoError(t, s.Deactivate("Plant.Area2.Pump1", "COMM", ""))
+	receive(t, sub)
+	require.NoError(t, sub.Refresh())
+	assert.NoError(t, sub.CancelRefresh())
+	for data := receive(t, sub); !data.LastRefresh; data = receive(t, sub) {
+		assert.True(t, data.Refresh)
+	}
+	assert.Eventually(t, func() bool { return sub.Refresh() == nil }, time.Second, time.Millisecond)
+}
+
+func TestSubscription_KeepAlive(t *testing.T) {
+	s := newTestServer(t)
+	sub, _, _, err := s.CreateEventSubscription(true, 0, 0, 10)
+	require.NoError(t, err)
+	revised, err := sub.SetKeepAlive(20)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(20), revised)
+	data := receive(t, sub)
+	assert.True(t, data.KeepAlive)
+	assert.Empty(t, data.Events)
+	assert.NoError(t, sub.StartWatchdog(3, nil))
+	sub.StopWatchdog()
+}
+
+func TestSubscription_Release(t *testing.T) {
+	s := newTestServer(t)
+	sub, _, _, err := s.CreateEventSubscription(true, 0, 0, 10)
+	require.NoError(t, err)
+	assert.NoError(t, sub.Release())
+	assert.NoError(t, sub.Release())
+	require.NoError(t, s.Activate("Plant.Area1.Tank1", "LEVEL", "", ""))
+	_, ok := <-sub.GetReceiver()
+	assert.False(t, ok, "the receiver is closed on release")
+}
+
+type recordingHandler struct {
+	calls chan string
+}
+
+func (h *recordingHandler) OnEvent(data *opcae.EventSinkOnEventData) {
+	for _, event := range data.Events {
+		h.calls <- "event " + event.Source
+	}
+}
+
+func (h *recordingHandler) OnRefreshStart() {
+	h.calls <- "refresh start"
+}
+
+func (h *recordingHandler) OnRefreshDone() {
+	h.calls <- "refresh done"
+}
+
+func (h *recordingHandler) OnError(err error) {
+	h.calls <- err.Error()
+}
+
+func (h *recordingHandler) next(t *testing.T) string {
+	t.Helper()
+	select {
+	case call := <-h.calls:
+		return call
+	case <-time.After(2 * time.Second):
+		t.Fatal("handler not called")
+		return ""
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	s := newTestServer(t)
+	require.NoError(t, s.Activate("Plant.Area1.Tank1", "LEVEL", "", ""))
+	sub, _, _, err := s.CreateEventSubscription(true, 0, 1, 10)
+	require.NoError(t, err)
+	handler := &recordingHandler{calls: make(chan string, 10)}
+	done := opcae.Subscribe(context.Background(), sub, handler)
+
+	require.NoError(t, sub.Refresh())
+	assert.Equal(t, "refresh start", handler.next(t))
+	assert.Equal(t, "event Plant.Area1.Tank1", handler.next(t))
+	assert.Equal(t, "refresh done", handler.next(t))
+	require.NoError(t, s.Activate("Plant.Area2.Pump1", "COMM", "", ""))
+	assert.Equal(t, "event Plant.Area2.Pump1", handler.next(t))
+
+	_, err = sub.SetKeepAlive(10)
+	require.NoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	s.Shutdown("maintenance")
+	assert.Equal(t, opcae.ErrServerShutdown.Error(), handler.next(t), "keep-alive callbacks are not passed on")
+
+	require.NoError(t, sub.Release())
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("handler goroutine did not stop on release")
+	}
+}
+
+func TestSubscribe_Cancel(t *testing.T) {
+	s := newTestServer(t)
+	sub, _, _, err := s.CreateEventSubscription(true, 0, 0, 10)
+	require.NoError(t, err)
+	defer sub.Release()
+	ctx, cancel := context.WithCancel(context.Background())
+	var events int
+	done := opcae.Subscribe(ctx, sub, opcae.HandlerFuncs{
+		Event: func(data *opcae.EventSinkOnEventData) { events += len(data.Events) },
+	})
+	cancel()
+	<-done
+	require.NoError(t, s.Activate("Plant.Area1.Tank1", "LEVEL", "", ""))
+	assert.Len(t, receive(t, sub).Events, 1, "the handler no longer consumes the receiver")
+	assert.Zero(t, events)
+}
+
+func TestSubscription_RefreshAndWait(t *testing.T) {
+	s := newTestServer(t)
+	require.NoError(t, s.Activate("Plant.Area1.Tank1", "LEVEL", "", ""))
+	require.NoError(t, s.Activate("Plant.Area2.Pump1", "COMM", "", ""))
+	sub, _, _, err := s.CreateEventSubscription(true, 0, 1, 10)
+	require.NoError(t, err)
+
+	events, err := sub.RefreshAndWait(context.Background())
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.ElementsMatch(t, []string{"Plant.Area1.Tank1", "Plant.Area2.Pump1"}, []string{events[0].Source, events[1].Source})
+	assertNoCallback(t, sub)
+
+	s.FailNext("Refresh", opcae.OPC_E_BUSY)
+	_, err = sub.RefreshAndWait(context.Background())
+	assert.True(t, errors.Is(err, opcae.ErrBusy))
+
+	require.NoError(t, s.Deactivate("Plant.Area1.Tank1", "LEVEL", ""))
+	assert.Equal(t, "Plant.Area1.Tank1", receive(t, sub).Events[0].Source)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = sub.RefreshAndWait(ctx)
+	assert.Equal(t, context.Canceled, err)
+	assert.Eventually(t, func() bool {
+		_, err := sub.RefreshAndWait(context.Background())
+		return err == nil
+	}, time.Second, time.Millisecond)
+	assertNoCallback(t, sub)
+}
+
+func TestConditionCache(t *testing.T) {
+	s := newTestServer(t)
+	require.NoError(t, s.Activate("Plant.Area1.Tank1", "LEVEL", "", ""))
+	sub, _, _, err := s.CreateEventSubscription(true, 0, 0, 10)
+	require.NoError(t, err)
+	defer sub.Release()
+	cache := opcae.NewConditionCache()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := opcae.Subscribe(ctx, sub, cache)
+	require.NoError(t, cache.Sync(ctx, sub))
+	assert.Equal(t, 1, cache.Len())
+
+	require.NoError(t, s.Activate("Plant.Area2.Pump1", "COMM", "", ""))
+	assert.Eventually(t, func() bool { return cache.Len() == 2 }, time.Second, time.Millisecond)
+	unacked := cache.Query(opcae.ConditionQuery{AreaPrefix: "Plant.Area2.", UnackedOnly: true})
+	require.Len(t, unacked, 1)
+
+	require.NoError(t, s.Deactivate("Plant.Area2.Pump1", "COMM", ""))
+	results, err := s.AckConditions("operator", "", []*opcae.AckRequest{unacked[0].AckRequest()})
+	require.NoError(t, err)
+	assert.NoError(t, results[0].Err)
+	assert.Eventually(t, func() bool { return cache.Len() == 1 }, time.Second, time.Millisecond)
+	_, ok := cache.Get("Plant.Area1.Tank1", "LEVEL")
+	assert.True(t, ok)
+	cancel()
+	<-done
+}
+
+func TestSubscription_EventFilter(t *testing.T) {
+	s := newTestServer(t)
+	filter, err := opcae.CompileEventFilter(`source =~ "*.Pump?" && !acked`, nil)
+	require.NoError(t, err)
+	sub, _, _, err := s.CreateEventSubscription(true, 0, 0, 10, opcae.WithEventFilter(filter))
+	require.NoError(t, err)
+	require.NoError(t, s.Activate("Plant.Area1.Tank1", "LEVEL", "", ""))
+	require.NoError(t, s.Activate("Plant.Area2.Pump1", "COMM", "", ""))
+	events := receiveEvents(t, sub, 1)
+	assert.Equal(t, "Plant.Area2.Pump1", events[0].Source)
+	assertNoCallback(t, sub)
+	assert.Equal(t, uint64(1), sub.DeliveryStats().Filtered)
+}
+
+func TestSubscription_Deduplication(t *testing.T) {
+	s := newTestServer(t)
+	dedup := opcae.NewDeduplicator(100)
+	first, _, _, err := s.CreateEventSubscription(true, 0, 0, 10, opcae.WithDeduplicator(dedup))
+	require.NoError(t, err)
+	require.NoError(t, s.Activate("Plant.Area1.Tank1", "LEVEL", "", ""))
+	assert.Len(t, receiveEvents(t, first, 1), 1)
+	require.NoError(t, first.Release())
+
+	// the subscription created after a reconnect shares the deduplicator
+	second, _, _, err := s.CreateEventSubscription(true, 0, 0, 10, opcae.WithDeduplicator(dedup))
+	require.NoError(t, err)
+	require.NoError(t, s.Activate("Plant.Area2.Pump1", "COMM", "", ""))
+	assert.Len(t, receiveEvents(t, second, 1), 1)
+	require.NoError(t, second.Refresh())
+	data := receive(t, second)
+	assert.True(t, data.LastRefresh)
+	assert.Empty(t, data.Events)
+	assert.Equal(t, uint64(2), second.DeliveryStats().Duplicates)
+}
+
+func TestSubscription_SelectReturnedAttributesByName(t *testing.T) {
+	s := newTestServer(t)
+	filter, err := opcae.CompileEventFilter(`attr["CV"] > 90`, nil)
+	require.NoError(t, err)
+	sub, _, _, err := s.CreateEventSubscription(true, 0, 0, 10, opcae.WithEventFilter(filter))
+	require.NoError(t, err)
+	err = sub.SelectReturnedAttributesByName(levelCategory, []string{"Unknown"})
+	assert.True(t, errors.Is(err, &opcae.OPCError{Code: opcae.E_INVALIDARG}))
+
+	require.NoError(t, sub.SelectReturnedAttributesByName(levelCategory, []string{"Limit", "CV"}))
+	require.NoError(t, s.SetAttributeValue("Plant.Area1.Tank1", "LEVEL", valueAttribute, 97.0))
+	// the attribute is declared as VT_R8, the integer is converted
+	require.NoError(t, s.SetAttributeValue("Plant.Area1.Tank1", "LEVEL", limitAttribute, 95))
+	require.NoError(t, s.SetAttributeValue("Plant.Area2.Pump1", "COMM", valueAttribute, 50.0))
+	require.NoError(t, s.Activate("Plant.Area2.Pump1", "COMM", "", ""))
+	require.NoError(t, s.Activate("Plant.Area1.Tank1", "LEVEL", "HIHI", ""))
+	event := receiveEvents(t, sub, 1)[0]
+	assert.Equal(t, "Plant.Area1.Tank1", event.Source)
+	assert.Equal(t, []uint32{limitAttribute, valueAttribute}, event.AttributeIDs)
+	assert.Equal(t, map[string]interface{}{"CV": 97.0, "Limit": 95.0}, event.NamedAttributes)
+	value, ok := event.AttributeByID(limitAttribute)
+	assert.True(t, ok)
+	assert.Equal(t, 95.0, value)
+	assertNoCallback(t, sub)
+
+	// selecting again replaces the schema of the category
+	require.NoError(t, sub.SelectReturnedAttributes(levelCategory, []uint32{valueAttribute}))
+	require.NoError(t, s.Activate("Plant.Area1.Tank1", "LEVEL", "HI", ""))
+	event = receiveEvents(t, sub, 1)[0]
+	assert.Equal(t, map[string]interface{}{"CV": 97.0}, event.NamedAttributes)
+	_, ok = event.Attribute("Limit")
+	assert.False(t, ok)
+
+	// the attributes are looked up first, a failed lookup leaves the selection and the schema unchanged
+	s.FailNext("QueryEventAttributes", opcae.E_FAIL)
+	assert.Error(t, sub.SelectReturnedAttributes(levelCategory, []uint32{limitAttribute, valueAttribute}))
+	returned, err := sub.GetReturnedAttributes(levelCategory)
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{valueAttribute}, returned)
+	require.NoError(t, s.Deactivate("Plant.Area1.Tank1", "LEVEL", ""))
+	event = receiveEvents(t, sub, 1)[0]
+	assert.Equal(t, map[string]interface{}{"CV": 97.0}, event.NamedAttributes)
+}
+
+func TestSubscriptionFilter(t *testing.T) {
+	s := newTestServer(t)
+	sub, _, _, err := s.CreateEventSubscription(true, 0, 0, 10)
+	require.NoError(t, err)
+	f := opcae.NewSubscriptionFilter().WithEventTypes(opcae.OPC_CONDITION_EVENT).WithCategories(levelCategory).WithAreas("Plant.Area2")
+	require.NoError(t, f.ValidateFor(s))
+	assert.Error(t, opcae.NewSubscriptionFilter().WithEventTypes(opcae.OPC_SIMPLE_EVENT).WithCategories(levelCategory).ValidateFor(s))
+	require.NoError(t, f.Apply(sub))
+	current, err := opcae.GetSubscriptionFilter(sub)
+	require.NoError(t, err)
+	assert.True(t, f.Equal(current), "%v", f.Diff(current))
+
+	require.NoError(t, s.Activate("Plant.Area1.Tank1", "LEVEL", "", ""))
+	require.NoError(t, s.Activate("Plant.Area2.Pump1", "COMM", "", ""))
+	assert.Equal(t, "Plant.Area2.Pump1", receive(t, sub).Events[0].Source)
+	assertNoCallback(t, sub)
+
+	s.SetAvailableFilters(opcae.OPC_FILTER_BY_EVENT)
+	err = f.ValidateFor(s)
+	var invalid *opcae.InvalidFilterError
+	assert.True(t, errors.As(err, &invalid))
+	assert.Equal(t, "categories", invalid.Field)
+}
+
+func TestSubscriptionSpec(t *testing.T) {
+	s := newTestServer(t)
+	sub, _, _, err := s.CreateEventSubscription(true, 100, 5, 10)
+	require.NoError(t, err)
+	_, err = sub.SetKeepAlive(60000)
+	require.NoError(t, err)
+	require.NoError(t, opcae.NewSubscriptionFilter().WithAreas("Plant.Area1").Apply(sub))
+	require.NoError(t, sub.SelectReturnedAttributes(levelCategory, []uint32{limitAttribute, valueAttribute}))
+	spec, err := opcae.GetSubscriptionSpec(s, sub)
+	require.NoError(t, err)
+	assert.Equal(t, map[uint32][]uint32{levelCategory: {limitAttribute, valueAttribute}}, spec.ReturnedAttributes)
+
+	data, err := json.Marshal(spec)
+	require.NoError(t, err)
+	var restored opcae.SubscriptionSpec
+	require.NoError(t, json.Unmarshal(data, &restored))
+
+	other := newTestServer(t)
+	other.SetMinBufferTime(500)
+	created, revisions, err := restored.Create(other, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []opcae.SpecRevision{{Field: "bufferTime", Requested: 100, Revised: 500}}, revisions)
+	captured, err := opcae.GetSubscriptionSpec(other, created)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bufferTime: 100 -> 500"}, spec.Diff(captured))
+
+	require.NoError(t, other.SetAttributeValue("Plant.Area1.Tank1", "LEVEL", valueAttribute, 85.0))
+	require.NoError(t, other.Activate("Plant.Area2.Pump1", "COMM", "", ""))
+	require.NoError(t, other.Activate("Plant.Area1.Tank1", "LEVEL", "HI", ""))
+	event := receiveEvents(t, created, 1)[0]
+	assert.Equal(t, "Plant.Area1.Tank1", event.Source)
+	assert.Equal(t, []interface{}{nil, 85.0}, event.Attributes)
+
+	other.FailNext("SelectReturnedAttributes", opcae.E_FAIL)
+	_, _, err = restored.Create(other, 10)
+	assert.Error(t, err)
+}
@@ -0,0 +1,205 @@
+package opcaetest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/huskar-t/opcae"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// waitState reads the events until one with state arrives
+func waitState(t *testing.T, events <-chan opcae.SupervisorEvent, state opcae.SupervisorState) opcae.SupervisorEvent {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case event := <-events:
+			if event.State == state {
+				return event
+			}
+		case <-timeout:
+			t.Fatalf("supervisor did not become %s", state)
+			return opcae.SupervisorEvent{}
+		}
+	}
+}
+
+// receiveRefresh receives the callbacks of a refresh until the last one
+func receiveRefresh(t *testing.T, receiver <-chan *opcae.EventSinkOnEventData) []*opcae.OnEventStruct {
+	t.Helper()
+	var events []*opcae.OnEventStruct
+	for {
+		select {
+		case data := <-receiver:
+			require.True(t, data.Refresh)
+			events = append(events, data.Events...)
+			if data.LastRefresh {
+				return events
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("no refresh received")
+			return nil
+		}
+	}
+}
+
+func TestSupervisor(t *testing.T) {
+	first, second, third, fourth := newTestServer(t), newTestServer(t), newTestServer(t), newTestServer(t)
+	var lock sync.Mutex
+	dials := []*Server{first, nil, second, third, fourth}
+	dial := func(ctx context.Context) (opcae.EventServer, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		if len(dials) == 0 {
+			return nil, errors.New("no server left")
+		}
+		server := dials[0]
+		dials = dials[1:]
+		if server == nil {
+			return nil, opcae.NewOPCError("ConnectEventServer", "", opcae.RPC_S_SERVER_UNAVAILABLE)
+		}
+		return server, nil
+	}
+	events := make(chan opcae.SupervisorEvent, 100)
+	sv := opcae.NewSupervisor(dial,
+		opcae.WithBackoff(opcae.Backoff{Initial: 10 * time.Millisecond, Max: 50 * time.Millisecond, Multiplier: 2}),
+		opcae.WithStatusInterval(10*time.Millisecond),
+		opcae.WithSupervisorNotify(events),
+	)
+	defer sv.Close()
+	waitState(t, events, opcae.SupervisorConnected)
+	assert.Same(t, first, sv.Server())
+
+	spec := &opcae.SubscriptionSpec{
+		Active:             true,
+		Filter:             opcae.NewSubscriptionFilter().WithAreas("Plant.Area1"),
+		ReturnedAttributes: map[uint32][]uint32{levelCategory: {valueAttribute}},
+	}
+	ss, err := sv.Subscribe(spec, 10)
+	require.NoError(t, err)
+	require.NoError(t, first.SetAttributeValue("Plant.Area1.Tank1", "LEVEL", valueAttribute, 85.0))
+	require.NoError(t, first.Activate("Plant.Area2.Pump1", "COMM", "", ""))
+	require.NoError(t, first.Activate("Plant.Area1.Tank1", "LEVEL", "HI", ""))
+	select {
+	case data := <-ss.GetReceiver():
+		assert.Equal(t, "Plant.Area1.Tank1", data.Events[0].Source)
+		assert.Equal(t, []interface{}{85.0}, data.Events[0].Attributes)
+	case <-time.After(2 * time.Second):
+		t.Fatal("no callback received")
+	}
+
+	// the server process dies after the connection became stable, the first attempt to connect again fails
+	require.Eventually(t, func() bool { return first.Calls("GetStatus") > 0 }, 2*time.Second, time.Millisecond)
+	require.NoError(t, second.SetAttributeValue("Plant.Area1.Tank1", "LEVEL", valueAttribute, 97.0))
+	require.NoError(t, second.Activate("Plant.Area1.Tank1", "LEVEL", "HIHI", ""))
+	first.Crash()
+	event := waitState(t, events, opcae.SupervisorDisconnected)
+	assert.True(t, opcae.ConnectionLost(event.Err), "%v", event.Err)
+	assert.Equal(t, 0, event.Attempt)
+	event = waitState(t, events, opcae.SupervisorDisconnected)
+	assert.Equal(t, 1, event.Attempt)
+	assert.Equal(t, 10*time.Millisecond, event.Delay)
+	waitState(t, events, opcae.SupervisorConnected)
+	refreshed := receiveRefresh(t, ss.GetReceiver())
+	require.Len(t, refreshed, 1)
+	assert.Equal(t, "HIHI", refreshed[0].Subcond)
+	assert.Equal(t, []interface{}{97.0}, refreshed[0].Attributes)
+	captured, err := opcae.GetSubscriptionSpec(second, ss.Subscription())
+	require.NoError(t, err)
+	assert.Empty(t, spec.Diff(captured), "the subscription is created again with the spec")
+
+	// a shutdown request
+	second.Shutdown("maintenance")
+	event = waitState(t, events, opcae.SupervisorDisconnected)
+	assert.True(t, errors.Is(event.Err, opcae.ErrServerShutdown))
+	waitState(t, events, opcae.SupervisorConnected)
+	assert.Empty(t, receiveRefresh(t, ss.GetReceiver()))
+
+	// calls made through Do report a lost connection
+	third.FailNext("QueryAvailableFilters", opcae.RPC_E_DISCONNECTED)
+	err = sv.Do(func(server opcae.EventServer) error {
+		_, err := server.QueryAvailableFilters()
+		return err
+	})
+	assert.True(t, opcae.ConnectionLost(err))
+	event = waitState(t, events, opcae.SupervisorDisconnected)
+	assert.Equal(t, err, event.Err)
+	waitState(t, events, opcae.SupervisorConnected)
+	assert.Same(t, fourth, sv.Server())
+	assert.Empty(t, receiveRefresh(t, ss.GetReceiver()))
+
+	require.NoError(t, ss.Unsubscribe())
+	_, ok := <-ss.GetReceiver()
+	assert.False(t, ok, "the receiver is closed by Unsubscribe")
+	require.NoError(t, sv.Close())
+	waitState(t, events, opcae.SupervisorClosed)
+	assert.Equal(t, opcae.SupervisorClosed, sv.State())
+	assert.Nil(t, sv.Server())
+	assert.Equal(t, opcae.ErrNotConnected, sv.Do(func(opcae.EventServer) error { return nil }))
+	_, err = sv.Subscribe(spec, 10)
+	assert.Equal(t, opcae.ErrSupervisorClosed, err)
+}
+
+func TestSupervisor_SubscribeWhileDisconnected(t *testing.T) {
+	server := newTestServer(t)
+	ready := make(chan struct{})
+	dial := func(ctx context.Context) (opcae.EventServer, error) {
+		select {
+		case <-ready:
+			return server, nil
+		default:
+			return nil, opcae.NewOPCError("ConnectEventServer", "", opcae.RPC_S_SERVER_UNAVAILABLE)
+		}
+	}
+	events := make(chan opcae.SupervisorEvent, 100)
+	sv := opcae.NewSupervisor(dial,
+		opcae.WithBackoff(opcae.Backoff{Initial: 5 * time.Millisecond, Max: 5 * time.Millisecond}),
+		opcae.WithSupervisorNotify(events),
+	)
+	defer sv.Close()
+	waitState(t, events, opcae.SupervisorDisconnected)
+	ss, err := sv.Subscribe(&opcae.SubscriptionSpec{Active: true}, 10)
+	require.NoError(t, err)
+	assert.Nil(t, ss.Subscription())
+
+	require.NoError(t, server.Activate("Plant.Area1.Tank1", "LEVEL", "HI", ""))
+	close(ready)
+	waitState(t, events, opcae.SupervisorConnected)
+	assert.Len(t, receiveRefresh(t, ss.GetReceiver()), 1)
+
+	revisions, err := ss.Apply(&opcae.SubscriptionSpec{Active: true, Filter: opcae.NewSubscriptionFilter().WithSeverity(700, 1000)})
+	require.NoError(t, err)
+	assert.Empty(t, revisions)
+	_, _, low, _, _, _, err := ss.Subscription().GetFilter()
+	require.NoError(t, err)
+	assert.Equal(t, uint32(700), low)
+	assert.Equal(t, uint32(700), ss.Spec().Filter.LowSeverity)
+}
+
+func TestSupervisor_FlappingServer(t *testing.T) {
+	// every server accepts the connection and fails the first status check
+	dial := func(ctx context.Context) (opcae.EventServer, error) {
+		server := NewServer()
+		server.Crash()
+		return server, nil
+	}
+	events := make(chan opcae.SupervisorEvent, 100)
+	sv := opcae.NewSupervisor(dial,
+		opcae.WithBackoff(opcae.Backoff{Initial: 10 * time.Millisecond, Max: 40 * time.Millisecond, Multiplier: 2}),
+		opcae.WithStatusInterval(5*time.Millisecond),
+		opcae.WithSupervisorNotify(events),
+	)
+	defer sv.Close()
+	for i, delay := range []time.Duration{10, 20, 40, 40} {
+		waitState(t, events, opcae.SupervisorConnected)
+		event := waitState(t, events, opcae.SupervisorDisconnected)
+		assert.True(t, opcae.ConnectionLost(event.Err), "%v", event.Err)
+		assert.Equal(t, i+1, event.Attempt, "a connection that fails at once counts as a failed attempt")
+		assert.Equal(t, delay*time.Millisecond, event.Delay)
+	}
+}
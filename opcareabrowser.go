@@ -1,13 +1,23 @@
+//go:build windows
+
 package opcae
 
 import (
+	"context"
+	"time"
+
 	"github.com/huskar-t/opcae/aecom"
 
 	"github.com/huskar-t/opcda/com"
 )
 
+var _ AreaBrowser = (*OPCAreaBrowser)(nil)
+
 type OPCAreaBrowser struct {
 	browser *aecom.IOPCEventAreaBrowser
+	common  *com.IOPCCommon
+	timeout time.Duration
+	calls   inFlight
 }
 
 func NewOPCAreaBrowser(unknown *com.IUnknown) *OPCAreaBrowser {
@@ -17,30 +27,87 @@ func NewOPCAreaBrowser(unknown *com.IUnknown) *OPCAreaBrowser {
 }
 
 func (b *OPCAreaBrowser) MoveToRoot() error {
-	return b.browser.ChangeBrowsePosition(OPCAE_BROWSE_TO, "")
+	return b.error("MoveToRoot", "", b.browser.ChangeBrowsePosition(OPCAE_BROWSE_TO, ""))
 }
 
 func (b *OPCAreaBrowser) MoveUP() error {
-	return b.browser.ChangeBrowsePosition(OPCAE_BROWSE_UP, "")
+	return b.error("MoveUP", "", b.browser.ChangeBrowsePosition(OPCAE_BROWSE_UP, ""))
 }
 
 func (b *OPCAreaBrowser) MoveDown(area string) error {
-	return b.browser.ChangeBrowsePosition(OPCAE_BROWSE_DOWN, area)
+	return b.error("MoveDown", area, b.browser.ChangeBrowsePosition(OPCAE_BROWSE_DOWN, area))
 }
 
 func (b *OPCAreaBrowser) BrowseOPCAreas(browseFilterType BrowseType, filterCriteria string) (areas []string, err error) {
-	return b.browser.BrowseOPCAreas(uint32(browseFilterType), filterCriteria)
+	areas, err = b.browser.BrowseOPCAreas(uint32(browseFilterType), filterCriteria)
+	err = b.error("BrowseOPCAreas", filterCriteria, err)
+	return
 }
 
 func (b *OPCAreaBrowser) GetQualifiedAreaName(areaName string) (qualifiedAreaName string, err error) {
-	return b.browser.GetQualifiedAreaName(areaName)
+	qualifiedAreaName, err = b.browser.GetQualifiedAreaName(areaName)
+	err = b.error("GetQualifiedAreaName", areaName, err)
+	return
 }
 
 func (b *OPCAreaBrowser) GetQualifiedSourceName(sourceName string) (qualifiedSourceName string, err error) {
-	return b.browser.GetQualifiedSourceName(sourceName)
+	qualifiedSourceName, err = b.browser.GetQualifiedSourceName(sourceName)
+	err = b.error("GetQualifiedSourceName", sourceName, err)
+	return
+}
+
+func (b *OPCAreaBrowser) error(op, item string, err error) error {
+	return newServerError(b.common, op, item, err)
 }
 
+// Release releases the browser, it waits for the Context calls in progress, the calls made afterwards fail with
+// CO_E_OBJNOTCONNECTED
 func (b *OPCAreaBrowser) Release() error {
+	if !b.calls.release() {
+		return nil
+	}
 	b.browser.Release()
 	return nil
 }
+
+// MoveToRootContext is MoveToRoot with a context, see CallContext, an abandoned call may still move the browse position
+func (b *OPCAreaBrowser) MoveToRootContext(ctx context.Context) error {
+	return callContextErr(ctx, b.timeout, trackedErr(&b.calls, "MoveToRoot", func() error {
+		return b.MoveToRoot()
+	}))
+}
+
+// MoveUPContext is MoveUP with a context, see CallContext, an abandoned call may still move the browse position
+func (b *OPCAreaBrowser) MoveUPContext(ctx context.Context) error {
+	return callContextErr(ctx, b.timeout, trackedErr(&b.calls, "MoveUP", func() error {
+		return b.MoveUP()
+	}))
+}
+
+// MoveDownContext is MoveDown with a context, see CallContext, an abandoned call may still move the browse position
+func (b *OPCAreaBrowser) MoveDownContext(ctx context.Context, area string) error {
+	return callContextErr(ctx, b.timeout, trackedErr(&b.calls, "MoveDown", func() error {
+		return b.MoveDown(area)
+	}))
+}
+
+// BrowseOPCAreasContext is BrowseOPCAreas with a context, see CallContext
+func (b *OPCAreaBrowser) BrowseOPCAreasContext(ctx context.Context, browseFilterType BrowseType, filterCriteria string) ([]string, error) {
+	return CallContext(ctx, b.timeout, tracked(&b.calls, "BrowseOPCAreas", func() ([]string, error) {
+		return b.BrowseOPCAreas(browseFilterType, filterCriteria)
+	}), nil)
+}
+
+// GetQualifiedAreaNameContext is GetQualifiedAreaName with a context, see CallContext
+func (b *OPCAreaBrowser) GetQualifiedAreaNameContext(ctx context.Context, areaName string) (string, error) {
+	return CallContext(ctx, b.timeout, tracked(&b.calls, "GetQualifiedAreaName", func() (string, error) {
+		return b.GetQualifiedAreaName(areaName)
+	}), nil)
+}
+
+// GetQualifiedSourceNameContext is GetQualifiedSourceName with a context, see CallContext
+func (b *OPCAreaBrowser) GetQualifiedSourceNameContext(ctx context.Context, sourceName string) (string, error) {
+	return CallContext(ctx, b.timeout, tracked(&b.calls, "GetQualifiedSourceName", func() (string, error) {
+		return b.GetQualifiedSourceName(sourceName)
+	}), nil)
+}
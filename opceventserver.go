@@ -1,7 +1,12 @@
+//go:build windows
+
 package opcae
 
 import (
+	"context"
+	"strconv"
 	"sync/atomic"
+	"time"
 	"unsafe"
 
 	"github.com/huskar-t/opcae/aecom"
@@ -13,16 +18,27 @@ import (
 
 type OPCEventServer struct {
 	iServer                  *aecom.IOPCEventServer
+	iServer2                 *aecom.IOPCEventServer2
 	iCommon                  *com.IOPCCommon
 	Name                     string
 	Node                     string
+	clientName               string
 	location                 com.CLSCTX
 	clientSubscriptionHandle uint32
 	eventSubscriptions       []*OPCEventSubscription
 	browsers                 []*OPCAreaBrowser
+	status                   *connectionStatus
+	timeout                  time.Duration
+	calls                    inFlight
+
+	container      *com.IConnectionPointContainer
+	point          *com.IConnectionPoint
+	shutdownSink   *IOPCShutdownSink
+	shutdownCookie uint32
 }
 
-func ConnectEventServer(progID, node string) (eventServer *OPCEventServer, err error) {
+// ConnectEventServer connects to the server progID on node, opts configure the connection, see WithDefaultTimeout
+func ConnectEventServer(progID, node string, opts ...ServerOption) (eventServer *OPCEventServer, err error) {
 	location := com.CLSCTX_LOCAL_SERVER
 	if !com.IsLocal(node) {
 		location = com.CLSCTX_REMOTE_SERVER
@@ -72,49 +88,199 @@ func ConnectEventServer(progID, node string) (eventServer *OPCEventServer, err e
 		Name:     progID,
 		Node:     node,
 		location: location,
+		status:   newConnectionStatus(),
+		timeout:  newServerOptions(opts).timeout,
+	}
+	eventServer.adviseShutdown()
+	var iUnknownServer2 *com.IUnknown
+	if iUnknownServer.QueryInterface(&aecom.IID_IOPCEventServer2, unsafe.Pointer(&iUnknownServer2)) == nil {
+		eventServer.iServer2 = &aecom.IOPCEventServer2{IUnknown: iUnknownServer2}
 	}
 	return eventServer, nil
 }
 
+// ConnectEventServerContext is ConnectEventServer with a context, a connection made after ctx is done is disconnected
+func ConnectEventServerContext(ctx context.Context, progID, node string, opts ...ServerOption) (*OPCEventServer, error) {
+	return CallContext(ctx, newServerOptions(opts).timeout, func() (*OPCEventServer, error) {
+		return ConnectEventServer(progID, node, opts...)
+	}, func(server *OPCEventServer) {
+		server.Disconnect()
+	})
+}
+
+// EventServerDialer returns a Dialer for NewSupervisor that connects with ConnectEventServerContext
+func EventServerDialer(progID, node string, opts ...ServerOption) Dialer {
+	return func(ctx context.Context) (EventServer, error) {
+		server, err := ConnectEventServerContext(ctx, progID, node, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return server.EventServer(), nil
+	}
+}
+
+// adviseShutdown registers a shutdown sink on the server, servers without IOPCShutdown support are silently accepted
+func (v *OPCEventServer) adviseShutdown() {
+	var iUnknownContainer *com.IUnknown
+	err := v.iServer.QueryInterface(&com.IID_IConnectionPointContainer, unsafe.Pointer(&iUnknownContainer))
+	if err != nil {
+		return
+	}
+	container := &com.IConnectionPointContainer{IUnknown: iUnknownContainer}
+	point, err := container.FindConnectionPoint(&IID_IOPCShutdown)
+	if err != nil {
+		container.Release()
+		return
+	}
+	sink := newShutdownSink(v.status)
+	cookie, err := point.Advise((*com.IUnknown)(unsafe.Pointer(sink)))
+	if err != nil {
+		point.Release()
+		container.Release()
+		return
+	}
+	v.container = container
+	v.point = point
+	v.shutdownSink = sink
+	v.shutdownCookie = cookie
+}
+
+// RegisterServerShutDown registers a channel that receives the reason of a server shutdown request.
+// The reason is sent without blocking, ch should be buffered.
+func (v *OPCEventServer) RegisterServerShutDown(ch chan string) {
+	v.status.AddReceiver(ch)
+}
+
+// ConnectionState returns ConnectionShuttingDown once the server requested a shutdown
+func (v *OPCEventServer) ConnectionState() ConnectionState {
+	return v.status.State()
+}
+
+// ShutdownReason returns the reason passed by the server with its shutdown request
+func (v *OPCEventServer) ShutdownReason() string {
+	return v.status.Reason()
+}
+
+// ShutdownNotify returns a channel that is closed when the server requests a shutdown or the client disconnects
+func (v *OPCEventServer) ShutdownNotify() <-chan struct{} {
+	return v.status.Done()
+}
+
+// SetLocaleID sets the locale used by the server for messages, descriptions and error strings
+func (v *OPCEventServer) SetLocaleID(localeID uint32) error {
+	return v.error("SetLocaleID", "", v.iCommon.SetLocaleID(localeID))
+}
+
+// GetLocaleID returns the locale used by the server
+func (v *OPCEventServer) GetLocaleID() (uint32, error) {
+	localeID, err := v.iCommon.GetLocaleID()
+	if err != nil {
+		return 0, v.error("GetLocaleID", "", err)
+	}
+	return localeID, nil
+}
+
+// QueryAvailableLocaleIDs returns the locales supported by the server
+func (v *OPCEventServer) QueryAvailableLocaleIDs() ([]uint32, error) {
+	localeIDs, err := v.iCommon.QueryAvailableLocaleIDs()
+	if err != nil {
+		return nil, v.error("QueryAvailableLocaleIDs", "", err)
+	}
+	return localeIDs, nil
+}
+
+// SetClientName tells the server the name of the client
+func (v *OPCEventServer) SetClientName(clientName string) error {
+	err := v.iCommon.SetClientName(clientName)
+	if err != nil {
+		return v.error("SetClientName", "", err)
+	}
+	v.clientName = clientName
+	return nil
+}
+
+// GetClientName returns the name set by SetClientName
+func (v *OPCEventServer) GetClientName() string {
+	return v.clientName
+}
+
+// GetErrorString returns the server's description of an error code in the current locale
+func (v *OPCEventServer) GetErrorString(errorCode int32) (string, error) {
+	return v.iCommon.GetErrorString(uint32(errorCode))
+}
+
+func (v *OPCEventServer) error(op, item string, err error) error {
+	return newServerError(v.iCommon, op, item, err)
+}
+
+func (v *OPCEventServer) itemError(op, item string, code int32) error {
+	return newServerErrorCode(v.iCommon, op, item, code)
+}
+
 func (v *OPCEventServer) GetStatus() (*aecom.EventServerStatus, error) {
-	return v.iServer.GetStatus()
+	status, err := v.iServer.GetStatus()
+	if err != nil {
+		return nil, v.error("GetStatus", "", err)
+	}
+	return status, nil
+}
+
+// eventServerStatus is GetStatus returning the platform-neutral EventServerStatus
+func (v *OPCEventServer) eventServerStatus() (*EventServerStatus, error) {
+	status, err := v.GetStatus()
+	if err != nil {
+		return nil, err
+	}
+	return &EventServerStatus{
+		StartTime:      status.StartTime,
+		CurrentTime:    status.CurrentTime,
+		LastUpdateTime: status.LastUpdateTime,
+		ServerState:    ServerState(status.ServerState),
+		MajorVersion:   status.MajorVersion,
+		MinorVersion:   status.MinorVersion,
+		BuildNumber:    status.BuildNumber,
+		Reserved:       status.Reserved,
+		VendorInfo:     status.VendorInfo,
+	}, nil
 }
 
 // CreateEventSubscription
 // active: FALSE if the Event Subscription is to be created inactive and TRUE if it is to be created as active.
 // bufferTime: The requested buffer time. The buffer time is in milliseconds and tells the server how often to send event notifications. A value of 0 for dwBufferTime means that the server should send event notifications as soon as it gets them.
 // maxSize: The requested maximum number of events that will be sent in a single IOPCEventSink::OnEvent callback. A value of 0 means that there is no limit to the number of events that will be sent in a single callback
-func (v *OPCEventServer) CreateEventSubscription(active bool, bufferTime, maxSize, receiverBufSize uint32) (*OPCEventSubscription, uint32, uint32, error) {
+// receiverBufSize: The capacity of the channel returned by GetReceiver, opts select what happens when it is full, see WithDeliveryPolicy.
+// When the server revised bufferTime or maxSize the subscription is returned with an informational *OPCError
+// matching ErrInvalidBufferTime or ErrInvalidMaxSize, see Succeeded.
+func (v *OPCEventServer) CreateEventSubscription(active bool, bufferTime, maxSize, receiverBufSize uint32, opts ...SubscriptionOption) (*OPCEventSubscription, uint32, uint32, error) {
 	clientSubscriptionHandle := atomic.AddUint32(&v.clientSubscriptionHandle, 1)
-	unknown, revisedBufferTime, revisedMaxSize, err := v.iServer.CreateEventSubscription(active, bufferTime, maxSize, clientSubscriptionHandle, &aecom.IID_IOPCEventSubscriptionMgt)
+	unknown, revisedBufferTime, revisedMaxSize, hr, err := v.iServer.CreateEventSubscriptionHRESULT(active, bufferTime, maxSize, clientSubscriptionHandle, &aecom.IID_IOPCEventSubscriptionMgt)
 	if err != nil {
-		return nil, 0, 0, err
+		return nil, 0, 0, v.error("CreateEventSubscription", "", err)
 	}
-	sub, err := NewOPCEventSubscription(unknown, v.iCommon, clientSubscriptionHandle, receiverBufSize)
+	opts = append([]SubscriptionOption{WithAttributeSchema(NewAttributeSchema(v.QueryEventAttributes))}, opts...)
+	sub, err := NewOPCEventSubscription(unknown, v.iCommon, clientSubscriptionHandle, receiverBufSize, opts...)
 	if err != nil {
 		return nil, 0, 0, err
 	}
-	return sub, revisedBufferTime, revisedMaxSize, nil
+	sub.status = v.status
+	sub.timeout = v.timeout
+	sub.calls.parent = &v.calls
+	return sub, revisedBufferTime, revisedMaxSize, successError("CreateEventSubscription", "", hr)
 }
 
 func (v *OPCEventServer) QueryAvailableFilters() ([]Filter, error) {
 	filterMask, err := v.iServer.QueryAvailableFilters()
 	if err != nil {
-		return nil, err
+		return nil, v.error("QueryAvailableFilters", "", err)
 	}
 	return ParseFilter(filterMask), nil
 }
 
-type EventCategory struct {
-	ID          uint32
-	Description string
-}
-
 func (v *OPCEventServer) QueryEventCategories(categories []EventCategoryType) ([]*EventCategory, error) {
 	category := MarshalEventCategoryType(categories)
 	ids, descs, err := v.iServer.QueryEventCategories(category)
 	if err != nil {
-		return nil, err
+		return nil, v.error("QueryEventCategories", "", err)
 	}
 	result := make([]*EventCategory, len(ids))
 	for i := range ids {
@@ -128,27 +294,33 @@ func (v *OPCEventServer) QueryEventCategories(categories []EventCategoryType) ([
 
 func (v *OPCEventServer) QueryConditionNames(categories []EventCategoryType) ([]string, error) {
 	category := MarshalEventCategoryType(categories)
-	return v.iServer.QueryConditionNames(category)
+	names, err := v.iServer.QueryConditionNames(category)
+	if err != nil {
+		return nil, v.error("QueryConditionNames", "", err)
+	}
+	return names, nil
 }
 
 func (v *OPCEventServer) QuerySourceConditions(source string) ([]string, error) {
-	return v.iServer.QuerySourceConditions(source)
+	names, err := v.iServer.QuerySourceConditions(source)
+	if err != nil {
+		return nil, v.error("QuerySourceConditions", source, err)
+	}
+	return names, nil
 }
 
 func (v *OPCEventServer) QuerySubConditionNames(conditionName string) ([]string, error) {
-	return v.iServer.QuerySubConditionNames(conditionName)
-}
-
-type EventAttribute struct {
-	ID          uint32
-	Description string
-	Type        uint16
+	names, err := v.iServer.QuerySubConditionNames(conditionName)
+	if err != nil {
+		return nil, v.error("QuerySubConditionNames", conditionName, err)
+	}
+	return names, nil
 }
 
 func (v *OPCEventServer) QueryEventAttributes(eventCategoryID uint32) ([]*EventAttribute, error) {
 	ids, descs, types, err := v.iServer.QueryEventAttributes(eventCategoryID)
 	if err != nil {
-		return nil, err
+		return nil, v.error("QueryEventAttributes", strconv.FormatUint(uint64(eventCategoryID), 10), err)
 	}
 	result := make([]*EventAttribute, len(ids))
 	for i := range ids {
@@ -161,16 +333,10 @@ func (v *OPCEventServer) QueryEventAttributes(eventCategoryID uint32) ([]*EventA
 	return result, nil
 }
 
-type ItemID struct {
-	ID    string
-	Name  string
-	CLSID windows.GUID
-}
-
 func (v *OPCEventServer) TranslateToItemIDs(source string, eventCategoryID uint32, conditionName string, subConditionName string, assocAttrIDs []uint32) ([]*ItemID, error) {
 	ids, names, clsIDs, err := v.iServer.TranslateToItemIDs(source, eventCategoryID, conditionName, subConditionName, assocAttrIDs)
 	if err != nil {
-		return nil, err
+		return nil, v.error("TranslateToItemIDs", source, err)
 	}
 	result := make([]*ItemID, len(ids))
 	for i := range ids {
@@ -183,20 +349,334 @@ func (v *OPCEventServer) TranslateToItemIDs(source string, eventCategoryID uint3
 	return result, nil
 }
 
+// GetConditionState returns the current state of a condition of a source.
+// eventCategoryID is the category of the condition and is used to resolve the attribute descriptions and types.
+// attributeIDs selects the attributes to return, all attributes of the category are returned when it is empty.
+func (v *OPCEventServer) GetConditionState(source, conditionName string, eventCategoryID uint32, attributeIDs []uint32) (*ConditionState, error) {
+	attributes, err := v.QueryEventAttributes(eventCategoryID)
+	if err != nil {
+		return nil, err
+	}
+	attributeMap := make(map[uint32]*EventAttribute, len(attributes))
+	for _, attribute := range attributes {
+		attributeMap[attribute.ID] = attribute
+	}
+	if len(attributeIDs) == 0 {
+		attributeIDs = make([]uint32, len(attributes))
+		for i, attribute := range attributes {
+			attributeIDs[i] = attribute.ID
+		}
+	}
+	state, err := v.iServer.GetConditionState(source, conditionName, attributeIDs)
+	if err != nil {
+		return nil, v.error("GetConditionState", source+"/"+conditionName, err)
+	}
+	result := &ConditionState{
+		State:              State(state.State),
+		ActiveSubCondition: state.ActiveSubCondition,
+		ASCDefinition:      state.ASCDefinition,
+		ASCSeverity:        state.ASCSeverity,
+		ASCDescription:     state.ASCDescription,
+		Quality:            state.Quality,
+		LastAckTime:        state.LastAckTime,
+		SubCondLastActive:  state.SubCondLastActive,
+		CondLastActive:     state.CondLastActive,
+		CondLastInactive:   state.CondLastInactive,
+		AcknowledgerID:     state.AcknowledgerID,
+		Comment:            state.Comment,
+		SubConditions:      make([]*SubCondition, state.NumSCs),
+		Attributes:         make([]*ConditionAttribute, 0, len(attributeIDs)),
+		AttributesByID:     make(map[uint32]*ConditionAttribute, len(attributeIDs)),
+		AttributesByName:   make(map[string]*ConditionAttribute, len(attributeIDs)),
+	}
+	for i := range result.SubConditions {
+		result.SubConditions[i] = &SubCondition{
+			Name:        state.SCNames[i],
+			Definition:  state.SCDefinitions[i],
+			Severity:    state.SCSeverities[i],
+			Description: state.SCDescriptions[i],
+		}
+	}
+	for i := range state.EventAttributes {
+		state.EventAttributes[i].Clear()
+	}
+	for i := 0; i < len(attributeIDs) && i < len(state.EventAttributeValues); i++ {
+		attribute := &ConditionAttribute{
+			ID:    attributeIDs[i],
+			Value: state.EventAttributeValues[i],
+		}
+		if definition, ok := attributeMap[attribute.ID]; ok {
+			attribute.Description = definition.Description
+			attribute.Type = definition.Type
+		}
+		if state.Errors[i] < 0 {
+			attribute.Value = nil
+			attribute.Err = v.itemError("GetConditionState", attribute.Description, state.Errors[i])
+		}
+		result.Attributes = append(result.Attributes, attribute)
+		result.AttributesByID[attribute.ID] = attribute
+		if attribute.Description != "" {
+			result.AttributesByName[attribute.Description] = attribute
+		}
+	}
+	return result, nil
+}
+
+// AckConditions acknowledges one or more conditions.
+// acknowledgerID identifies who acknowledged the conditions and comment is an optional note stored by the server.
+// The returned results are in the same order as requests.
+func (v *OPCEventServer) AckConditions(acknowledgerID, comment string, requests []*AckRequest) ([]*AckResult, error) {
+	if len(requests) == 0 {
+		return nil, nil
+	}
+	sources := make([]string, len(requests))
+	conditionNames := make([]string, len(requests))
+	activeTimes := make([]time.Time, len(requests))
+	cookies := make([]uint32, len(requests))
+	for i, request := range requests {
+		sources[i] = request.Source
+		conditionNames[i] = request.Condition
+		activeTimes[i] = request.ActiveTime
+		cookies[i] = request.Cookie
+	}
+	errs, err := v.iServer.AckCondition(acknowledgerID, comment, sources, conditionNames, activeTimes, cookies)
+	if err != nil {
+		return nil, v.error("AckConditions", "", err)
+	}
+	results := make([]*AckResult, len(requests))
+	for i, request := range requests {
+		results[i] = newAckResult(request, errs[i], v.itemError("AckConditions", request.Source+"/"+request.Condition, errs[i]))
+	}
+	return results, nil
+}
+
+// EnableConditionByArea enables all conditions of all sources within the areas.
+// errs has one entry per area and is nil for areas that were enabled. When the server supports IOPCEventServer2
+// the per-area results come from the server, otherwise the names are validated against the area browser first.
+func (v *OPCEventServer) EnableConditionByArea(areas []string) (errs []error, err error) {
+	if v.iServer2 != nil {
+		return v.EnableConditionByArea2(areas)
+	}
+	return v.changeConditionState("EnableConditionByArea", areas, v.validateAreas, v.iServer.EnableConditionByArea)
+}
+
+// EnableConditionBySource enables all conditions of the sources.
+// errs has one entry per source and is nil for sources that were enabled. When the server supports IOPCEventServer2
+// the per-source results come from the server, otherwise the names are validated against the server first.
+func (v *OPCEventServer) EnableConditionBySource(sources []string) (errs []error, err error) {
+	if v.iServer2 != nil {
+		return v.EnableConditionBySource2(sources)
+	}
+	return v.changeConditionState("EnableConditionBySource", sources, v.validateSources, v.iServer.EnableConditionBySource)
+}
+
+// DisableConditionByArea disables all conditions of all sources within the areas.
+// errs has one entry per area and is nil for areas that were disabled. When the server supports IOPCEventServer2
+// the per-area results come from the server, otherwise the names are validated against the area browser first.
+func (v *OPCEventServer) DisableConditionByArea(areas []string) (errs []error, err error) {
+	if v.iServer2 != nil {
+		return v.DisableConditionByArea2(areas)
+	}
+	return v.changeConditionState("DisableConditionByArea", areas, v.validateAreas, v.iServer.DisableConditionByArea)
+}
+
+// DisableConditionBySource disables all conditions of the sources.
+// errs has one entry per source and is nil for sources that were disabled. When the server supports IOPCEventServer2
+// the per-source results come from the server, otherwise the names are validated against the server first.
+func (v *OPCEventServer) DisableConditionBySource(sources []string) (errs []error, err error) {
+	if v.iServer2 != nil {
+		return v.DisableConditionBySource2(sources)
+	}
+	return v.changeConditionState("DisableConditionBySource", sources, v.validateSources, v.iServer.DisableConditionBySource)
+}
+
+// changeConditionState calls change of an IOPCEventServer 1.0 server with the names that pass validate. The
+// server fails the whole call when one name fails, then every name is changed on its own to find which.
+func (v *OPCEventServer) changeConditionState(op string, names []string, validate func([]string) ([]error, error), change func([]string) error) ([]error, error) {
+	errs, err := validate(names)
+	if err != nil {
+		return nil, err
+	}
+	valid := make([]int, 0, len(names))
+	validNames := make([]string, 0, len(names))
+	for i, name := range names {
+		if errs[i] == nil {
+			valid = append(valid, i)
+			validNames = append(validNames, name)
+		}
+	}
+	if len(valid) == 0 {
+		return errs, nil
+	}
+	err = change(validNames)
+	if err == nil {
+		return errs, nil
+	}
+	if ConnectionLost(err) {
+		return nil, v.error(op, "", err)
+	}
+	if len(valid) == 1 {
+		errs[valid[0]] = v.error(op, names[valid[0]], err)
+		return errs, nil
+	}
+	for _, i := range valid {
+		errs[i] = v.error(op, names[i], change(names[i:i+1]))
+	}
+	return errs, nil
+}
+
+// SupportsEventServer2 reports whether the server implements IOPCEventServer2
+func (v *OPCEventServer) SupportsEventServer2() bool {
+	return v.iServer2 != nil
+}
+
+// EnableConditionByArea2 enables all conditions of all sources within the areas and returns one error per area.
+func (v *OPCEventServer) EnableConditionByArea2(areas []string) ([]error, error) {
+	if v.iServer2 == nil {
+		return nil, ErrEventServer2NotSupported
+	}
+	codes, err := v.iServer2.EnableConditionByArea2(areas)
+	return v.itemErrors("EnableConditionByArea2", areas, codes, err)
+}
+
+// EnableConditionBySource2 enables all conditions of the sources and returns one error per source.
+func (v *OPCEventServer) EnableConditionBySource2(sources []string) ([]error, error) {
+	if v.iServer2 == nil {
+		return nil, ErrEventServer2NotSupported
+	}
+	codes, err := v.iServer2.EnableConditionBySource2(sources)
+	return v.itemErrors("EnableConditionBySource2", sources, codes, err)
+}
+
+// DisableConditionByArea2 disables all conditions of all sources within the areas and returns one error per area.
+func (v *OPCEventServer) DisableConditionByArea2(areas []string) ([]error, error) {
+	if v.iServer2 == nil {
+		return nil, ErrEventServer2NotSupported
+	}
+	codes, err := v.iServer2.DisableConditionByArea2(areas)
+	return v.itemErrors("DisableConditionByArea2", areas, codes, err)
+}
+
+// DisableConditionBySource2 disables all conditions of the sources and returns one error per source.
+func (v *OPCEventServer) DisableConditionBySource2(sources []string) ([]error, error) {
+	if v.iServer2 == nil {
+		return nil, ErrEventServer2NotSupported
+	}
+	codes, err := v.iServer2.DisableConditionBySource2(sources)
+	return v.itemErrors("DisableConditionBySource2", sources, codes, err)
+}
+
+// GetEnableStateByArea returns the enable state of the areas
+func (v *OPCEventServer) GetEnableStateByArea(areas []string) ([]*EnableState, error) {
+	if v.iServer2 == nil {
+		return nil, ErrEventServer2NotSupported
+	}
+	enabled, effectivelyEnabled, errs, err := v.iServer2.GetEnableStateByArea(areas)
+	if err != nil {
+		return nil, v.error("GetEnableStateByArea", "", err)
+	}
+	return v.enableStates("GetEnableStateByArea", areas, enabled, effectivelyEnabled, errs), nil
+}
+
+// GetEnableStateBySource returns the enable state of the sources
+func (v *OPCEventServer) GetEnableStateBySource(sources []string) ([]*EnableState, error) {
+	if v.iServer2 == nil {
+		return nil, ErrEventServer2NotSupported
+	}
+	enabled, effectivelyEnabled, errs, err := v.iServer2.GetEnableStateBySource(sources)
+	if err != nil {
+		return nil, v.error("GetEnableStateBySource", "", err)
+	}
+	return v.enableStates("GetEnableStateBySource", sources, enabled, effectivelyEnabled, errs), nil
+}
+
+func (v *OPCEventServer) enableStates(op string, names []string, enabled, effectivelyEnabled []bool, errs []int32) []*EnableState {
+	result := make([]*EnableState, len(names))
+	for i, name := range names {
+		result[i] = &EnableState{
+			Name:               name,
+			Enabled:            enabled[i],
+			EffectivelyEnabled: effectivelyEnabled[i],
+		}
+		result[i].Err = v.itemError(op, name, errs[i])
+	}
+	return result
+}
+
+func (v *OPCEventServer) itemErrors(op string, names []string, codes []int32, err error) ([]error, error) {
+	if err != nil {
+		return nil, v.error(op, "", err)
+	}
+	errs := make([]error, len(codes))
+	for i, code := range codes {
+		errs[i] = v.itemError(op, names[i], code)
+	}
+	return errs, nil
+}
+
+// validateAreas checks every fully qualified area name can be browsed to
+func (v *OPCEventServer) validateAreas(areas []string) ([]error, error) {
+	browser, err := v.CreateAreaBrowser()
+	if err != nil {
+		return nil, err
+	}
+	defer browser.Release()
+	errs := make([]error, len(areas))
+	for i, area := range areas {
+		err = browser.browser.ChangeBrowsePosition(OPCAE_BROWSE_TO, area)
+		if err != nil {
+			errs[i] = v.error("BrowseToArea", area, err)
+		}
+	}
+	return errs, nil
+}
+
+// validateSources checks every fully qualified source name is known by the server
+func (v *OPCEventServer) validateSources(sources []string) ([]error, error) {
+	errs := make([]error, len(sources))
+	for i, source := range sources {
+		_, err := v.iServer.QuerySourceConditions(source)
+		if err != nil {
+			errs[i] = v.error("QuerySourceConditions", source, err)
+		}
+	}
+	return errs, nil
+}
+
 func (v *OPCEventServer) CreateAreaBrowser() (*OPCAreaBrowser, error) {
 	unknown, err := v.iServer.CreateAreaBrowser(&aecom.IID_IOPCEventAreaBrowser)
 	if err != nil {
-		return nil, err
+		return nil, v.error("CreateAreaBrowser", "", err)
 	}
-	return NewOPCAreaBrowser(unknown), nil
+	browser := NewOPCAreaBrowser(unknown)
+	browser.common = v.iCommon
+	browser.timeout = v.timeout
+	browser.calls.parent = &v.calls
+	return browser, nil
 }
 
+// Disconnect releases the server, it waits for the Context calls in progress on the server, its subscriptions
+// and its area browsers, the calls made afterwards fail with CO_E_OBJNOTCONNECTED
 func (v *OPCEventServer) Disconnect() error {
+	if !v.calls.release() {
+		return nil
+	}
 	for _, subscription := range v.eventSubscriptions {
 		subscription.Release()
 	}
+	var err error
+	if v.point != nil {
+		err = v.point.Unadvise(v.shutdownCookie)
+		v.point.Release()
+		v.container.Release()
+	}
+	if v.iServer2 != nil {
+		v.iServer2.Release()
+	}
+	v.iCommon.Release()
 	v.iServer.Release()
-	return nil
+	v.status.Disconnect()
+	return err
 }
 
 func getClsIDFromServerList(progID, node string, location com.CLSCTX) (*windows.GUID, error) {
@@ -238,3 +718,200 @@ func getClsIDFromReg(progID, node string) (*windows.GUID, error) {
 	clsid, err = windows.GUIDFromString(clsidStr)
 	return &clsid, err
 }
+
+// SetLocaleIDContext is SetLocaleID with a context, see CallContext, an abandoned call may still set the locale
+func (v *OPCEventServer) SetLocaleIDContext(ctx context.Context, localeID uint32) error {
+	return callContextErr(ctx, v.timeout, trackedErr(&v.calls, "SetLocaleID", func() error {
+		return v.SetLocaleID(localeID)
+	}))
+}
+
+// GetLocaleIDContext is GetLocaleID with a context, see CallContext
+func (v *OPCEventServer) GetLocaleIDContext(ctx context.Context) (uint32, error) {
+	return CallContext(ctx, v.timeout, tracked(&v.calls, "GetLocaleID", func() (uint32, error) {
+		return v.GetLocaleID()
+	}), nil)
+}
+
+// QueryAvailableLocaleIDsContext is QueryAvailableLocaleIDs with a context, see CallContext
+func (v *OPCEventServer) QueryAvailableLocaleIDsContext(ctx context.Context) ([]uint32, error) {
+	return CallContext(ctx, v.timeout, tracked(&v.calls, "QueryAvailableLocaleIDs", func() ([]uint32, error) {
+		return v.QueryAvailableLocaleIDs()
+	}), nil)
+}
+
+// SetClientNameContext is SetClientName with a context, see CallContext, an abandoned call may still set the client name
+func (v *OPCEventServer) SetClientNameContext(ctx context.Context, clientName string) error {
+	return callContextErr(ctx, v.timeout, trackedErr(&v.calls, "SetClientName", func() error {
+		return v.SetClientName(clientName)
+	}))
+}
+
+// GetErrorStringContext is GetErrorString with a context, see CallContext
+func (v *OPCEventServer) GetErrorStringContext(ctx context.Context, errorCode int32) (string, error) {
+	return CallContext(ctx, v.timeout, tracked(&v.calls, "GetErrorString", func() (string, error) {
+		return v.GetErrorString(errorCode)
+	}), nil)
+}
+
+// GetStatusContext is GetStatus with a context, see CallContext
+func (v *OPCEventServer) GetStatusContext(ctx context.Context) (*aecom.EventServerStatus, error) {
+	return CallContext(ctx, v.timeout, tracked(&v.calls, "GetStatus", func() (*aecom.EventServerStatus, error) {
+		return v.GetStatus()
+	}), nil)
+}
+
+// QueryAvailableFiltersContext is QueryAvailableFilters with a context, see CallContext
+func (v *OPCEventServer) QueryAvailableFiltersContext(ctx context.Context) ([]Filter, error) {
+	return CallContext(ctx, v.timeout, tracked(&v.calls, "QueryAvailableFilters", func() ([]Filter, error) {
+		return v.QueryAvailableFilters()
+	}), nil)
+}
+
+// QueryEventCategoriesContext is QueryEventCategories with a context, see CallContext
+func (v *OPCEventServer) QueryEventCategoriesContext(ctx context.Context, categories []EventCategoryType) ([]*EventCategory, error) {
+	return CallContext(ctx, v.timeout, tracked(&v.calls, "QueryEventCategories", func() ([]*EventCategory, error) {
+		return v.QueryEventCategories(categories)
+	}), nil)
+}
+
+// QueryConditionNamesContext is QueryConditionNames with a context, see CallContext
+func (v *OPCEventServer) QueryConditionNamesContext(ctx context.Context, categories []EventCategoryType) ([]string, error) {
+	return CallContext(ctx, v.timeout, tracked(&v.calls, "QueryConditionNames", func() ([]string, error) {
+		return v.QueryConditionNames(categories)
+	}), nil)
+}
+
+// QuerySourceConditionsContext is QuerySourceConditions with a context, see CallContext
+func (v *OPCEventServer) QuerySourceConditionsContext(ctx context.Context, source string) ([]string, error) {
+	return CallContext(ctx, v.timeout, tracked(&v.calls, "QuerySourceConditions", func() ([]string, error) {
+		return v.QuerySourceConditions(source)
+	}), nil)
+}
+
+// QuerySubConditionNamesContext is QuerySubConditionNames with a context, see CallContext
+func (v *OPCEventServer) QuerySubConditionNamesContext(ctx context.Context, conditionName string) ([]string, error) {
+	return CallContext(ctx, v.timeout, tracked(&v.calls, "QuerySubConditionNames", func() ([]string, error) {
+		return v.QuerySubConditionNames(conditionName)
+	}), nil)
+}
+
+// QueryEventAttributesContext is QueryEventAttributes with a context, see CallContext
+func (v *OPCEventServer) QueryEventAttributesContext(ctx context.Context, eventCategoryID uint32) ([]*EventAttribute, error) {
+	return CallContext(ctx, v.timeout, tracked(&v.calls, "QueryEventAttributes", func() ([]*EventAttribute, error) {
+		return v.QueryEventAttributes(eventCategoryID)
+	}), nil)
+}
+
+// TranslateToItemIDsContext is TranslateToItemIDs with a context, see CallContext
+func (v *OPCEventServer) TranslateToItemIDsContext(ctx context.Context, source string, eventCategoryID uint32, conditionName string, subConditionName string, assocAttrIDs []uint32) ([]*ItemID, error) {
+	return CallContext(ctx, v.timeout, tracked(&v.calls, "TranslateToItemIDs", func() ([]*ItemID, error) {
+		return v.TranslateToItemIDs(source, eventCategoryID, conditionName, subConditionName, assocAttrIDs)
+	}), nil)
+}
+
+// GetConditionStateContext is GetConditionState with a context, see CallContext
+func (v *OPCEventServer) GetConditionStateContext(ctx context.Context, source, conditionName string, eventCategoryID uint32, attributeIDs []uint32) (*ConditionState, error) {
+	return CallContext(ctx, v.timeout, tracked(&v.calls, "GetConditionState", func() (*ConditionState, error) {
+		return v.GetConditionState(source, conditionName, eventCategoryID, attributeIDs)
+	}), nil)
+}
+
+// AckConditionsContext is AckConditions with a context, see CallContext, an abandoned call may still acknowledge the conditions, check them with GetConditionState before acknowledging again
+func (v *OPCEventServer) AckConditionsContext(ctx context.Context, acknowledgerID, comment string, requests []*AckRequest) ([]*AckResult, error) {
+	return CallContext(ctx, v.timeout, tracked(&v.calls, "AckConditions", func() ([]*AckResult, error) {
+		return v.AckConditions(acknowledgerID, comment, requests)
+	}), nil)
+}
+
+// EnableConditionByAreaContext is EnableConditionByArea with a context, see CallContext, an abandoned call may still enable the areas
+func (v *OPCEventServer) EnableConditionByAreaContext(ctx context.Context, areas []string) ([]error, error) {
+	return CallContext(ctx, v.timeout, tracked(&v.calls, "EnableConditionByArea", func() ([]error, error) {
+		return v.EnableConditionByArea(areas)
+	}), nil)
+}
+
+// EnableConditionBySourceContext is EnableConditionBySource with a context, see CallContext, an abandoned call may still enable the sources
+func (v *OPCEventServer) EnableConditionBySourceContext(ctx context.Context, sources []string) ([]error, error) {
+	return CallContext(ctx, v.timeout, tracked(&v.calls, "EnableConditionBySource", func() ([]error, error) {
+		return v.EnableConditionBySource(sources)
+	}), nil)
+}
+
+// DisableConditionByAreaContext is DisableConditionByArea with a context, see CallContext, an abandoned call may still disable the areas
+func (v *OPCEventServer) DisableConditionByAreaContext(ctx context.Context, areas []string) ([]error, error) {
+	return CallContext(ctx, v.timeout, tracked(&v.calls, "DisableConditionByArea", func() ([]error, error) {
+		return v.DisableConditionByArea(areas)
+	}), nil)
+}
+
+// DisableConditionBySourceContext is DisableConditionBySource with a context, see CallContext, an abandoned call may still disable the sources
+func (v *OPCEventServer) DisableConditionBySourceContext(ctx context.Context, sources []string) ([]error, error) {
+	return CallContext(ctx, v.timeout, tracked(&v.calls, "DisableConditionBySource", func() ([]error, error) {
+		return v.DisableConditionBySource(sources)
+	}), nil)
+}
+
+// EnableConditionByArea2Context is EnableConditionByArea2 with a context, see CallContext, an abandoned call may still enable the areas
+func (v *OPCEventServer) EnableConditionByArea2Context(ctx context.Context, areas []string) ([]error, error) {
+	return CallContext(ctx, v.timeout, tracked(&v.calls, "EnableConditionByArea2", func() ([]error, error) {
+		return v.EnableConditionByArea2(areas)
+	}), nil)
+}
+
+// EnableConditionBySource2Context is EnableConditionBySource2 with a context, see CallContext, an abandoned call may still enable the sources
+func (v *OPCEventServer) EnableConditionBySource2Context(ctx context.Context, sources []string) ([]error, error) {
+	return CallContext(ctx, v.timeout, tracked(&v.calls, "EnableConditionBySource2", func() ([]error, error) {
+		return v.EnableConditionBySource2(sources)
+	}), nil)
+}
+
+// DisableConditionByArea2Context is DisableConditionByArea2 with a context, see CallContext, an abandoned call may still disable the areas
+func (v *OPCEventServer) DisableConditionByArea2Context(ctx context.Context, areas []string) ([]error, error) {
+	return CallContext(ctx, v.timeout, tracked(&v.calls, "DisableConditionByArea2", func() ([]error, error) {
+		return v.DisableConditionByArea2(areas)
+	}), nil)
+}
+
+// DisableConditionBySource2Context is DisableConditionBySource2 with a context, see CallContext, an abandoned call may still disable the sources
+func (v *OPCEventServer) DisableConditionBySource2Context(ctx context.Context, sources []string) ([]error, error) {
+	return CallContext(ctx, v.timeout, tracked(&v.calls, "DisableConditionBySource2", func() ([]error, error) {
+		return v.DisableConditionBySource2(sources)
+	}), nil)
+}
+
+// GetEnableStateByAreaContext is GetEnableStateByArea with a context, see CallContext
+func (v *OPCEventServer) GetEnableStateByAreaContext(ctx context.Context, areas []string) ([]*EnableState, error) {
+	return CallContext(ctx, v.timeout, tracked(&v.calls, "GetEnableStateByArea", func() ([]*EnableState, error) {
+		return v.GetEnableStateByArea(areas)
+	}), nil)
+}
+
+// GetEnableStateBySourceContext is GetEnableStateBySource with a context, see CallContext
+func (v *OPCEventServer) GetEnableStateBySourceContext(ctx context.Context, sources []string) ([]*EnableState, error) {
+	return CallContext(ctx, v.timeout, tracked(&v.calls, "GetEnableStateBySource", func() ([]*EnableState, error) {
+		return v.GetEnableStateBySource(sources)
+	}), nil)
+}
+
+// CreateEventSubscriptionContext is CreateEventSubscription with a context, a subscription created after ctx is done is released
+func (v *OPCEventServer) CreateEventSubscriptionContext(ctx context.Context, active bool, bufferTime, maxSize, receiverBufSize uint32, opts ...SubscriptionOption) (*OPCEventSubscription, uint32, uint32, error) {
+	type created struct {
+		sub                 *OPCEventSubscription
+		bufferTime, maxSize uint32
+	}
+	result, err := CallContext(ctx, v.timeout, tracked(&v.calls, "CreateEventSubscription", func() (created, error) {
+		sub, revisedBufferTime, revisedMaxSize, err := v.CreateEventSubscription(active, bufferTime, maxSize, receiverBufSize, opts...)
+		return created{sub: sub, bufferTime: revisedBufferTime, maxSize: revisedMaxSize}, err
+	}), func(c created) {
+		c.sub.Release()
+	})
+	return result.sub, result.bufferTime, result.maxSize, err
+}
+
+// CreateAreaBrowserContext is CreateAreaBrowser with a context, a browser created after ctx is done is released
+func (v *OPCEventServer) CreateAreaBrowserContext(ctx context.Context) (*OPCAreaBrowser, error) {
+	return CallContext(ctx, v.timeout, tracked(&v.calls, "CreateAreaBrowser", v.CreateAreaBrowser), func(browser *OPCAreaBrowser) {
+		browser.Release()
+	})
+}
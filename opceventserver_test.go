@@ -1,7 +1,10 @@
+//go:build windows
+
 package opcae
 
 import (
 	"testing"
+	"time"
 
 	"github.com/huskar-t/opcda/com"
 	"github.com/stretchr/testify/assert"
@@ -25,6 +28,22 @@ func TestConnectEventServer(t *testing.T) {
 	eventServer.Disconnect()
 }
 
+func TestListEventServers(t *testing.T) {
+	servers, err := ListEventServers(TestHost)
+	assert.NoError(t, err)
+	assert.Greater(t, len(servers), 0)
+	for _, server := range servers {
+		assert.NotEmpty(t, server.ClsStr)
+		t.Log(server.ProgID, server.ClsStr, server.Description, server.VerIndProgID)
+	}
+}
+
+func TestListEventServersFromReg(t *testing.T) {
+	servers, err := listServersFromReg(TestHost)
+	assert.NoError(t, err)
+	assert.Greater(t, len(servers), 0)
+}
+
 func TestQueryAvailableFilters(t *testing.T) {
 	eventServer, err := ConnectEventServer(TestProgID, TestHost)
 	if err != nil {
@@ -114,3 +133,135 @@ func TestOPCEventServer_CreateEventSubscription(t *testing.T) {
 	assert.Equal(t, uint32(100), revisedBufferTime)
 	assert.Equal(t, uint32(1000), revisedMaxSize)
 }
+
+func TestOPCEventServer_AckConditions(t *testing.T) {
+	eventServer, err := ConnectEventServer(TestProgID, TestHost)
+	if err != nil {
+		t.Fatalf("connect to opc event server failed: %s\n", err)
+	}
+	assert.NotNil(t, eventServer)
+	defer eventServer.Disconnect()
+	results, err := eventServer.AckConditions("opcae", "test", []*AckRequest{
+		{Source: "not.exist.source", Condition: "not exist condition", ActiveTime: time.Now()},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+	assert.NotEqual(t, AckSucceeded, results[0].Status)
+	t.Log(results[0].Status, results[0].Err)
+}
+
+func TestOPCEventServer_GetConditionState(t *testing.T) {
+	eventServer, err := ConnectEventServer(TestProgID, TestHost)
+	if err != nil {
+		t.Fatalf("connect to opc event server failed: %s\n", err)
+	}
+	assert.NotNil(t, eventServer)
+	defer eventServer.Disconnect()
+	subscription, _, _, err := eventServer.CreateEventSubscription(true, 0, 0, 100)
+	assert.NoError(t, err)
+	defer subscription.Release()
+	timeout := time.After(time.Minute)
+	for {
+		select {
+		case data, ok := <-subscription.GetReceiver():
+			if !ok {
+				t.Fatal("subscription closed")
+			}
+			for _, event := range data.Events {
+				if event.Condition == "" {
+					continue
+				}
+				state, err := eventServer.GetConditionState(event.Source, event.Condition, event.Category, nil)
+				assert.NoError(t, err)
+				assert.NotNil(t, state)
+				for _, attribute := range state.Attributes {
+					t.Log(attribute.ID, attribute.Description, attribute.Value, attribute.Err)
+				}
+				return
+			}
+		case <-timeout:
+			t.Fatal("no condition event received")
+		}
+	}
+}
+
+func TestOPCEventServer_EnableConditionByArea(t *testing.T) {
+	eventServer, err := ConnectEventServer(KepWareProgID, TestHost)
+	if err != nil {
+		t.Fatalf("connect to opc event server failed: %s\n", err)
+	}
+	assert.NotNil(t, eventServer)
+	defer eventServer.Disconnect()
+	errs, err := eventServer.DisableConditionByArea([]string{"_System", "not_exist_area"})
+	assert.NoError(t, err)
+	assert.Len(t, errs, 2)
+	assert.NoError(t, errs[0])
+	assert.Error(t, errs[1])
+	errs, err = eventServer.EnableConditionByArea([]string{"_System"})
+	assert.NoError(t, err)
+	assert.Len(t, errs, 1)
+	assert.NoError(t, errs[0])
+}
+
+func TestOPCEventServer_GetEnableStateByArea(t *testing.T) {
+	eventServer, err := ConnectEventServer(KepWareProgID, TestHost)
+	if err != nil {
+		t.Fatalf("connect to opc event server failed: %s\n", err)
+	}
+	assert.NotNil(t, eventServer)
+	defer eventServer.Disconnect()
+	if !eventServer.SupportsEventServer2() {
+		_, err = eventServer.GetEnableStateByArea([]string{"_System"})
+		assert.ErrorIs(t, err, ErrEventServer2NotSupported)
+		return
+	}
+	states, err := eventServer.GetEnableStateByArea([]string{"_System"})
+	assert.NoError(t, err)
+	assert.Len(t, states, 1)
+	assert.NoError(t, states[0].Err)
+	t.Log(states[0].Enabled, states[0].EffectivelyEnabled)
+}
+
+func TestOPCEventServer_ConnectionState(t *testing.T) {
+	eventServer, err := ConnectEventServer(TestProgID, TestHost)
+	if err != nil {
+		t.Fatalf("connect to opc event server failed: %s\n", err)
+	}
+	assert.NotNil(t, eventServer)
+	ch := make(chan string, 1)
+	eventServer.RegisterServerShutDown(ch)
+	assert.Equal(t, ConnectionConnected, eventServer.ConnectionState())
+	subscription, _, _, err := eventServer.CreateEventSubscription(true, 0, 0, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, ConnectionConnected, subscription.ConnectionState())
+	subscription.Release()
+	eventServer.Disconnect()
+	assert.Equal(t, ConnectionDisconnected, eventServer.ConnectionState())
+	assert.Equal(t, ConnectionDisconnected, subscription.ConnectionState())
+	<-subscription.Closed()
+}
+
+func TestOPCEventServer_LocaleID(t *testing.T) {
+	eventServer, err := ConnectEventServer(TestProgID, TestHost)
+	if err != nil {
+		t.Fatalf("connect to opc event server failed: %s\n", err)
+	}
+	assert.NotNil(t, eventServer)
+	defer eventServer.Disconnect()
+	localeIDs, err := eventServer.QueryAvailableLocaleIDs()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, localeIDs)
+	err = eventServer.SetLocaleID(localeIDs[0])
+	assert.NoError(t, err)
+	localeID, err := eventServer.GetLocaleID()
+	assert.NoError(t, err)
+	assert.Equal(t, localeIDs[0], localeID)
+	err = eventServer.SetClientName("opcae test")
+	assert.NoError(t, err)
+	assert.Equal(t, "opcae test", eventServer.GetClientName())
+	_, err = eventServer.QuerySourceConditions("not.exist.source")
+	var opcErr *OPCError
+	if assert.ErrorAs(t, err, &opcErr) {
+		t.Log(opcErr.Message)
+	}
+}
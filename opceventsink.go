@@ -1,6 +1,9 @@
+//go:build windows
+
 package opcae
 
 import (
+	"sync/atomic"
 	"syscall"
 	"time"
 	"unsafe"
@@ -17,10 +20,11 @@ var IID_IOPCEventSink = windows.GUID{
 }
 
 type IOPCEventSink struct {
-	lpVtbl   *IOPCEventSinkVtbl
-	ref      int32
-	clsid    *windows.GUID
-	receiver chan *EventSinkOnEventData
+	lpVtbl     *IOPCEventSinkVtbl
+	ref        int32
+	clsid      *windows.GUID
+	dispatcher *Dispatcher
+	watchdog   atomic.Pointer[Watchdog]
 }
 
 type IOPCEventSinkVtbl struct {
@@ -31,7 +35,7 @@ type IOPCEventSinkVtbl struct {
 }
 
 func NewEventSink(
-	receiver chan *EventSinkOnEventData,
+	dispatcher *Dispatcher,
 ) *IOPCEventSink {
 	return &IOPCEventSink{
 		lpVtbl: &IOPCEventSinkVtbl{
@@ -40,9 +44,9 @@ func NewEventSink(
 			pRelease:        syscall.NewCallback(EventSinkRelease),
 			pOnEvent:        syscall.NewCallback(EventSinkOnEvent),
 		},
-		ref:      0,
-		clsid:    &IID_IOPCEventSink,
-		receiver: receiver,
+		ref:        0,
+		clsid:      &IID_IOPCEventSink,
+		dispatcher: dispatcher,
 	}
 }
 
@@ -112,33 +116,6 @@ type ONEVENTSTRUCT struct {
 	SzActorID          *uint16
 }
 
-type EventSinkOnEventData struct {
-	ClientHandle uint32
-	Refresh      bool
-	LastRefresh  bool
-	Events       []*OnEventStruct
-}
-type OnEventStruct struct {
-	ChangeMask []ChangeMask
-	NewState   State
-	Source     string
-	Time       time.Time
-	Message    string
-	EventType  uint32
-	Category   uint32
-	Severity   uint32
-	Condition  string
-	Subcond    string
-	Quality    uint16
-	Reserved   uint16
-	AckReq     bool
-	ActiveTime time.Time
-	Cookie     uint32
-	NumAttrs   uint32
-	Attributes []interface{}
-	ActorID    string
-}
-
 const VariantSize = unsafe.Sizeof(com.VARIANT{})
 
 // virtual HRESULT STDMETHODCALLTYPE OnEvent(
@@ -153,6 +130,10 @@ func EventSinkOnEvent(this *com.IUnknown, clientHandle uint32, refresh int32, la
 		ClientHandle: clientHandle,
 		Refresh:      refresh != 0,
 		LastRefresh:  lastRefresh != 0,
+		KeepAlive:    count == 0 && refresh == 0,
+	}
+	if w := er.watchdog.Load(); w != nil {
+		w.Feed()
 	}
 	evt.Events = make([]*OnEventStruct, count)
 	for i := uint32(0); i < count; i++ {
@@ -182,6 +163,6 @@ func EventSinkOnEvent(this *com.IUnknown, clientHandle uint32, refresh int32, la
 			evt.Events[i].Attributes[j] = variant.Value()
 		}
 	}
-	er.receiver <- evt
+	er.dispatcher.Deliver(evt)
 	return uintptr(com.S_OK)
 }
@@ -1,24 +1,39 @@
+//go:build windows
+
 package opcae
 
 import (
-	"github.com/huskar-t/opcae/aecom"
+	"context"
+	"errors"
+	"time"
 	"unsafe"
 
+	"github.com/huskar-t/opcae/aecom"
+
 	"github.com/huskar-t/opcda/com"
 )
 
+var _ EventSubscription = (*OPCEventSubscription)(nil)
+
 type OPCEventSubscription struct {
 	cookie               uint32
 	receiver             chan *EventSinkOnEventData
+	dispatcher           *Dispatcher
+	schema               *AttributeSchema
 	container            *com.IConnectionPointContainer
 	point                *com.IConnectionPoint
 	event                *IOPCEventSink
 	eventSubscriptionMgt *aecom.IOPCEventSubscriptionMgt
-	common               *com.IOPCCommon
-	clientHandle         uint32
+	// eventSubscriptionMgt2 is nil when the server only implements IOPCEventSubscriptionMgt
+	eventSubscriptionMgt2 *aecom.IOPCEventSubscriptionMgt2
+	common                *com.IOPCCommon
+	clientHandle          uint32
+	status                *connectionStatus
+	timeout               time.Duration
+	calls                 inFlight
 }
 
-func NewOPCEventSubscription(unknown *com.IUnknown, common *com.IOPCCommon, clientHandle, receiverBufSize uint32) (*OPCEventSubscription, error) {
+func NewOPCEventSubscription(unknown *com.IUnknown, common *com.IOPCCommon, clientHandle, receiverBufSize uint32, opts ...SubscriptionOption) (*OPCEventSubscription, error) {
 	var iUnknownContainer *com.IUnknown
 	err := unknown.QueryInterface(&com.IID_IConnectionPointContainer, unsafe.Pointer(&iUnknownContainer))
 	if err != nil {
@@ -40,12 +55,14 @@ func NewOPCEventSubscription(unknown *com.IUnknown, common *com.IOPCCommon, clie
 		}
 	}()
 	receiver := make(chan *EventSinkOnEventData, receiverBufSize)
-	event := NewEventSink(receiver)
+	dispatcher := NewSubscriptionDispatcher(receiver, opts...)
+	event := NewEventSink(dispatcher)
 	cookie, err := point.Advise((*com.IUnknown)(unsafe.Pointer(event)))
 	if err != nil {
+		dispatcher.Close()
 		return nil, err
 	}
-	return &OPCEventSubscription{
+	subscription := &OPCEventSubscription{
 		eventSubscriptionMgt: &aecom.IOPCEventSubscriptionMgt{IUnknown: unknown},
 		common:               common,
 		clientHandle:         clientHandle,
@@ -54,65 +71,306 @@ func NewOPCEventSubscription(unknown *com.IUnknown, common *com.IOPCCommon, clie
 		event:                event,
 		cookie:               cookie,
 		receiver:             receiver,
-	}, nil
+		dispatcher:           dispatcher,
+		schema:               dispatcher.schema,
+		status:               newConnectionStatus(),
+	}
+	var iUnknownMgt2 *com.IUnknown
+	if unknown.QueryInterface(&aecom.IID_IOPCEventSubscriptionMgt2, unsafe.Pointer(&iUnknownMgt2)) == nil {
+		subscription.eventSubscriptionMgt2 = &aecom.IOPCEventSubscriptionMgt2{IUnknown: iUnknownMgt2}
+	}
+	return subscription, nil
 }
 
 func (es *OPCEventSubscription) GetClientHandle() uint32 {
 	return es.clientHandle
 }
 
+// ConnectionState returns the connection state of the server the subscription was created on
+func (es *OPCEventSubscription) ConnectionState() ConnectionState {
+	return es.status.State()
+}
+
+// Closed returns a channel that is closed when the connection to the server ends, because the server requested
+// a shutdown or the client disconnected, ConnectionState tells which
+func (es *OPCEventSubscription) Closed() <-chan struct{} {
+	return es.status.Done()
+}
+
 func (es *OPCEventSubscription) GetState() (active bool, bufferTime uint32, maxSize uint32, clientSubscription uint32, err error) {
-	return es.eventSubscriptionMgt.GetState()
+	active, bufferTime, maxSize, clientSubscription, err = es.eventSubscriptionMgt.GetState()
+	err = es.error("GetState", "", err)
+	return
 }
 
 func (es *OPCEventSubscription) SetActive(active bool) error {
 	comBool := com.BoolToComBOOL(active)
 	_, _, err := es.eventSubscriptionMgt.SetState(&comBool, nil, nil, es.clientHandle)
-	return err
+	return es.error("SetActive", "", err)
 }
 
+// SetBufferTime sets the buffer time in milliseconds. When the server revised it the revised value is
+// returned with an informational *OPCError matching ErrInvalidBufferTime, see Succeeded.
 func (es *OPCEventSubscription) SetBufferTime(bufferTime uint32) (uint32, error) {
-	revisedBufferTime, _, err := es.eventSubscriptionMgt.SetState(nil, &bufferTime, nil, es.clientHandle)
-	return revisedBufferTime, err
+	revisedBufferTime, _, hr, err := es.eventSubscriptionMgt.SetStateHRESULT(nil, &bufferTime, nil, es.clientHandle)
+	if err != nil {
+		return 0, es.error("SetBufferTime", "", err)
+	}
+	return revisedBufferTime, successError("SetBufferTime", "", hr)
 }
 
+// SetMaxSize sets the maximum number of events in one callback. When the server revised it the revised
+// value is returned with an informational *OPCError matching ErrInvalidMaxSize, see Succeeded.
 func (es *OPCEventSubscription) SetMaxSize(maxSize uint32) (uint32, error) {
-	_, revisedMaxSize, err := es.eventSubscriptionMgt.SetState(nil, nil, &maxSize, es.clientHandle)
-	return revisedMaxSize, err
+	_, revisedMaxSize, hr, err := es.eventSubscriptionMgt.SetStateHRESULT(nil, nil, &maxSize, es.clientHandle)
+	if err != nil {
+		return 0, es.error("SetMaxSize", "", err)
+	}
+	return revisedMaxSize, successError("SetMaxSize", "", hr)
 }
 
 func (es *OPCEventSubscription) SetFilter(events []EventCategoryType, eventCategories []uint32, lowSeverity uint32, highSeverity uint32, areaList []string, sourceList []string) error {
-	return es.eventSubscriptionMgt.SetFilter(MarshalEventCategoryType(events), eventCategories, lowSeverity, highSeverity, areaList, sourceList)
+	return es.error("SetFilter", "", es.eventSubscriptionMgt.SetFilter(MarshalEventCategoryType(events), eventCategories, lowSeverity, highSeverity, areaList, sourceList))
 }
 
 func (es *OPCEventSubscription) GetFilter() (events []EventCategoryType, eventCategories []uint32, lowSeverity uint32, highSeverity uint32, areaList []string, sourceList []string, err error) {
 	cEvents, eventCategories, lowSeverity, highSeverity, areaList, sourceList, err := es.eventSubscriptionMgt.GetFilter()
-	return UnmarshalEventCategoryType(cEvents), eventCategories, lowSeverity, highSeverity, areaList, sourceList, err
+	return UnmarshalEventCategoryType(cEvents), eventCategories, lowSeverity, highSeverity, areaList, sourceList, es.error("GetFilter", "", err)
 }
 
+// SelectReturnedAttributes selects the attributes the events of the category return. With an AttributeSchema the
+// attributes are looked up first, when that fails the selection is not sent and the error is returned.
 func (es *OPCEventSubscription) SelectReturnedAttributes(eventCategory uint32, attributeIDs []uint32) (err error) {
-	return es.eventSubscriptionMgt.SelectReturnedAttributes(eventCategory, attributeIDs)
+	var returned []*EventAttribute
+	if es.schema != nil {
+		returned, err = es.schema.Lookup(eventCategory, attributeIDs)
+		if err != nil {
+			return err
+		}
+	}
+	err = es.eventSubscriptionMgt.SelectReturnedAttributes(eventCategory, attributeIDs)
+	if err != nil {
+		return es.error("SelectReturnedAttributes", "", err)
+	}
+	if es.schema != nil {
+		es.schema.Set(eventCategory, returned)
+	}
+	return nil
+}
+
+// SelectReturnedAttributesByName selects the attributes the events of the category return by their descriptions
+func (es *OPCEventSubscription) SelectReturnedAttributesByName(eventCategory uint32, names []string) error {
+	if es.schema == nil {
+		return ErrNoAttributeSchema
+	}
+	attributeIDs, err := es.schema.Resolve(eventCategory, names)
+	if err != nil {
+		return err
+	}
+	return es.SelectReturnedAttributes(eventCategory, attributeIDs)
 }
 
 func (es *OPCEventSubscription) GetReturnedAttributes(eventCategory uint32) (attributeIDs []uint32, err error) {
-	return es.eventSubscriptionMgt.GetReturnedAttributes(eventCategory)
+	attributeIDs, err = es.eventSubscriptionMgt.GetReturnedAttributes(eventCategory)
+	err = es.error("GetReturnedAttributes", "", err)
+	return
 }
 
 func (es *OPCEventSubscription) Refresh() error {
-	return es.eventSubscriptionMgt.Refresh(es.cookie)
+	return es.error("Refresh", "", es.eventSubscriptionMgt.Refresh(es.cookie))
 }
 
 func (es *OPCEventSubscription) CancelRefresh() error {
-	return es.eventSubscriptionMgt.CancelRefresh(es.cookie)
+	return es.error("CancelRefresh", "", es.eventSubscriptionMgt.CancelRefresh(es.cookie))
+}
+
+// RefreshAndWait refreshes the subscription and returns the events of the refresh callbacks, live events
+// still go to the receiver. When ctx is done the refresh is cancelled and ctx.Err() is returned.
+func (es *OPCEventSubscription) RefreshAndWait(ctx context.Context) ([]*OnEventStruct, error) {
+	return es.dispatcher.RefreshAndWait(ctx, es.Refresh, es.CancelRefresh)
+}
+
+// SetKeepAlive sets the keep-alive time in milliseconds, the server sends a callback without events when no
+// events were sent within the keep-alive time. 0 disables keep-alive callbacks. Returns the revised keep-alive time,
+// with an informational *OPCError matching ErrInvalidKeepAliveTime when the server revised it, see Succeeded.
+func (es *OPCEventSubscription) SetKeepAlive(keepAliveTime uint32) (uint32, error) {
+	if es.eventSubscriptionMgt2 == nil {
+		return 0, ErrSubscriptionMgt2NotSupported
+	}
+	revisedKeepAliveTime, hr, err := es.eventSubscriptionMgt2.SetKeepAliveHRESULT(keepAliveTime)
+	if err != nil {
+		return 0, es.error("SetKeepAlive", "", err)
+	}
+	return revisedKeepAliveTime, successError("SetKeepAlive", "", hr)
+}
+
+// GetKeepAlive returns the keep-alive time in milliseconds
+func (es *OPCEventSubscription) GetKeepAlive() (uint32, error) {
+	if es.eventSubscriptionMgt2 == nil {
+		return 0, ErrSubscriptionMgt2NotSupported
+	}
+	keepAliveTime, err := es.eventSubscriptionMgt2.GetKeepAlive()
+	return keepAliveTime, es.error("GetKeepAlive", "", err)
+}
+
+// StartWatchdog reports a stall to notify when neither events nor keep-alive callbacks arrive
+// within multiple times the revised keep-alive time. SetKeepAlive must be called first.
+func (es *OPCEventSubscription) StartWatchdog(multiple uint32, notify chan<- *SubscriptionStall) error {
+	keepAlive, err := es.GetKeepAlive()
+	if err != nil {
+		return err
+	}
+	if keepAlive == 0 {
+		return errors.New("opcae: keep-alive is not enabled on the subscription")
+	}
+	watchdog := NewWatchdog(SystemClock, es.clientHandle, time.Duration(keepAlive)*time.Millisecond, multiple, notify)
+	if old := es.event.watchdog.Swap(watchdog); old != nil {
+		old.Stop()
+	}
+	watchdog.Start()
+	return nil
+}
+
+// StopWatchdog stops the watchdog started by StartWatchdog
+func (es *OPCEventSubscription) StopWatchdog() {
+	if old := es.event.watchdog.Swap(nil); old != nil {
+		old.Stop()
+	}
 }
 
+// GetReceiver returns the channel of the event notifications, it is closed by Release
 func (es *OPCEventSubscription) GetReceiver() <-chan *EventSinkOnEventData {
 	return es.receiver
 }
 
+// DeliveryStats returns the counters of the delivery into the receiver
+func (es *OPCEventSubscription) DeliveryStats() DeliveryStats {
+	return es.dispatcher.Stats()
+}
+
+func (es *OPCEventSubscription) error(op, item string, err error) error {
+	return newServerError(es.common, op, item, err)
+}
+
+// Release closes the subscription and its receiver, it waits for the Context calls in progress, the calls made
+// afterwards fail with CO_E_OBJNOTCONNECTED
 func (es *OPCEventSubscription) Release() error {
+	if !es.calls.release() {
+		return nil
+	}
+	es.StopWatchdog()
 	err := es.point.Unadvise(es.cookie)
+	es.dispatcher.Close()
 	es.point.Release()
 	es.container.Release()
+	if es.eventSubscriptionMgt2 != nil {
+		es.eventSubscriptionMgt2.Release()
+	}
 	return err
 }
+
+// GetStateContext is GetState with a context, see CallContext
+func (es *OPCEventSubscription) GetStateContext(ctx context.Context) (active bool, bufferTime uint32, maxSize uint32, clientSubscription uint32, err error) {
+	type state struct {
+		active                                  bool
+		bufferTime, maxSize, clientSubscription uint32
+	}
+	result, err := CallContext(ctx, es.timeout, tracked(&es.calls, "GetState", func() (state, error) {
+		var s state
+		var err error
+		s.active, s.bufferTime, s.maxSize, s.clientSubscription, err = es.GetState()
+		return s, err
+	}), nil)
+	return result.active, result.bufferTime, result.maxSize, result.clientSubscription, err
+}
+
+// GetFilterContext is GetFilter with a context, see CallContext
+func (es *OPCEventSubscription) GetFilterContext(ctx context.Context) (events []EventCategoryType, eventCategories []uint32, lowSeverity uint32, highSeverity uint32, areaList []string, sourceList []string, err error) {
+	f, err := CallContext(ctx, es.timeout, tracked(&es.calls, "GetFilter", func() (*SubscriptionFilter, error) {
+		var f SubscriptionFilter
+		var err error
+		f.EventTypes, f.Categories, f.LowSeverity, f.HighSeverity, f.Areas, f.Sources, err = es.GetFilter()
+		return &f, err
+	}), nil)
+	if f == nil {
+		return nil, nil, 0, 0, nil, nil, err
+	}
+	return f.EventTypes, f.Categories, f.LowSeverity, f.HighSeverity, f.Areas, f.Sources, err
+}
+
+// SetActiveContext is SetActive with a context, see CallContext, an abandoned call may still change the state
+func (es *OPCEventSubscription) SetActiveContext(ctx context.Context, active bool) error {
+	return callContextErr(ctx, es.timeout, trackedErr(&es.calls, "SetActive", func() error {
+		return es.SetActive(active)
+	}))
+}
+
+// SetBufferTimeContext is SetBufferTime with a context, see CallContext, an abandoned call may still change the buffer time
+func (es *OPCEventSubscription) SetBufferTimeContext(ctx context.Context, bufferTime uint32) (uint32, error) {
+	return CallContext(ctx, es.timeout, tracked(&es.calls, "SetBufferTime", func() (uint32, error) {
+		return es.SetBufferTime(bufferTime)
+	}), nil)
+}
+
+// SetMaxSizeContext is SetMaxSize with a context, see CallContext, an abandoned call may still change the maximum size
+func (es *OPCEventSubscription) SetMaxSizeContext(ctx context.Context, maxSize uint32) (uint32, error) {
+	return CallContext(ctx, es.timeout, tracked(&es.calls, "SetMaxSize", func() (uint32, error) {
+		return es.SetMaxSize(maxSize)
+	}), nil)
+}
+
+// SetFilterContext is SetFilter with a context, see CallContext, an abandoned call may still replace the filter
+func (es *OPCEventSubscription) SetFilterContext(ctx context.Context, events []EventCategoryType, eventCategories []uint32, lowSeverity uint32, highSeverity uint32, areaList []string, sourceList []string) error {
+	return callContextErr(ctx, es.timeout, trackedErr(&es.calls, "SetFilter", func() error {
+		return es.SetFilter(events, eventCategories, lowSeverity, highSeverity, areaList, sourceList)
+	}))
+}
+
+// SelectReturnedAttributesContext is SelectReturnedAttributes with a context, see CallContext, an abandoned call may still select the attributes
+func (es *OPCEventSubscription) SelectReturnedAttributesContext(ctx context.Context, eventCategory uint32, attributeIDs []uint32) error {
+	return callContextErr(ctx, es.timeout, trackedErr(&es.calls, "SelectReturnedAttributes", func() error {
+		return es.SelectReturnedAttributes(eventCategory, attributeIDs)
+	}))
+}
+
+// SelectReturnedAttributesByNameContext is SelectReturnedAttributesByName with a context, see CallContext, an abandoned call may still select the attributes
+func (es *OPCEventSubscription) SelectReturnedAttributesByNameContext(ctx context.Context, eventCategory uint32, names []string) error {
+	return callContextErr(ctx, es.timeout, trackedErr(&es.calls, "SelectReturnedAttributesByName", func() error {
+		return es.SelectReturnedAttributesByName(eventCategory, names)
+	}))
+}
+
+// GetReturnedAttributesContext is GetReturnedAttributes with a context, see CallContext
+func (es *OPCEventSubscription) GetReturnedAttributesContext(ctx context.Context, eventCategory uint32) ([]uint32, error) {
+	return CallContext(ctx, es.timeout, tracked(&es.calls, "GetReturnedAttributes", func() ([]uint32, error) {
+		return es.GetReturnedAttributes(eventCategory)
+	}), nil)
+}
+
+// RefreshContext is Refresh with a context, see CallContext, an abandoned call may still start the refresh, its events then arrive on the receiver
+func (es *OPCEventSubscription) RefreshContext(ctx context.Context) error {
+	return callContextErr(ctx, es.timeout, trackedErr(&es.calls, "Refresh", func() error {
+		return es.Refresh()
+	}))
+}
+
+// CancelRefreshContext is CancelRefresh with a context, see CallContext, an abandoned call may still cancel the refresh
+func (es *OPCEventSubscription) CancelRefreshContext(ctx context.Context) error {
+	return callContextErr(ctx, es.timeout, trackedErr(&es.calls, "CancelRefresh", func() error {
+		return es.CancelRefresh()
+	}))
+}
+
+// SetKeepAliveContext is SetKeepAlive with a context, see CallContext, an abandoned call may still change the keep-alive time
+func (es *OPCEventSubscription) SetKeepAliveContext(ctx context.Context, keepAliveTime uint32) (uint32, error) {
+	return CallContext(ctx, es.timeout, tracked(&es.calls, "SetKeepAlive", func() (uint32, error) {
+		return es.SetKeepAlive(keepAliveTime)
+	}), nil)
+}
+
+// GetKeepAliveContext is GetKeepAlive with a context, see CallContext
+func (es *OPCEventSubscription) GetKeepAliveContext(ctx context.Context) (uint32, error) {
+	return CallContext(ctx, es.timeout, tracked(&es.calls, "GetKeepAlive", func() (uint32, error) {
+		return es.GetKeepAlive()
+	}), nil)
+}
@@ -1,3 +1,5 @@
+//go:build windows
+
 package opcae
 
 import (
@@ -47,3 +49,26 @@ func TestSubscription(t *testing.T) {
 		t.Logf("%#v", event)
 	}
 }
+
+func TestOPCEventSubscription_SetKeepAlive(t *testing.T) {
+	eventServer, err := ConnectEventServer(TestProgID, TestHost)
+	if err != nil {
+		t.Fatalf("connect to opc event server failed: %s\n", err)
+	}
+	assert.NotNil(t, eventServer)
+	defer eventServer.Disconnect()
+	subscription, _, _, err := eventServer.CreateEventSubscription(true, 0, 0, 100)
+	assert.NoError(t, err)
+	defer subscription.Release()
+	revisedKeepAlive, err := subscription.SetKeepAlive(1000)
+	if err == ErrSubscriptionMgt2NotSupported {
+		t.Skip(err)
+	}
+	assert.NoError(t, err)
+	keepAlive, err := subscription.GetKeepAlive()
+	assert.NoError(t, err)
+	assert.Equal(t, revisedKeepAlive, keepAlive)
+	stall := make(chan *SubscriptionStall, 1)
+	err = subscription.StartWatchdog(3, stall)
+	assert.NoError(t, err)
+}
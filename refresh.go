@@ -0,0 +1,55 @@
+package opcae
+
+import (
+	"context"
+	"sync"
+)
+
+// refreshCollector gathers the events of the refresh callbacks until the one with LastRefresh set
+type refreshCollector struct {
+	lock   sync.Mutex
+	events []*OnEventStruct
+	done   chan struct{}
+}
+
+func (c *refreshCollector) add(data *EventSinkOnEventData) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.events = append(c.events, data.Events...)
+	if data.LastRefresh {
+		close(c.done)
+	}
+}
+
+func (c *refreshCollector) result() []*OnEventStruct {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.events
+}
+
+// RefreshAndWait calls refresh and returns the events of all refresh callbacks, the current state of every
+// condition that passes the filter. Live events that arrive in the meantime go to the receiver as usual.
+// When ctx is done cancelRefresh is called and the callbacks up to LastRefresh are discarded.
+// A refresh that is still being collected or discarded makes it fail with OPC_E_BUSY.
+func (d *Dispatcher) RefreshAndWait(ctx context.Context, refresh, cancelRefresh func() error) ([]*OnEventStruct, error) {
+	c := &refreshCollector{done: make(chan struct{})}
+	if !d.refresh.CompareAndSwap(nil, c) {
+		return nil, NewOPCError("Refresh", "", OPC_E_BUSY)
+	}
+	if err := refresh(); err != nil {
+		d.refresh.CompareAndSwap(c, nil)
+		return nil, err
+	}
+	select {
+	case <-c.done:
+		return c.result(), nil
+	case <-d.done:
+		return nil, ErrSubscriptionReleased
+	case <-ctx.Done():
+		if err := cancelRefresh(); err != nil {
+			// the refresh finished or the server does not send a last callback, stop diverting
+			d.refresh.CompareAndSwap(c, nil)
+		}
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,91 @@
+package opcae
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func refreshData(last bool, sources ...string) *EventSinkOnEventData {
+	data := &EventSinkOnEventData{Refresh: true, LastRefresh: last}
+	for _, source := range sources {
+		data.Events = append(data.Events, &OnEventStruct{Source: source})
+	}
+	return data
+}
+
+func TestDispatcher_RefreshAndWait(t *testing.T) {
+	receiver := make(chan *EventSinkOnEventData, 10)
+	d := NewDispatcher(receiver, DeliverBlock, 0)
+	defer d.Close()
+	refresh := func() error {
+		go func() {
+			d.Deliver(refreshData(false, "Tank1"))
+			d.Deliver(&EventSinkOnEventData{Events: []*OnEventStruct{{Source: "Live"}}})
+			d.Deliver(refreshData(true, "Tank2"))
+		}()
+		return nil
+	}
+	events, err := d.RefreshAndWait(context.Background(), refresh, nil)
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, "Tank1", events[0].Source)
+	assert.Equal(t, "Tank2", events[1].Source)
+	live := <-receiver
+	assert.Equal(t, "Live", live.Events[0].Source)
+	assert.Empty(t, receiver)
+
+	d.Deliver(refreshData(true))
+	assert.True(t, (<-receiver).LastRefresh, "refresh callbacks go to the receiver without RefreshAndWait")
+
+	refreshErr := errors.New("refresh failed")
+	_, err = d.RefreshAndWait(context.Background(), func() error { return refreshErr }, nil)
+	assert.Equal(t, refreshErr, err)
+}
+
+func TestDispatcher_RefreshAndWaitBusy(t *testing.T) {
+	d := NewDispatcher(make(chan *EventSinkOnEventData, 10), DeliverBlock, 0)
+	defer d.Close()
+	result := make(chan []*OnEventStruct)
+	go func() {
+		events, _ := d.RefreshAndWait(context.Background(), func() error { return nil }, nil)
+		result <- events
+	}()
+	assert.Eventually(t, func() bool {
+		_, err := d.RefreshAndWait(context.Background(), func() error { return nil }, nil)
+		return errors.Is(err, ErrBusy)
+	}, time.Second, time.Millisecond)
+	d.Deliver(refreshData(true, "Tank1"))
+	assert.Len(t, <-result, 1)
+}
+
+func TestDispatcher_RefreshAndWaitCancel(t *testing.T) {
+	receiver := make(chan *EventSinkOnEventData, 10)
+	d := NewDispatcher(receiver, DeliverBlock, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := 0
+	cancelRefresh := func() error {
+		cancelled++
+		return nil
+	}
+	refresh := func() error {
+		cancel()
+		return nil
+	}
+	_, err := d.RefreshAndWait(ctx, refresh, cancelRefresh)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 1, cancelled)
+	_, err = d.RefreshAndWait(context.Background(), refresh, cancelRefresh)
+	assert.True(t, errors.Is(err, ErrBusy), "busy until the last refresh callback arrived")
+
+	d.Deliver(refreshData(false, "Tank1"))
+	d.Deliver(refreshData(true))
+	assert.Empty(t, receiver, "the callbacks of a cancelled refresh are discarded")
+
+	go d.Close()
+	_, err = d.RefreshAndWait(context.Background(), func() error { return nil }, cancelRefresh)
+	assert.Equal(t, ErrSubscriptionReleased, err)
+}
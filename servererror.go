@@ -0,0 +1,43 @@
+//go:build windows
+
+package opcae
+
+import (
+	"strings"
+
+	"github.com/huskar-t/opcda/com"
+)
+
+// newServerError converts a failed HRESULT to an *OPCError carrying the server's description of it.
+// Errors that are not HRESULTs are returned unchanged, a nil error stays nil. The server is not asked
+// to describe codes that have a local name or that mean it is unreachable, see errorString.
+func newServerError(common *com.IOPCCommon, op, item string, err error) error {
+	err = wrapError(op, item, err)
+	if e, ok := err.(*OPCError); ok && e.Message == "" {
+		e.Message = errorString(common, e.Code)
+	}
+	return err
+}
+
+// newServerErrorCode converts a per-item HRESULT, success codes return nil
+func newServerErrorCode(common *com.IOPCCommon, op, item string, code int32) error {
+	if code >= 0 {
+		return nil
+	}
+	e := NewOPCError(op, item, uint32(code))
+	e.Message = errorString(common, e.Code)
+	return e
+}
+
+// errorString asks the server to describe code. Codes with a local name are described by OPCError.Error
+// and a server that lost the connection cannot answer, both are skipped to save the round trip.
+func errorString(common *com.IOPCCommon, code uint32) string {
+	if common == nil || CodeName(code) != "" || connectionLostCodes[code] {
+		return ""
+	}
+	message, err := common.GetErrorString(code)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(message)
+}
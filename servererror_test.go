@@ -0,0 +1,19 @@
+//go:build windows
+
+package opcae
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewServerError(t *testing.T) {
+	assert.NoError(t, newServerError(nil, "GetStatus", "", nil))
+	assert.Equal(t, syscall.EINVAL, newServerError(nil, "AckCondition", "", syscall.EINVAL))
+	err := newServerError(nil, "GetStatus", "", syscall.Errno(RPC_S_SERVER_UNAVAILABLE))
+	assert.ErrorIs(t, err, syscall.Errno(RPC_S_SERVER_UNAVAILABLE))
+	assert.NoError(t, newServerErrorCode(nil, "AckCondition", "Tank1", 0))
+	assert.Error(t, newServerErrorCode(nil, "AckCondition", "Tank1", -1))
+}
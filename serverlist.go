@@ -0,0 +1,142 @@
+//go:build windows
+
+package opcae
+
+import (
+	"unsafe"
+
+	"github.com/huskar-t/opcda/com"
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+var CATID_OPCEventServerCategory = windows.GUID{
+	Data1: 0x58E13251,
+	Data2: 0xAC87,
+	Data3: 0x11d1,
+	Data4: [8]byte{0x84, 0xD5, 0x00, 0x60, 0x8C, 0xB8, 0xA7, 0xE9},
+}
+
+// ListEventServers returns the OPC AE servers registered on node.
+// The servers are enumerated with OPCEnum, if OPCEnum is not available the registry of the node is searched instead.
+func ListEventServers(node string) ([]*ServerInfo, error) {
+	location := com.CLSCTX_LOCAL_SERVER
+	if !com.IsLocal(node) {
+		location = com.CLSCTX_REMOTE_SERVER
+	}
+	servers, err := listServersFromServerList(node, location)
+	if err != nil {
+		// try list servers from windows reg
+		return listServersFromReg(node)
+	}
+	return servers, nil
+}
+
+func listServersFromServerList(node string, location com.CLSCTX) ([]*ServerInfo, error) {
+	iCatInfo, err := com.MakeCOMObjectEx(node, location, &com.CLSID_OpcServerList, &com.IID_IOPCServerList2)
+	if err != nil {
+		return nil, err
+	}
+	defer iCatInfo.Release()
+	sl := &com.IOPCServerList2{IUnknown: iCatInfo}
+	iEnum, err := sl.EnumClassesOfCategories([]windows.GUID{CATID_OPCEventServerCategory}, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer iEnum.Release()
+	var result []*ServerInfo
+	for {
+		var classID windows.GUID
+		var actual uint32
+		err = iEnum.Next(1, &classID, &actual)
+		if err != nil || actual == 0 {
+			break
+		}
+		server, err := getServerFromServerList(sl, &classID)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, server)
+	}
+	return result, nil
+}
+
+func getServerFromServerList(sl *com.IOPCServerList2, classID *windows.GUID) (*ServerInfo, error) {
+	progID, userType, verIndProgID, err := sl.GetClassDetails(classID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		com.CoTaskMemFree(unsafe.Pointer(progID))
+		com.CoTaskMemFree(unsafe.Pointer(userType))
+		com.CoTaskMemFree(unsafe.Pointer(verIndProgID))
+	}()
+	return &ServerInfo{
+		ProgID:       windows.UTF16PtrToString(progID),
+		ClsStr:       classID.String(),
+		Description:  windows.UTF16PtrToString(userType),
+		VerIndProgID: windows.UTF16PtrToString(verIndProgID),
+		ClsID:        classID,
+	}, nil
+}
+
+func listServersFromReg(node string) ([]*ServerInfo, error) {
+	hKey, err := registry.OpenRemoteKey(node, registry.CLASSES_ROOT)
+	if err != nil {
+		return nil, err
+	}
+	defer hKey.Close()
+	hClsidKey, err := registry.OpenKey(hKey, "CLSID", registry.READ)
+	if err != nil {
+		return nil, err
+	}
+	defer hClsidKey.Close()
+	names, err := hClsidKey.ReadSubKeyNames(-1)
+	if err != nil {
+		return nil, err
+	}
+	category := `Implemented Categories\` + CATID_OPCEventServerCategory.String()
+	var result []*ServerInfo
+	for _, name := range names {
+		server, ok := getServerFromReg(hClsidKey, name, category)
+		if ok {
+			result = append(result, server)
+		}
+	}
+	return result, nil
+}
+
+func getServerFromReg(hClsidKey registry.Key, clsStr, category string) (*ServerInfo, bool) {
+	classID, err := windows.GUIDFromString(clsStr)
+	if err != nil {
+		return nil, false
+	}
+	hServerKey, err := registry.OpenKey(hClsidKey, clsStr, registry.READ)
+	if err != nil {
+		return nil, false
+	}
+	defer hServerKey.Close()
+	hCategoryKey, err := registry.OpenKey(hServerKey, category, registry.READ)
+	if err != nil {
+		return nil, false
+	}
+	hCategoryKey.Close()
+	description, _, _ := hServerKey.GetStringValue("")
+	return &ServerInfo{
+		ProgID:       readDefaultValue(hServerKey, "ProgID"),
+		ClsStr:       classID.String(),
+		Description:  description,
+		VerIndProgID: readDefaultValue(hServerKey, "VersionIndependentProgID"),
+		ClsID:        &classID,
+	}, true
+}
+
+func readDefaultValue(k registry.Key, path string) string {
+	hKey, err := registry.OpenKey(k, path, registry.READ)
+	if err != nil {
+		return ""
+	}
+	defer hKey.Close()
+	value, _, _ := hKey.GetStringValue("")
+	return value
+}
@@ -0,0 +1,77 @@
+//go:build windows
+
+package opcae
+
+import (
+	"syscall"
+	"unsafe"
+
+	"github.com/huskar-t/opcda/com"
+	"golang.org/x/sys/windows"
+)
+
+var IID_IOPCShutdown = windows.GUID{
+	Data1: 0xF31DFDE1,
+	Data2: 0x07B6,
+	Data3: 0x11D2,
+	Data4: [8]byte{0xB2, 0xD8, 0x00, 0x60, 0x08, 0x3B, 0xA1, 0xFB},
+}
+
+type IOPCShutdownSink struct {
+	lpVtbl *IOPCShutdownSinkVtbl
+	ref    int32
+	clsid  *windows.GUID
+	status *connectionStatus
+}
+
+type IOPCShutdownSinkVtbl struct {
+	pQueryInterface  uintptr
+	pAddRef          uintptr
+	pRelease         uintptr
+	pShutdownRequest uintptr
+}
+
+func newShutdownSink(status *connectionStatus) *IOPCShutdownSink {
+	return &IOPCShutdownSink{
+		lpVtbl: &IOPCShutdownSinkVtbl{
+			pQueryInterface:  syscall.NewCallback(ShutdownSinkQueryInterface),
+			pAddRef:          syscall.NewCallback(ShutdownSinkAddRef),
+			pRelease:         syscall.NewCallback(ShutdownSinkRelease),
+			pShutdownRequest: syscall.NewCallback(ShutdownSinkShutdownRequest),
+		},
+		ref:    0,
+		clsid:  &IID_IOPCShutdown,
+		status: status,
+	}
+}
+
+func ShutdownSinkQueryInterface(this unsafe.Pointer, iid *windows.GUID, punk *unsafe.Pointer) uintptr {
+	er := (*IOPCShutdownSink)(this)
+	*punk = nil
+	if com.IsEqualGUID(iid, er.clsid) || com.IsEqualGUID(iid, com.IID_IUnknown) {
+		ShutdownSinkAddRef(this)
+		*punk = this
+		return com.S_OK
+	}
+	return com.E_POINTER
+}
+
+func ShutdownSinkAddRef(this unsafe.Pointer) uintptr {
+	er := (*IOPCShutdownSink)(this)
+	er.ref++
+	return uintptr(er.ref)
+}
+
+func ShutdownSinkRelease(this unsafe.Pointer) uintptr {
+	er := (*IOPCShutdownSink)(this)
+	er.ref--
+	return uintptr(er.ref)
+}
+
+// virtual HRESULT STDMETHODCALLTYPE ShutdownRequest(
+// /* [string][in] */ LPCWSTR szReason) = 0;
+func ShutdownSinkShutdownRequest(this *com.IUnknown, reason *uint16) uintptr {
+	er := (*IOPCShutdownSink)(unsafe.Pointer(this))
+	er.status.Shutdown(windows.UTF16PtrToString(reason))
+	return uintptr(com.S_OK)
+}
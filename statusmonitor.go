@@ -0,0 +1,176 @@
+package opcae
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ServerHealth is a sample of the status of the server taken by a StatusMonitor
+type ServerHealth struct {
+	// State is 0, printed as UNKNOWN, when GetStatus failed
+	State ServerState
+	// Uptime is the time since the server started, measured on the server clock
+	Uptime time.Duration
+	// Staleness is the time since the server last sent a notification to any client, measured on the server
+	// clock. It equals Uptime while the server has not sent a notification yet.
+	Staleness time.Duration
+	// ClockOffset is the server clock minus the local clock, estimated in the middle of the GetStatus call
+	ClockOffset time.Duration
+	// Status is the result of GetStatus, nil when Err is set
+	Status *EventServerStatus
+	Err    error
+	// Time is the local time the sample was taken
+	Time time.Time
+}
+
+// ServerStateChange is sent to the channels registered with StatusMonitor.Notify when the state of the server changes
+type ServerStateChange struct {
+	Old    ServerState
+	New    ServerState
+	Health ServerHealth
+}
+
+// StatusMonitor polls GetStatus of a server and publishes the changes of the server state.
+// The first sample is published as a change from UNKNOWN.
+type StatusMonitor struct {
+	clock    Clock
+	server   EventServer
+	interval time.Duration
+
+	lock      sync.Mutex
+	health    ServerHealth
+	receivers []chan<- ServerStateChange
+	stop      chan struct{}
+	started   bool
+	stopOnce  sync.Once
+	stopped   chan struct{}
+}
+
+// DefaultMonitorInterval is the polling interval of a StatusMonitor without WithMonitorInterval
+const DefaultMonitorInterval = 10 * time.Second
+
+type MonitorOption func(*monitorOptions)
+
+type monitorOptions struct {
+	clock    Clock
+	interval time.Duration
+}
+
+// WithMonitorClock replaces the clock of the polling interval and of the samples
+func WithMonitorClock(clock Clock) MonitorOption {
+	return func(o *monitorOptions) {
+		o.clock = clock
+	}
+}
+
+// WithMonitorInterval sets how often Start polls the server, a GetStatus call that takes longer fails the sample.
+// Intervals that are not positive keep DefaultMonitorInterval.
+func WithMonitorInterval(interval time.Duration) MonitorOption {
+	return func(o *monitorOptions) {
+		if interval > 0 {
+			o.interval = interval
+		}
+	}
+}
+
+// NewStatusMonitor returns a StatusMonitor of server, it polls every DefaultMonitorInterval on the SystemClock
+// unless the options say otherwise. Polling begins with Start.
+func NewStatusMonitor(server EventServer, opts ...MonitorOption) *StatusMonitor {
+	o := monitorOptions{clock: SystemClock, interval: DefaultMonitorInterval}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &StatusMonitor{
+		clock:    o.clock,
+		server:   server,
+		interval: o.interval,
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+}
+
+// Notify registers ch for the state changes. Changes are sent without blocking, they are dropped when ch is full.
+func (m *StatusMonitor) Notify(ch chan<- ServerStateChange) {
+	m.lock.Lock()
+	m.receivers = append(m.receivers, ch)
+	m.lock.Unlock()
+}
+
+// Start polls the server every interval until Stop is called, the first poll is made at once
+func (m *StatusMonitor) Start() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.started {
+		return
+	}
+	m.started = true
+	go func() {
+		defer close(m.stopped)
+		for {
+			m.Poll()
+			select {
+			case <-m.stop:
+				return
+			case <-m.clock.After(m.interval):
+			}
+		}
+	}()
+}
+
+// Stop stops the polling started by Start and waits for a running poll
+func (m *StatusMonitor) Stop() {
+	m.stopOnce.Do(func() {
+		close(m.stop)
+	})
+	m.lock.Lock()
+	started := m.started
+	m.lock.Unlock()
+	if started {
+		<-m.stopped
+	}
+}
+
+// Poll takes a sample and publishes the state change, if any. A GetStatus call that takes longer than the
+// interval fails the sample.
+func (m *StatusMonitor) Poll() ServerHealth {
+	ctx, cancel := context.WithTimeout(context.Background(), m.interval)
+	defer cancel()
+	before := m.clock.Now()
+	status, err := m.server.GetStatusContext(ctx)
+	after := m.clock.Now()
+	health := ServerHealth{Status: status, Err: err, Time: after}
+	if err == nil {
+		health.State = status.ServerState
+		health.Uptime = status.CurrentTime.Sub(status.StartTime)
+		lastUpdate := status.LastUpdateTime
+		// a server that sent nothing reports a zero FILETIME, some report its 1601 epoch
+		if lastUpdate.Before(status.StartTime) {
+			lastUpdate = status.StartTime
+		}
+		health.Staleness = status.CurrentTime.Sub(lastUpdate)
+		health.ClockOffset = status.CurrentTime.Sub(before.Add(after.Sub(before) / 2))
+	}
+	m.lock.Lock()
+	old := m.health.State
+	m.health = health
+	receivers := m.receivers
+	m.lock.Unlock()
+	if old != health.State {
+		change := ServerStateChange{Old: old, New: health.State, Health: health}
+		for _, ch := range receivers {
+			select {
+			case ch <- change:
+			default:
+			}
+		}
+	}
+	return health
+}
+
+// Health returns the last sample, the zero value before the first poll
+func (m *StatusMonitor) Health() ServerHealth {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.health
+}
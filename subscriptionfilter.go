@@ -0,0 +1,299 @@
+package opcae
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// MinSeverity and MaxSeverity bound the severity of an event
+	MinSeverity = 1
+	MaxSeverity = 1000
+)
+
+// SubscriptionFilter is the server-side filter of a subscription, see SetFilter.
+// Empty lists do not restrict the events, an empty EventTypes selects OPC_ALL_EVENTS and a severity of 0
+// stands for MinSeverity and MaxSeverity respectively, so the zero value passes every event.
+// The struct tags let filters be kept in JSON and YAML configuration files, event types are written by name.
+type SubscriptionFilter struct {
+	EventTypes   []EventCategoryType `json:"eventTypes,omitempty" yaml:"eventTypes,omitempty"`
+	Categories   []uint32            `json:"categories,omitempty" yaml:"categories,omitempty"`
+	LowSeverity  uint32              `json:"lowSeverity,omitempty" yaml:"lowSeverity,omitempty"`
+	HighSeverity uint32              `json:"highSeverity,omitempty" yaml:"highSeverity,omitempty"`
+	Areas        []string            `json:"areas,omitempty" yaml:"areas,omitempty"`
+	Sources      []string            `json:"sources,omitempty" yaml:"sources,omitempty"`
+}
+
+// InvalidFilterError describes a problem of a SubscriptionFilter found by Validate
+type InvalidFilterError struct {
+	Field  string
+	Reason string
+}
+
+func (e *InvalidFilterError) Error() string {
+	return fmt.Sprintf("opcae: invalid subscription filter: %s: %s", e.Field, e.Reason)
+}
+
+// NewSubscriptionFilter returns a filter that passes every event
+func NewSubscriptionFilter() *SubscriptionFilter {
+	return &SubscriptionFilter{}
+}
+
+// WithEventTypes restricts the event types
+func (f *SubscriptionFilter) WithEventTypes(types ...EventCategoryType) *SubscriptionFilter {
+	f.EventTypes = types
+	return f
+}
+
+// WithCategories restricts the event category IDs
+func (f *SubscriptionFilter) WithCategories(ids ...uint32) *SubscriptionFilter {
+	f.Categories = ids
+	return f
+}
+
+// WithSeverity restricts the severity to the band from low to high
+func (f *SubscriptionFilter) WithSeverity(low, high uint32) *SubscriptionFilter {
+	f.LowSeverity, f.HighSeverity = low, high
+	return f
+}
+
+// WithAreas restricts the areas, the names may contain the wildcards of the server
+func (f *SubscriptionFilter) WithAreas(areas ...string) *SubscriptionFilter {
+	f.Areas = areas
+	return f
+}
+
+// WithSources restricts the sources, the names may contain the wildcards of the server
+func (f *SubscriptionFilter) WithSources(sources ...string) *SubscriptionFilter {
+	f.Sources = sources
+	return f
+}
+
+// eventMask returns the event types as the dwEventType bit mask
+func (f *SubscriptionFilter) eventMask() uint32 {
+	if len(f.EventTypes) == 0 {
+		return uint32(OPC_ALL_EVENTS)
+	}
+	return MarshalEventCategoryType(f.EventTypes)
+}
+
+// severity returns the severity band with the defaults applied
+func (f *SubscriptionFilter) severity() (uint32, uint32) {
+	low, high := f.LowSeverity, f.HighSeverity
+	if low == 0 {
+		low = MinSeverity
+	}
+	if high == 0 {
+		high = MaxSeverity
+	}
+	return low, high
+}
+
+// Validate checks the filter against the filter kinds and the event categories of the server, pass the
+// results of QueryAvailableFilters and QueryEventCategories. A nil categories skips the check of the IDs.
+// All problems are returned joined, each one is an *InvalidFilterError.
+func (f *SubscriptionFilter) Validate(available []Filter, categories []*EventCategory) error {
+	var errs []error
+	invalid := func(field, format string, args ...interface{}) {
+		errs = append(errs, &InvalidFilterError{Field: field, Reason: fmt.Sprintf(format, args...)})
+	}
+	supported := MarshalFilter(available)
+	unsupported := func(field string, kind Filter) {
+		if supported&uint32(kind) == 0 {
+			invalid(field, "the server does not support filtering by %s", kind)
+		}
+	}
+	mask := f.eventMask()
+	if mask&^uint32(OPC_ALL_EVENTS) != 0 {
+		invalid("eventTypes", "unknown event type 0x%x", mask&^uint32(OPC_ALL_EVENTS))
+	} else if mask != uint32(OPC_ALL_EVENTS) {
+		unsupported("eventTypes", OPC_FILTER_BY_EVENT)
+	}
+	if len(f.Categories) != 0 {
+		unsupported("categories", OPC_FILTER_BY_CATEGORY)
+		if categories != nil {
+			known := make(map[uint32]bool, len(categories))
+			for _, c := range categories {
+				known[c.ID] = true
+			}
+			for _, id := range f.Categories {
+				if !known[id] {
+					invalid("categories", "unknown event category %d for event types %s", id, eventTypeNames(mask))
+				}
+			}
+		}
+	}
+	low, high := f.severity()
+	switch {
+	case low > MaxSeverity || high > MaxSeverity:
+		invalid("severity", "severity band %d-%d exceeds %d", low, high, MaxSeverity)
+	case low > high:
+		invalid("severity", "low severity %d is above high severity %d", low, high)
+	case low != MinSeverity || high != MaxSeverity:
+		unsupported("severity", OPC_FILTER_BY_SEVERITY)
+	}
+	if len(f.Areas) != 0 {
+		unsupported("areas", OPC_FILTER_BY_AREA)
+		if containsEmpty(f.Areas) {
+			invalid("areas", "empty area name")
+		}
+	}
+	if len(f.Sources) != 0 {
+		unsupported("sources", OPC_FILTER_BY_SOURCE)
+		if containsEmpty(f.Sources) {
+			invalid("sources", "empty source name")
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func containsEmpty(names []string) bool {
+	for _, name := range names {
+		if name == "" {
+			return true
+		}
+	}
+	return false
+}
+
+func eventTypeNames(mask uint32) string {
+	var names []string
+	for _, t := range []EventCategoryType{OPC_SIMPLE_EVENT, OPC_TRACKING_EVENT, OPC_CONDITION_EVENT} {
+		if mask&uint32(t) != 0 {
+			names = append(names, t.String())
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// ValidateFor queries the filter kinds and the event categories of server and calls Validate
+func (f *SubscriptionFilter) ValidateFor(server EventServer) error {
+	available, err := server.QueryAvailableFilters()
+	if err != nil {
+		return err
+	}
+	var categories []*EventCategory
+	if len(f.Categories) != 0 {
+		categories, err = server.QueryEventCategories(UnmarshalEventCategoryType(f.eventMask() & uint32(OPC_ALL_EVENTS)))
+		if err != nil {
+			return err
+		}
+	}
+	return f.Validate(available, categories)
+}
+
+// Apply sets the filter on sub
+func (f *SubscriptionFilter) Apply(sub EventSubscription) error {
+	low, high := f.severity()
+	return sub.SetFilter(UnmarshalEventCategoryType(f.eventMask()), f.Categories, low, high, f.Areas, f.Sources)
+}
+
+// GetSubscriptionFilter returns the filter of sub in the normalized form
+func GetSubscriptionFilter(sub EventSubscription) (*SubscriptionFilter, error) {
+	events, categories, low, high, areas, sources, err := sub.GetFilter()
+	if err != nil {
+		return nil, err
+	}
+	f := &SubscriptionFilter{
+		EventTypes:   []EventCategoryType{EventCategoryType(MarshalEventCategoryType(events))},
+		Categories:   categories,
+		LowSeverity:  low,
+		HighSeverity: high,
+		Areas:        areas,
+		Sources:      sources,
+	}
+	return f.Normalize(), nil
+}
+
+// Normalize returns a copy with the defaults applied and the lists sorted without duplicates, event types
+// are reduced to OPC_ALL_EVENTS when all of them are selected
+func (f *SubscriptionFilter) Normalize() *SubscriptionFilter {
+	low, high := f.severity()
+	n := &SubscriptionFilter{
+		Categories:   uniqueSorted(f.Categories, func(a, b uint32) bool { return a < b }),
+		LowSeverity:  low,
+		HighSeverity: high,
+		Areas:        uniqueSorted(f.Areas, func(a, b string) bool { return a < b }),
+		Sources:      uniqueSorted(f.Sources, func(a, b string) bool { return a < b }),
+	}
+	mask := f.eventMask()
+	if mask&uint32(OPC_ALL_EVENTS) == uint32(OPC_ALL_EVENTS) {
+		n.EventTypes = []EventCategoryType{OPC_ALL_EVENTS}
+	} else {
+		for _, t := range []EventCategoryType{OPC_SIMPLE_EVENT, OPC_TRACKING_EVENT, OPC_CONDITION_EVENT} {
+			if mask&uint32(t) != 0 {
+				n.EventTypes = append(n.EventTypes, t)
+			}
+		}
+	}
+	return n
+}
+
+func uniqueSorted[T comparable](values []T, less func(a, b T) bool) []T {
+	if len(values) == 0 {
+		return nil
+	}
+	result := append([]T(nil), values...)
+	sort.Slice(result, func(i, j int) bool { return less(result[i], result[j]) })
+	n := 1
+	for _, v := range result[1:] {
+		if v != result[n-1] {
+			result[n] = v
+			n++
+		}
+	}
+	return result[:n]
+}
+
+// Equal reports whether both filters select the same events, the order of the lists does not matter
+func (f *SubscriptionFilter) Equal(other *SubscriptionFilter) bool {
+	return len(f.Diff(other)) == 0
+}
+
+// Diff describes how other differs from f, one line per field, e.g. "areas: +Plant.Area2 -Plant.Area1"
+func (f *SubscriptionFilter) Diff(other *SubscriptionFilter) []string {
+	a, b := f.Normalize(), other.Normalize()
+	var diff []string
+	if d := diffList(a.EventTypes, b.EventTypes); d != "" {
+		diff = append(diff, "eventTypes:"+d)
+	}
+	if d := diffList(a.Categories, b.Categories); d != "" {
+		diff = append(diff, "categories:"+d)
+	}
+	if a.LowSeverity != b.LowSeverity || a.HighSeverity != b.HighSeverity {
+		diff = append(diff, fmt.Sprintf("severity: %d-%d -> %d-%d", a.LowSeverity, a.HighSeverity, b.LowSeverity, b.HighSeverity))
+	}
+	if d := diffList(a.Areas, b.Areas); d != "" {
+		diff = append(diff, "areas:"+d)
+	}
+	if d := diffList(a.Sources, b.Sources); d != "" {
+		diff = append(diff, "sources:"+d)
+	}
+	return diff
+}
+
+// diffList lists the values added to and removed from the sorted list a to get the sorted list b
+func diffList[T comparable](a, b []T) string {
+	in := func(values []T, v T) bool {
+		for _, x := range values {
+			if x == v {
+				return true
+			}
+		}
+		return false
+	}
+	var d strings.Builder
+	for _, v := range b {
+		if !in(a, v) {
+			fmt.Fprintf(&d, " +%v", v)
+		}
+	}
+	for _, v := range a {
+		if !in(b, v) {
+			fmt.Fprintf(&d, " -%v", v)
+		}
+	}
+	return d.String()
+}
@@ -0,0 +1,78 @@
+package opcae
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestSubscriptionFilter_Validate(t *testing.T) {
+	all := ParseFilter(0x1F)
+	categories := []*EventCategory{{ID: 1, Description: "Level"}, {ID: 2, Description: "Deviation"}}
+	assert.NoError(t, NewSubscriptionFilter().Validate(nil, nil), "the zero value needs no filter support")
+	f := NewSubscriptionFilter().
+		WithEventTypes(OPC_CONDITION_EVENT).
+		WithCategories(1, 2).
+		WithSeverity(500, 1000).
+		WithAreas("Plant.Area1").
+		WithSources("*.Tank?")
+	assert.NoError(t, f.Validate(all, categories))
+
+	err := f.Validate([]Filter{OPC_FILTER_BY_EVENT, OPC_FILTER_BY_SEVERITY}, categories)
+	var invalid *InvalidFilterError
+	assert.True(t, errors.As(err, &invalid))
+	assert.EqualError(t, err, "opcae: invalid subscription filter: categories: the server does not support filtering by category\n"+
+		"opcae: invalid subscription filter: areas: the server does not support filtering by area\n"+
+		"opcae: invalid subscription filter: sources: the server does not support filtering by source")
+
+	err = NewSubscriptionFilter().WithCategories(3).WithSeverity(800, 700).Validate(all, categories)
+	assert.EqualError(t, err, "opcae: invalid subscription filter: categories: unknown event category 3 for event types simple, tracking, condition\n"+
+		"opcae: invalid subscription filter: severity: low severity 800 is above high severity 700")
+	assert.Error(t, NewSubscriptionFilter().WithSeverity(0, 1001).Validate(all, nil))
+	assert.Error(t, NewSubscriptionFilter().WithEventTypes(8).Validate(all, nil))
+	assert.Error(t, NewSubscriptionFilter().WithAreas("").Validate(all, nil))
+}
+
+func TestSubscriptionFilter_Diff(t *testing.T) {
+	a := NewSubscriptionFilter().WithAreas("B", "A", "A").WithEventTypes(OPC_SIMPLE_EVENT, OPC_TRACKING_EVENT, OPC_CONDITION_EVENT)
+	b := NewSubscriptionFilter().WithAreas("A", "B").WithSeverity(1, 1000)
+	assert.True(t, a.Equal(b))
+	assert.Equal(t, &SubscriptionFilter{
+		EventTypes:   []EventCategoryType{OPC_ALL_EVENTS},
+		LowSeverity:  1,
+		HighSeverity: 1000,
+		Areas:        []string{"A", "B"},
+	}, a.Normalize())
+
+	c := NewSubscriptionFilter().WithAreas("A", "C").WithSeverity(500, 0).WithEventTypes(OPC_CONDITION_EVENT).WithCategories(4)
+	assert.False(t, a.Equal(c))
+	assert.Equal(t, []string{
+		"eventTypes: +condition -all",
+		"categories: +4",
+		"severity: 1-1000 -> 500-1000",
+		"areas: +C -B",
+	}, a.Diff(c))
+}
+
+func TestSubscriptionFilter_Encoding(t *testing.T) {
+	f := NewSubscriptionFilter().WithEventTypes(OPC_CONDITION_EVENT, OPC_TRACKING_EVENT).WithCategories(1).WithSeverity(500, 0).WithSources("Tank1")
+	data, err := json.Marshal(f)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"eventTypes":["condition","tracking"],"categories":[1],"lowSeverity":500,"sources":["Tank1"]}`, string(data))
+	var decoded SubscriptionFilter
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, f, &decoded)
+
+	data, err = yaml.Marshal(f)
+	assert.NoError(t, err)
+	decoded = SubscriptionFilter{}
+	assert.NoError(t, yaml.Unmarshal(data, &decoded))
+	assert.Equal(t, f, &decoded)
+
+	assert.NoError(t, yaml.Unmarshal([]byte("eventTypes: [all]\nareas:\n  - Plant.Area1\n"), &decoded))
+	assert.Equal(t, []EventCategoryType{OPC_ALL_EVENTS}, decoded.EventTypes)
+	assert.Error(t, json.Unmarshal([]byte(`{"eventTypes":["alarm"]}`), &decoded))
+}
@@ -0,0 +1,204 @@
+package opcae
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// SubscriptionSpec is the configuration of a subscription. It is captured from a live subscription with
+// GetSubscriptionSpec, can be kept as JSON or YAML and creates an identical subscription with Create.
+type SubscriptionSpec struct {
+	Active     bool   `json:"active" yaml:"active"`
+	BufferTime uint32 `json:"bufferTime" yaml:"bufferTime"`
+	MaxSize    uint32 `json:"maxSize" yaml:"maxSize"`
+	// KeepAlive is 0 when keep-alive callbacks are disabled or the server does not support them
+	KeepAlive uint32 `json:"keepAlive,omitempty" yaml:"keepAlive,omitempty"`
+	// Filter is nil when the subscription passes every event
+	Filter *SubscriptionFilter `json:"filter,omitempty" yaml:"filter,omitempty"`
+	// ReturnedAttributes maps event category IDs to the attribute IDs the events return, in their order
+	ReturnedAttributes map[uint32][]uint32 `json:"returnedAttributes,omitempty" yaml:"returnedAttributes,omitempty"`
+}
+
+// SpecRevision is a value of a SubscriptionSpec the server revised
+type SpecRevision struct {
+	Field     string
+	Requested uint32
+	Revised   uint32
+}
+
+func (r SpecRevision) String() string {
+	return fmt.Sprintf("%s: requested %d, revised %d", r.Field, r.Requested, r.Revised)
+}
+
+func appendRevision(revisions []SpecRevision, field string, requested, revised uint32) []SpecRevision {
+	if requested == revised {
+		return revisions
+	}
+	return append(revisions, SpecRevision{Field: field, Requested: requested, Revised: revised})
+}
+
+// GetSubscriptionSpec captures the configuration of sub, server is the server sub was created on and is
+// asked for the event categories whose returned attributes are captured
+func GetSubscriptionSpec(server EventServer, sub EventSubscription) (*SubscriptionSpec, error) {
+	active, bufferTime, maxSize, _, err := sub.GetState()
+	if err != nil {
+		return nil, err
+	}
+	keepAlive, err := sub.GetKeepAlive()
+	if err != nil && !errors.Is(err, ErrSubscriptionMgt2NotSupported) {
+		return nil, err
+	}
+	filter, err := GetSubscriptionFilter(sub)
+	if err != nil {
+		return nil, err
+	}
+	categories, err := server.QueryEventCategories([]EventCategoryType{OPC_ALL_EVENTS})
+	if err != nil {
+		return nil, err
+	}
+	spec := &SubscriptionSpec{
+		Active:     active,
+		BufferTime: bufferTime,
+		MaxSize:    maxSize,
+		KeepAlive:  keepAlive,
+		Filter:     filter,
+	}
+	for _, category := range categories {
+		ids, err := sub.GetReturnedAttributes(category.ID)
+		if err != nil {
+			return nil, err
+		}
+		if len(ids) == 0 {
+			continue
+		}
+		if spec.ReturnedAttributes == nil {
+			spec.ReturnedAttributes = make(map[uint32][]uint32)
+		}
+		spec.ReturnedAttributes[category.ID] = ids
+	}
+	return spec, nil
+}
+
+// Create creates a subscription with the spec on server, receiverBufSize and opts are passed to
+// CreateEventSubscription. The subscription is created inactive and activated once it is configured, so no
+// event escapes the filter. The values the server revised are returned, on error the subscription is released.
+func (s *SubscriptionSpec) Create(server EventServer, receiverBufSize uint32, opts ...SubscriptionOption) (EventSubscription, []SpecRevision, error) {
+	sub, bufferTime, maxSize, err := server.CreateEventSubscription(false, s.BufferTime, s.MaxSize, receiverBufSize, opts...)
+	if !Succeeded(err) {
+		return nil, nil, err
+	}
+	revisions := appendRevision(nil, "bufferTime", s.BufferTime, bufferTime)
+	revisions = appendRevision(revisions, "maxSize", s.MaxSize, maxSize)
+	revisions, err = s.configure(sub, revisions)
+	if err != nil {
+		sub.Release()
+		return nil, nil, err
+	}
+	return sub, revisions, nil
+}
+
+// Apply configures sub with the spec and returns the values the server revised. The returned attributes of
+// categories missing from ReturnedAttributes are left unchanged.
+func (s *SubscriptionSpec) Apply(sub EventSubscription) ([]SpecRevision, error) {
+	bufferTime, err := sub.SetBufferTime(s.BufferTime)
+	if !Succeeded(err) {
+		return nil, err
+	}
+	maxSize, err := sub.SetMaxSize(s.MaxSize)
+	if !Succeeded(err) {
+		return nil, err
+	}
+	revisions := appendRevision(nil, "bufferTime", s.BufferTime, bufferTime)
+	revisions = appendRevision(revisions, "maxSize", s.MaxSize, maxSize)
+	return s.configure(sub, revisions)
+}
+
+func (s *SubscriptionSpec) configure(sub EventSubscription, revisions []SpecRevision) ([]SpecRevision, error) {
+	if err := s.filter().Apply(sub); err != nil {
+		return nil, err
+	}
+	for _, category := range s.categories() {
+		if err := sub.SelectReturnedAttributes(category, s.ReturnedAttributes[category]); err != nil {
+			return nil, err
+		}
+	}
+	keepAlive, err := sub.SetKeepAlive(s.KeepAlive)
+	switch {
+	case errors.Is(err, ErrSubscriptionMgt2NotSupported):
+		// servers without keep-alive support behave as if it was disabled
+		revisions = appendRevision(revisions, "keepAlive", s.KeepAlive, 0)
+	case !Succeeded(err):
+		return nil, err
+	default:
+		revisions = appendRevision(revisions, "keepAlive", s.KeepAlive, keepAlive)
+	}
+	if err := sub.SetActive(s.Active); err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+func (s *SubscriptionSpec) filter() *SubscriptionFilter {
+	if s.Filter == nil {
+		return NewSubscriptionFilter()
+	}
+	return s.Filter
+}
+
+// categories returns the categories of ReturnedAttributes in ascending order
+func (s *SubscriptionSpec) categories() []uint32 {
+	categories := make([]uint32, 0, len(s.ReturnedAttributes))
+	for category := range s.ReturnedAttributes {
+		categories = append(categories, category)
+	}
+	sort.Slice(categories, func(i, j int) bool { return categories[i] < categories[j] })
+	return categories
+}
+
+// Equal reports whether both specs configure the same subscription
+func (s *SubscriptionSpec) Equal(other *SubscriptionSpec) bool {
+	return len(s.Diff(other)) == 0
+}
+
+// Diff describes how other differs from s, one line per field, e.g. "bufferTime: 100 -> 500".
+// The lines of the filter are prefixed with "filter.", categories without returned attributes are ignored.
+func (s *SubscriptionSpec) Diff(other *SubscriptionSpec) []string {
+	var diff []string
+	if s.Active != other.Active {
+		diff = append(diff, fmt.Sprintf("active: %t -> %t", s.Active, other.Active))
+	}
+	if s.BufferTime != other.BufferTime {
+		diff = append(diff, fmt.Sprintf("bufferTime: %d -> %d", s.BufferTime, other.BufferTime))
+	}
+	if s.MaxSize != other.MaxSize {
+		diff = append(diff, fmt.Sprintf("maxSize: %d -> %d", s.MaxSize, other.MaxSize))
+	}
+	if s.KeepAlive != other.KeepAlive {
+		diff = append(diff, fmt.Sprintf("keepAlive: %d -> %d", s.KeepAlive, other.KeepAlive))
+	}
+	for _, d := range s.filter().Diff(other.filter()) {
+		diff = append(diff, "filter."+d)
+	}
+	categories := uniqueSorted(append(s.categories(), other.categories()...), func(a, b uint32) bool { return a < b })
+	for _, category := range categories {
+		a, b := s.ReturnedAttributes[category], other.ReturnedAttributes[category]
+		if !equalIDs(a, b) {
+			diff = append(diff, fmt.Sprintf("returnedAttributes[%d]: %v -> %v", category, a, b))
+		}
+	}
+	return diff
+}
+
+// equalIDs compares the attribute IDs including their order, which decides their position in the events
+func equalIDs(a, b []uint32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,92 @@
+package opcae
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func TestSubscriptionSpec_Encoding(t *testing.T) {
+	spec := &SubscriptionSpec{
+		Active:             true,
+		BufferTime:         500,
+		KeepAlive:          10000,
+		Filter:             NewSubscriptionFilter().WithEventTypes(OPC_CONDITION_EVENT).WithAreas("Plant.Area1"),
+		ReturnedAttributes: map[uint32][]uint32{100: {2, 1}},
+	}
+	data, err := json.Marshal(spec)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"active":true,"bufferTime":500,"maxSize":0,"keepAlive":10000,
+		"filter":{"eventTypes":["condition"],"areas":["Plant.Area1"]},"returnedAttributes":{"100":[2,1]}}`, string(data))
+	var decoded SubscriptionSpec
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, spec, &decoded)
+
+	data, err = yaml.Marshal(spec)
+	assert.NoError(t, err)
+	decoded = SubscriptionSpec{}
+	assert.NoError(t, yaml.Unmarshal(data, &decoded))
+	assert.Equal(t, spec, &decoded)
+}
+
+func TestSubscriptionSpec_Diff(t *testing.T) {
+	a := &SubscriptionSpec{BufferTime: 100, ReturnedAttributes: map[uint32][]uint32{100: {1, 2}, 200: {}}}
+	b := &SubscriptionSpec{
+		Active:             true,
+		BufferTime:         100,
+		Filter:             &SubscriptionFilter{LowSeverity: 500},
+		ReturnedAttributes: map[uint32][]uint32{100: {2, 1}, 300: {4}},
+	}
+	assert.Equal(t, []string{
+		"active: false -> true",
+		"filter.severity: 1-1000 -> 500-1000",
+		"returnedAttributes[100]: [1 2] -> [2 1]",
+		"returnedAttributes[300]: [] -> [4]",
+	}, a.Diff(b))
+	assert.False(t, a.Equal(b))
+	assert.True(t, a.Equal(&SubscriptionSpec{BufferTime: 100, Filter: NewSubscriptionFilter(), ReturnedAttributes: map[uint32][]uint32{100: {1, 2}}}))
+	assert.Equal(t, "bufferTime: requested 100, revised 500", SpecRevision{Field: "bufferTime", Requested: 100, Revised: 500}.String())
+}
+
+// subscriptionMgt1 is a subscription of a server without IOPCEventSubscriptionMgt2, only the methods
+// SubscriptionSpec.Apply calls are implemented
+type subscriptionMgt1 struct {
+	EventSubscription
+	active bool
+}
+
+func (s *subscriptionMgt1) SetActive(active bool) error {
+	s.active = active
+	return nil
+}
+
+func (s *subscriptionMgt1) SetBufferTime(bufferTime uint32) (uint32, error) {
+	return bufferTime, nil
+}
+
+func (s *subscriptionMgt1) SetMaxSize(maxSize uint32) (uint32, error) {
+	return maxSize, nil
+}
+
+func (s *subscriptionMgt1) SetFilter([]EventCategoryType, []uint32, uint32, uint32, []string, []string) error {
+	return nil
+}
+
+func (s *subscriptionMgt1) SetKeepAlive(uint32) (uint32, error) {
+	return 0, ErrSubscriptionMgt2NotSupported
+}
+
+func TestSubscriptionSpec_ApplyWithoutKeepAlive(t *testing.T) {
+	sub := &subscriptionMgt1{}
+	spec := &SubscriptionSpec{Active: true, BufferTime: 100, KeepAlive: 10000}
+	revisions, err := spec.Apply(sub)
+	assert.NoError(t, err)
+	assert.Equal(t, []SpecRevision{{Field: "keepAlive", Requested: 10000, Revised: 0}}, revisions)
+	assert.True(t, sub.active)
+
+	revisions, err = (&SubscriptionSpec{}).Apply(sub)
+	assert.NoError(t, err)
+	assert.Empty(t, revisions)
+}
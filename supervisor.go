@@ -0,0 +1,566 @@
+package opcae
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ErrNotConnected is returned by Supervisor.Do while the supervisor has no connection to the server
+var ErrNotConnected = errors.New("opcae: supervisor is not connected")
+
+// ErrSupervisorClosed is returned by Supervisor.Subscribe after the supervisor was closed
+var ErrSupervisorClosed = errors.New("opcae: supervisor is closed")
+
+// Dialer connects to an event server, see EventServerDialer
+type Dialer func(ctx context.Context) (EventServer, error)
+
+type SupervisorState int32
+
+const (
+	// SupervisorConnecting a connection attempt is in progress
+	SupervisorConnecting SupervisorState = iota
+	// SupervisorConnected the server is connected and the subscriptions are created
+	SupervisorConnected
+	// SupervisorDisconnected the connection was lost or the attempt failed, the next attempt follows after the backoff delay
+	SupervisorDisconnected
+	// SupervisorClosed the supervisor was closed
+	SupervisorClosed
+)
+
+func (s SupervisorState) String() string {
+	switch s {
+	case SupervisorConnecting:
+		return "connecting"
+	case SupervisorConnected:
+		return "connected"
+	case SupervisorDisconnected:
+		return "disconnected"
+	case SupervisorClosed:
+		return "closed"
+	}
+	return "unknown"
+}
+
+// SupervisorEvent reports a change of the connection state of a Supervisor
+type SupervisorEvent struct {
+	State SupervisorState
+	// Attempt counts the failed connection attempts since the last connection
+	Attempt int
+	// Err is the failure that led to SupervisorDisconnected
+	Err error
+	// Delay is the time until the next connection attempt for SupervisorDisconnected
+	Delay time.Duration
+	Time  time.Time
+}
+
+// Backoff computes the delay before a connection attempt
+type Backoff struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+	// Jitter randomizes every delay by up to this fraction of it, 0 disables it
+	Jitter float64
+}
+
+// DefaultBackoff starts with one second and doubles the delay up to one minute
+var DefaultBackoff = Backoff{Initial: time.Second, Max: time.Minute, Multiplier: 2}
+
+// Delay returns the delay before the next attempt after failures failed attempts, the first attempt after a
+// lost connection is made at once. A connection that is lost before it was stable counts as a failed attempt,
+// see WithStatusInterval.
+func (b Backoff) Delay(failures int) time.Duration {
+	if failures <= 0 {
+		return 0
+	}
+	multiplier := b.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	d := float64(b.Initial)
+	for i := 1; i < failures && (b.Max <= 0 || d < float64(b.Max)); i++ {
+		d *= multiplier
+	}
+	if b.Max > 0 && d > float64(b.Max) {
+		d = float64(b.Max)
+	}
+	if b.Jitter > 0 {
+		d += d * b.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+// longest returns the longest delay, Initial when there is no maximum
+func (b Backoff) longest() time.Duration {
+	if b.Max > 0 {
+		return b.Max
+	}
+	return b.Initial
+}
+
+type SupervisorOption func(*supervisorOptions)
+
+type supervisorOptions struct {
+	backoff        Backoff
+	statusInterval time.Duration
+	clock          Clock
+	notify         []chan<- SupervisorEvent
+}
+
+// WithBackoff sets the delays between connection attempts, the default is DefaultBackoff
+func WithBackoff(backoff Backoff) SupervisorOption {
+	return func(o *supervisorOptions) {
+		o.backoff = backoff
+	}
+}
+
+// WithStatusInterval sets how often GetStatus checks the connection, a GetStatus call that takes longer fails the
+// connection. The default is 10 seconds and 0 disables the check.
+// A connection is stable once the first check succeeded, or when checks are disabled once it stayed up for the
+// longest backoff delay. Losing a connection that was not stable yet counts as a failed attempt, so a server
+// that accepts connections and fails at once is not dialed in a tight loop.
+func WithStatusInterval(interval time.Duration) SupervisorOption {
+	return func(o *supervisorOptions) {
+		o.statusInterval = interval
+	}
+}
+
+// WithSupervisorClock replaces the clock of the backoff delays and the status checks
+func WithSupervisorClock(clock Clock) SupervisorOption {
+	return func(o *supervisorOptions) {
+		o.clock = clock
+	}
+}
+
+// WithSupervisorNotify sends every SupervisorEvent to ch, without blocking, ch should be buffered
+func WithSupervisorNotify(ch chan<- SupervisorEvent) SupervisorOption {
+	return func(o *supervisorOptions) {
+		o.notify = append(o.notify, ch)
+	}
+}
+
+// Supervisor keeps a connection to an event server. It reconnects when a call reports a lost connection,
+// GetStatus fails or the server requests a shutdown, waiting according to a Backoff between failed attempts.
+// The subscriptions created with Subscribe are created again on every new connection and refreshed.
+type Supervisor struct {
+	dial    Dialer
+	options supervisorOptions
+
+	lock          sync.Mutex
+	state         SupervisorState
+	server        EventServer
+	subscriptions []*SupervisedSubscription
+	failed        chan error
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	stopped chan struct{}
+}
+
+// NewSupervisor starts to connect with dial
+func NewSupervisor(dial Dialer, opts ...SupervisorOption) *Supervisor {
+	o := supervisorOptions{backoff: DefaultBackoff, statusInterval: 10 * time.Second, clock: SystemClock}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Supervisor{
+		dial:    dial,
+		options: o,
+		failed:  make(chan error, 1),
+		ctx:     ctx,
+		cancel:  cancel,
+		stopped: make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *Supervisor) run() {
+	defer close(s.stopped)
+	failures := 0
+	for {
+		s.setState(SupervisorEvent{State: SupervisorConnecting, Attempt: failures})
+		server, err := s.connect()
+		if err != nil {
+			failures++
+		} else {
+			s.setState(SupervisorEvent{State: SupervisorConnected})
+			var stable bool
+			err, stable = s.watch(server)
+			s.disconnect(server)
+			if stable {
+				failures = 0
+			} else {
+				failures++
+			}
+		}
+		if s.ctx.Err() != nil {
+			s.setState(SupervisorEvent{State: SupervisorClosed})
+			return
+		}
+		delay := s.options.backoff.Delay(failures)
+		s.setState(SupervisorEvent{State: SupervisorDisconnected, Attempt: failures, Err: err, Delay: delay})
+		if delay <= 0 {
+			continue
+		}
+		select {
+		case <-s.ctx.Done():
+			s.setState(SupervisorEvent{State: SupervisorClosed})
+			return
+		case <-s.options.clock.After(delay):
+		}
+	}
+}
+
+// connect dials the server and creates the subscriptions
+func (s *Supervisor) connect() (EventServer, error) {
+	server, err := s.dial(s.ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.lock.Lock()
+	s.server = server
+	subscriptions := append([]*SupervisedSubscription(nil), s.subscriptions...)
+	select {
+	case <-s.failed:
+	default:
+	}
+	s.lock.Unlock()
+	for _, ss := range subscriptions {
+		if err := ss.attach(server, true); ConnectionLost(err) {
+			s.disconnect(server)
+			return nil, err
+		}
+	}
+	return server, nil
+}
+
+// watch returns when the connection to server is lost or the supervisor is closed, stable tells whether the
+// connection became stable before, see WithStatusInterval
+func (s *Supervisor) watch(server EventServer) (err error, stable bool) {
+	var settled <-chan time.Time
+	if s.options.statusInterval <= 0 {
+		settled = s.options.clock.After(s.options.backoff.longest())
+	}
+	for {
+		var poll <-chan time.Time
+		if s.options.statusInterval > 0 {
+			poll = s.options.clock.After(s.options.statusInterval)
+		}
+		select {
+		case <-s.ctx.Done():
+			return nil, stable
+		case err := <-s.failed:
+			return err, stable
+		case <-server.ShutdownNotify():
+			return fmt.Errorf("%w: %s", ErrServerShutdown, server.ShutdownReason()), stable
+		case <-settled:
+			settled = nil
+			stable = true
+		case <-poll:
+			// a hung call counts as a lost connection
+			ctx, cancel := context.WithTimeout(s.ctx, s.options.statusInterval)
+			_, err := server.GetStatusContext(ctx)
+			cancel()
+			if err != nil && s.ctx.Err() == nil {
+				return err, stable
+			}
+			stable = true
+		}
+	}
+}
+
+func (s *Supervisor) disconnect(server EventServer) {
+	s.lock.Lock()
+	s.server = nil
+	subscriptions := append([]*SupervisedSubscription(nil), s.subscriptions...)
+	s.lock.Unlock()
+	for _, ss := range subscriptions {
+		ss.detach()
+	}
+	server.Disconnect()
+}
+
+func (s *Supervisor) setState(event SupervisorEvent) {
+	s.lock.Lock()
+	s.state = event.State
+	s.lock.Unlock()
+	event.Time = s.options.clock.Now()
+	for _, ch := range s.options.notify {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// State returns the current connection state
+func (s *Supervisor) State() SupervisorState {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.state
+}
+
+// Server returns the connected server, nil while the supervisor is not connected
+func (s *Supervisor) Server() EventServer {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.server
+}
+
+// Do calls fn with the connected server and reconnects when the returned error means the connection is lost
+func (s *Supervisor) Do(fn func(server EventServer) error) error {
+	server := s.Server()
+	if server == nil {
+		return ErrNotConnected
+	}
+	err := fn(server)
+	s.report(server, err)
+	return err
+}
+
+// ReportError reconnects when err means the connection is lost, pass the errors of calls made on the server
+// or the subscriptions outside Do
+func (s *Supervisor) ReportError(err error) {
+	s.report(s.Server(), err)
+}
+
+// report signals the lost connection to the run loop unless the server was replaced meanwhile
+func (s *Supervisor) report(server EventServer, err error) {
+	if server == nil || !ConnectionLost(err) {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.server != server {
+		return
+	}
+	select {
+	case s.failed <- err:
+	default:
+	}
+}
+
+// Subscribe adds a subscription configured by spec, receiverBufSize and opts are passed to
+// CreateEventSubscription for every connection. While the supervisor is connected the subscription is
+// created at once and errors other than a lost connection are returned.
+func (s *Supervisor) Subscribe(spec *SubscriptionSpec, receiverBufSize uint32, opts ...SubscriptionOption) (*SupervisedSubscription, error) {
+	ss := &SupervisedSubscription{
+		supervisor:      s,
+		receiverBufSize: receiverBufSize,
+		opts:            opts,
+		receiver:        make(chan *EventSinkOnEventData, receiverBufSize),
+		done:            make(chan struct{}),
+		spec:            spec,
+	}
+	s.lock.Lock()
+	if s.ctx.Err() != nil {
+		s.lock.Unlock()
+		return nil, ErrSupervisorClosed
+	}
+	// a connection made from now on creates the subscription, attach skips it when that happened first
+	s.subscriptions = append(s.subscriptions, ss)
+	server := s.server
+	s.lock.Unlock()
+	if server == nil {
+		return ss, nil
+	}
+	err := ss.attach(server, false)
+	if err != nil && !ConnectionLost(err) {
+		s.remove(ss)
+		ss.close()
+		return nil, err
+	}
+	s.report(server, err)
+	return ss, nil
+}
+
+func (s *Supervisor) remove(ss *SupervisedSubscription) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for i, v := range s.subscriptions {
+		if v == ss {
+			s.subscriptions = append(s.subscriptions[:i], s.subscriptions[i+1:]...)
+			return
+		}
+	}
+}
+
+// Close disconnects from the server and closes the receivers of the subscriptions
+func (s *Supervisor) Close() error {
+	s.cancel()
+	<-s.stopped
+	s.lock.Lock()
+	subscriptions := s.subscriptions
+	s.subscriptions = nil
+	s.lock.Unlock()
+	var errs []error
+	for _, ss := range subscriptions {
+		errs = append(errs, ss.close())
+	}
+	return errors.Join(errs...)
+}
+
+// SupervisedSubscription is a subscription that a Supervisor creates again on every connection.
+// Its receiver stays open across reconnects, the notifications of the replaced subscriptions are delivered in order.
+type SupervisedSubscription struct {
+	supervisor      *Supervisor
+	receiverBufSize uint32
+	opts            []SubscriptionOption
+	receiver        chan *EventSinkOnEventData
+	done            chan struct{}
+	forwarding      sync.WaitGroup
+
+	lock      sync.Mutex
+	spec      *SubscriptionSpec
+	sub       EventSubscription
+	revisions []SpecRevision
+	err       error
+	// forwarded is closed when the notifications of the last subscription are forwarded
+	forwarded chan struct{}
+	closed    bool
+}
+
+// attach creates the subscription on server unless it is closed or already created
+func (ss *SupervisedSubscription) attach(server EventServer, refresh bool) error {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+	if ss.closed || ss.sub != nil {
+		return nil
+	}
+	sub, revisions, err := ss.spec.Create(server, ss.receiverBufSize, ss.opts...)
+	ss.err = err
+	if err != nil {
+		return err
+	}
+	// a disconnect that ran before ss.lock was taken left nothing to detach, the subscription belongs to the
+	// lost connection and the next connection creates it again
+	ss.supervisor.lock.Lock()
+	current := ss.supervisor.server == server
+	ss.supervisor.lock.Unlock()
+	if !current {
+		sub.Release()
+		return nil
+	}
+	ss.sub, ss.revisions = sub, revisions
+	previous, forwarded := ss.forwarded, make(chan struct{})
+	ss.forwarded = forwarded
+	ss.forwarding.Add(1)
+	go ss.forward(sub, previous, forwarded)
+	if refresh {
+		if err := sub.Refresh(); ConnectionLost(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// forward copies the notifications of sub into the receiver once the previous subscription is forwarded
+func (ss *SupervisedSubscription) forward(sub EventSubscription, previous, forwarded chan struct{}) {
+	defer ss.forwarding.Done()
+	defer close(forwarded)
+	if previous != nil {
+		select {
+		case <-previous:
+		case <-ss.done:
+			return
+		}
+	}
+	for data := range sub.GetReceiver() {
+		select {
+		case ss.receiver <- data:
+		case <-ss.done:
+			return
+		}
+	}
+}
+
+// detach releases the subscription of the lost connection
+func (ss *SupervisedSubscription) detach() {
+	ss.lock.Lock()
+	sub := ss.sub
+	ss.sub = nil
+	ss.lock.Unlock()
+	if sub != nil {
+		sub.Release()
+	}
+}
+
+// GetReceiver returns the channel of the event notifications of all connections, it is closed by Unsubscribe
+// and Supervisor.Close
+func (ss *SupervisedSubscription) GetReceiver() <-chan *EventSinkOnEventData {
+	return ss.receiver
+}
+
+// Subscription returns the subscription of the current connection, nil while the supervisor is not connected.
+// Changes made to it directly are lost on the next reconnect, use Apply.
+func (ss *SupervisedSubscription) Subscription() EventSubscription {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+	return ss.sub
+}
+
+// Spec returns the configuration the subscription is created with
+func (ss *SupervisedSubscription) Spec() *SubscriptionSpec {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+	return ss.spec
+}
+
+// Apply replaces the configuration and applies it to the subscription of the current connection
+func (ss *SupervisedSubscription) Apply(spec *SubscriptionSpec) ([]SpecRevision, error) {
+	ss.lock.Lock()
+	ss.spec = spec
+	sub := ss.sub
+	ss.lock.Unlock()
+	if sub == nil {
+		return nil, nil
+	}
+	revisions, err := spec.Apply(sub)
+	ss.supervisor.ReportError(err)
+	return revisions, err
+}
+
+// Revisions returns the values the server revised when the subscription was created last
+func (ss *SupervisedSubscription) Revisions() []SpecRevision {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+	return ss.revisions
+}
+
+// Err returns the error of the last attempt to create the subscription, nil when it succeeded
+func (ss *SupervisedSubscription) Err() error {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+	return ss.err
+}
+
+// Unsubscribe releases the subscription and closes the receiver, it is no longer created on reconnects
+func (ss *SupervisedSubscription) Unsubscribe() error {
+	ss.supervisor.remove(ss)
+	return ss.close()
+}
+
+func (ss *SupervisedSubscription) close() error {
+	ss.lock.Lock()
+	if ss.closed {
+		ss.lock.Unlock()
+		return nil
+	}
+	ss.closed = true
+	sub := ss.sub
+	ss.sub = nil
+	ss.lock.Unlock()
+	close(ss.done)
+	var err error
+	if sub != nil {
+		err = sub.Release()
+	}
+	ss.forwarding.Wait()
+	close(ss.receiver)
+	return err
+}
@@ -0,0 +1,99 @@
+package opcae
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackoff_Delay(t *testing.T) {
+	b := Backoff{Initial: 100 * time.Millisecond, Max: time.Second, Multiplier: 2}
+	assert.Equal(t, time.Duration(0), b.Delay(0))
+	assert.Equal(t, 100*time.Millisecond, b.Delay(1))
+	assert.Equal(t, 200*time.Millisecond, b.Delay(2))
+	assert.Equal(t, 800*time.Millisecond, b.Delay(4))
+	assert.Equal(t, time.Second, b.Delay(5))
+	assert.Equal(t, time.Second, b.Delay(1000))
+	assert.Equal(t, 100*time.Millisecond, Backoff{Initial: 100 * time.Millisecond}.Delay(3), "a multiplier below 1 keeps the delay")
+
+	b.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		d := b.Delay(2)
+		assert.True(t, d >= 100*time.Millisecond && d <= 300*time.Millisecond, "%v", d)
+	}
+}
+
+func TestSupervisorState_String(t *testing.T) {
+	assert.Equal(t, "connecting", SupervisorConnecting.String())
+	assert.Equal(t, "connected", SupervisorConnected.String())
+	assert.Equal(t, "disconnected", SupervisorDisconnected.String())
+	assert.Equal(t, "closed", SupervisorClosed.String())
+	assert.Equal(t, "unknown", SupervisorState(42).String())
+}
+
+// lateServer creates subscriptions after Disconnect, like a CreateEventSubscription call that was already
+// in progress when the connection was closed
+type lateServer struct {
+	EventServer
+	created []*lateSubscription
+}
+
+func (s *lateServer) CreateEventSubscription(active bool, bufferTime, maxSize, receiverBufSize uint32, opts ...SubscriptionOption) (EventSubscription, uint32, uint32, error) {
+	sub := &lateSubscription{receiver: make(chan *EventSinkOnEventData)}
+	s.created = append(s.created, sub)
+	return sub, bufferTime, maxSize, nil
+}
+
+func (s *lateServer) Disconnect() error {
+	return nil
+}
+
+// lateSubscription is a subscriptionMgt1 whose receiver is closed by Release
+type lateSubscription struct {
+	subscriptionMgt1
+	receiver chan *EventSinkOnEventData
+	released bool
+}
+
+func (s *lateSubscription) GetReceiver() <-chan *EventSinkOnEventData {
+	return s.receiver
+}
+
+func (s *lateSubscription) Release() error {
+	s.released = true
+	close(s.receiver)
+	return nil
+}
+
+func TestSupervisor_DisconnectBeforeAttach(t *testing.T) {
+	s := NewSupervisor(func(ctx context.Context) (EventServer, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	defer s.Close()
+	ss, err := s.Subscribe(&SubscriptionSpec{Active: true}, 10)
+	require.NoError(t, err)
+
+	// Subscribe took the server, then the connection was lost before attach
+	old := &lateServer{}
+	s.lock.Lock()
+	s.server = old
+	s.lock.Unlock()
+	s.disconnect(old)
+	require.NoError(t, ss.attach(old, false))
+	require.Len(t, old.created, 1)
+	assert.True(t, old.created[0].released, "the subscription of the lost connection is released")
+	assert.Nil(t, ss.Subscription())
+
+	// the next connection creates the subscription again
+	server := &lateServer{}
+	s.lock.Lock()
+	s.server = server
+	s.lock.Unlock()
+	require.NoError(t, ss.attach(server, false))
+	require.Len(t, server.created, 1)
+	assert.Same(t, server.created[0], ss.Subscription())
+}
@@ -1,5 +1,10 @@
 package opcae
 
+import (
+	"fmt"
+	"time"
+)
+
 type Filter uint32
 
 const (
@@ -18,6 +23,22 @@ var filterList = []Filter{
 	OPC_FILTER_BY_SOURCE,
 }
 
+func (f Filter) String() string {
+	switch f {
+	case OPC_FILTER_BY_EVENT:
+		return "event"
+	case OPC_FILTER_BY_CATEGORY:
+		return "category"
+	case OPC_FILTER_BY_SEVERITY:
+		return "severity"
+	case OPC_FILTER_BY_AREA:
+		return "area"
+	case OPC_FILTER_BY_SOURCE:
+		return "source"
+	}
+	return fmt.Sprintf("0x%x", uint32(f))
+}
+
 func ParseFilter(filter uint32) (filters []Filter) {
 	for _, f := range filterList {
 		if filter&uint32(f) != 0 {
@@ -50,6 +71,36 @@ const (
 	OPC_ALL_EVENTS      EventCategoryType = 0x7
 )
 
+func (t EventCategoryType) String() string {
+	switch t {
+	case OPC_SIMPLE_EVENT:
+		return "simple"
+	case OPC_TRACKING_EVENT:
+		return "tracking"
+	case OPC_CONDITION_EVENT:
+		return "condition"
+	case OPC_ALL_EVENTS:
+		return "all"
+	}
+	return fmt.Sprintf("0x%x", uint32(t))
+}
+
+// MarshalText encodes the type by its name so that configuration files can use "simple", "tracking",
+// "condition" and "all"
+func (t EventCategoryType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (t *EventCategoryType) UnmarshalText(text []byte) error {
+	for _, c := range []EventCategoryType{OPC_SIMPLE_EVENT, OPC_TRACKING_EVENT, OPC_CONDITION_EVENT, OPC_ALL_EVENTS} {
+		if string(text) == c.String() {
+			*t = c
+			return nil
+		}
+	}
+	return fmt.Errorf("opcae: unknown event type %q", text)
+}
+
 func MarshalEventCategoryType(categories []EventCategoryType) (category uint32) {
 	for _, c := range categories {
 		category |= uint32(c)
@@ -64,7 +115,8 @@ func UnmarshalEventCategoryType(category uint32) (categories []EventCategoryType
 		OPC_CONDITION_EVENT,
 		OPC_ALL_EVENTS,
 	} {
-		if category&uint32(c) != 0 {
+		// OPC_ALL_EVENTS is only listed when all event types are selected
+		if category&uint32(c) == uint32(c) {
 			categories = append(categories, c)
 		}
 	}
@@ -111,3 +163,104 @@ const (
 	OPC_CONDITION_ACTIVE  State = 0x2
 	OPC_CONDITION_ACKED   State = 0x4
 )
+
+func (s State) IsEnabled() bool {
+	return s&OPC_CONDITION_ENABLED != 0
+}
+
+func (s State) IsActive() bool {
+	return s&OPC_CONDITION_ACTIVE != 0
+}
+
+func (s State) IsAcked() bool {
+	return s&OPC_CONDITION_ACKED != 0
+}
+
+type EventCategory struct {
+	ID          uint32
+	Description string
+}
+
+type EventAttribute struct {
+	ID          uint32
+	Description string
+	Type        uint16
+}
+
+type ItemID struct {
+	ID   string
+	Name string
+	// CLSID is a windows.GUID on Windows and a GUID on other platforms
+	CLSID clsid
+}
+
+// ServerState is the OPCEVENTSERVERSTATE reported by GetStatus
+type ServerState int32
+
+const (
+	OPCAE_STATUS_RUNNING    ServerState = 1
+	OPCAE_STATUS_FAILED     ServerState = 2
+	OPCAE_STATUS_NOCONFIG   ServerState = 3
+	OPCAE_STATUS_SUSPENDED  ServerState = 4
+	OPCAE_STATUS_TEST       ServerState = 5
+	OPCAE_STATUS_COMM_FAULT ServerState = 6
+)
+
+func (s ServerState) String() string {
+	switch s {
+	case 0:
+		return "UNKNOWN"
+	case OPCAE_STATUS_RUNNING:
+		return "RUNNING"
+	case OPCAE_STATUS_FAILED:
+		return "FAILED"
+	case OPCAE_STATUS_NOCONFIG:
+		return "NOCONFIG"
+	case OPCAE_STATUS_SUSPENDED:
+		return "SUSPENDED"
+	case OPCAE_STATUS_TEST:
+		return "TEST"
+	case OPCAE_STATUS_COMM_FAULT:
+		return "COMM_FAULT"
+	}
+	return fmt.Sprintf("ServerState(%d)", int32(s))
+}
+
+type EventServerStatus struct {
+	StartTime      time.Time
+	CurrentTime    time.Time
+	LastUpdateTime time.Time
+	ServerState    ServerState
+	MajorVersion   uint16
+	MinorVersion   uint16
+	BuildNumber    uint16
+	Reserved       uint16
+	VendorInfo     string
+}
+
+// ServerInfo describes an OPC AE server registered on a node
+type ServerInfo struct {
+	ProgID       string
+	ClsStr       string
+	Description  string
+	VerIndProgID string
+	// ClsID is a *windows.GUID on Windows and a *GUID on other platforms
+	ClsID *clsid
+}
+
+// GUID has the memory layout of windows.GUID and can be converted from it, ItemID and ServerInfo use it
+// on platforms without windows.GUID
+type GUID struct {
+	Data1 uint32
+	Data2 uint16
+	Data3 uint16
+	Data4 [8]byte
+}
+
+// String returns the GUID in registry format, e.g. {58E13251-AC87-11D1-84D5-00608CB8A7E9}
+func (g GUID) String() string {
+	return fmt.Sprintf("{%08X-%04X-%04X-%02X%02X-%02X%02X%02X%02X%02X%02X}",
+		g.Data1, g.Data2, g.Data3,
+		g.Data4[0], g.Data4[1],
+		g.Data4[2], g.Data4[3], g.Data4[4], g.Data4[5], g.Data4[6], g.Data4[7])
+}
@@ -0,0 +1,32 @@
+package opcae
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGUIDString(t *testing.T) {
+	guid := GUID{
+		Data1: 0x58E13251,
+		Data2: 0xAC87,
+		Data3: 0x11d1,
+		Data4: [8]byte{0x84, 0xD5, 0x00, 0x60, 0x8C, 0xB8, 0xA7, 0xE9},
+	}
+	assert.Equal(t, "{58E13251-AC87-11D1-84D5-00608CB8A7E9}", guid.String())
+	assert.Equal(t, "{00000000-0000-0000-0000-000000000000}", GUID{}.String())
+}
+
+func TestUnmarshalEventCategoryType(t *testing.T) {
+	assert.Equal(t, []EventCategoryType{OPC_SIMPLE_EVENT, OPC_CONDITION_EVENT}, UnmarshalEventCategoryType(0x5))
+	assert.Equal(t, []EventCategoryType{OPC_SIMPLE_EVENT, OPC_TRACKING_EVENT, OPC_CONDITION_EVENT, OPC_ALL_EVENTS}, UnmarshalEventCategoryType(0x7))
+	assert.Equal(t, uint32(0x5), MarshalEventCategoryType(UnmarshalEventCategoryType(0x5)))
+}
+
+func TestServerState_String(t *testing.T) {
+	assert.Equal(t, "RUNNING", OPCAE_STATUS_RUNNING.String())
+	assert.Equal(t, "COMM_FAULT", OPCAE_STATUS_COMM_FAULT.String())
+	assert.Equal(t, "NOCONFIG", OPCAE_STATUS_NOCONFIG.String())
+	assert.Equal(t, "UNKNOWN", ServerState(0).String())
+	assert.Equal(t, "ServerState(9)", ServerState(9).String())
+}
@@ -0,0 +1,117 @@
+package opcae
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the time source used by the watchdog, tests replace it with a fake clock
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// SystemClock is the Clock backed by the time package
+var SystemClock Clock = systemClock{}
+
+// SubscriptionStall is reported when a subscription received neither events nor keep-alive callbacks within the watchdog timeout
+type SubscriptionStall struct {
+	ClientHandle uint32
+	LastActivity time.Time
+	Silence      time.Duration
+}
+
+// Watchdog detects a stalled subscription.
+// Every event or keep-alive callback must call Feed, a stall is reported once per silent period when
+// no activity was seen for keepAlive*multiple.
+type Watchdog struct {
+	clock        Clock
+	clientHandle uint32
+	interval     time.Duration
+	timeout      time.Duration
+	notify       chan<- *SubscriptionStall
+
+	lock         sync.Mutex
+	lastActivity time.Time
+	stalled      bool
+	stop         chan struct{}
+	stopOnce     sync.Once
+}
+
+func NewWatchdog(clock Clock, clientHandle uint32, keepAlive time.Duration, multiple uint32, notify chan<- *SubscriptionStall) *Watchdog {
+	if multiple == 0 {
+		multiple = 1
+	}
+	return &Watchdog{
+		clock:        clock,
+		clientHandle: clientHandle,
+		interval:     keepAlive,
+		timeout:      keepAlive * time.Duration(multiple),
+		notify:       notify,
+		lastActivity: clock.Now(),
+		stop:         make(chan struct{}),
+	}
+}
+
+// Feed records subscription activity
+func (w *Watchdog) Feed() {
+	w.lock.Lock()
+	w.lastActivity = w.clock.Now()
+	w.stalled = false
+	w.lock.Unlock()
+}
+
+// Check reports whether the subscription is stalled, the stall is sent to the notify channel the first time it is detected
+func (w *Watchdog) Check() bool {
+	w.lock.Lock()
+	silence := w.clock.Now().Sub(w.lastActivity)
+	if silence < w.timeout {
+		w.lock.Unlock()
+		return false
+	}
+	first := !w.stalled
+	w.stalled = true
+	stall := &SubscriptionStall{
+		ClientHandle: w.clientHandle,
+		LastActivity: w.lastActivity,
+		Silence:      silence,
+	}
+	w.lock.Unlock()
+	if first && w.notify != nil {
+		select {
+		case w.notify <- stall:
+		default:
+		}
+	}
+	return true
+}
+
+// Start checks the subscription once per keep-alive interval until Stop is called
+func (w *Watchdog) Start() {
+	go func() {
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-w.clock.After(w.interval):
+				w.Check()
+			}
+		}
+	}()
+}
+
+func (w *Watchdog) Stop() {
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+}
@@ -0,0 +1,100 @@
+package opcae
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClock struct {
+	lock    sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	deadline time.Time
+	ch       chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	ch := make(chan time.Time, 1)
+	c.waiters = append(c.waiters, fakeWaiter{deadline: c.now.Add(d), ch: ch})
+	return ch
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = c.now.Add(d)
+	waiters := c.waiters[:0]
+	for _, w := range c.waiters {
+		if !c.now.Before(w.deadline) {
+			w.ch <- c.now
+			continue
+		}
+		waiters = append(waiters, w)
+	}
+	c.waiters = waiters
+}
+
+func (c *fakeClock) waiterCount() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.waiters)
+}
+
+func TestWatchdog_Check(t *testing.T) {
+	clock := newFakeClock()
+	notify := make(chan *SubscriptionStall, 10)
+	watchdog := NewWatchdog(clock, 1, time.Second, 3, notify)
+	clock.Advance(2 * time.Second)
+	assert.False(t, watchdog.Check())
+	watchdog.Feed()
+	clock.Advance(2 * time.Second)
+	assert.False(t, watchdog.Check())
+	clock.Advance(time.Second)
+	assert.True(t, watchdog.Check())
+	assert.True(t, watchdog.Check())
+	assert.Len(t, notify, 1)
+	stall := <-notify
+	assert.Equal(t, uint32(1), stall.ClientHandle)
+	assert.Equal(t, 3*time.Second, stall.Silence)
+	watchdog.Feed()
+	assert.False(t, watchdog.Check())
+	clock.Advance(3 * time.Second)
+	assert.True(t, watchdog.Check())
+	assert.Len(t, notify, 1)
+}
+
+func TestWatchdog_Start(t *testing.T) {
+	clock := newFakeClock()
+	notify := make(chan *SubscriptionStall, 1)
+	watchdog := NewWatchdog(clock, 2, time.Second, 2, notify)
+	watchdog.Start()
+	defer watchdog.Stop()
+	for i := 0; i < 2; i++ {
+		assert.Eventually(t, func() bool { return clock.waiterCount() == 1 }, time.Second, time.Millisecond)
+		clock.Advance(time.Second)
+	}
+	select {
+	case stall := <-notify:
+		assert.Equal(t, uint32(2), stall.ClientHandle)
+	case <-time.After(time.Second):
+		t.Fatal("stall not reported")
+	}
+}